@@ -0,0 +1,45 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime/pprof"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// dumpOutput receives the goroutine dumps; tests replace it.
+var dumpOutput io.Writer = os.Stderr
+
+// handleGoroutineDumps writes a stack trace of all goroutines to stderr every
+// time the process receives SIGUSR1, until ctx is done. The relay keeps running
+// after each dump.
+//
+// Parameters:
+//   - ctx: context bounding the signal handler.
+//   - logger: zap.Logger for observability.
+func handleGoroutineDumps(ctx context.Context, logger *zap.Logger) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGUSR1)
+	defer signal.Stop(sigCh)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigCh:
+			logger.Info("received SIGUSR1, dumping goroutines to stderr")
+			fmt.Fprintf(dumpOutput, "=== goroutine dump at %s ===\n", time.Now().Format(time.RFC3339Nano))
+			if err := pprof.Lookup("goroutine").WriteTo(dumpOutput, 1); err != nil {
+				logger.Error("failed to dump goroutines", zap.Error(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+//go:build !windows
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestSIGUSR1DumpsGoroutines(t *testing.T) {
+	out := &syncBuffer{}
+	dumpOutput = out
+	// Keeps SIGUSR1 from terminating the test before the handler listens
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGUSR1)
+	defer signal.Stop(sigCh)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		handleGoroutineDumps(ctx, zap.NewNop())
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+		dumpOutput = os.Stderr
+	}()
+
+	// The handler may not be listening yet: signal until the dump appears
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(out.String(), "goroutine profile:") {
+		if time.Now().After(deadline) {
+			t.Fatal("no goroutine dump after SIGUSR1")
+		}
+		if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !strings.HasPrefix(out.String(), "=== goroutine dump at ") {
+		t.Fatalf("dump is not prefixed with its timestamp: %.80q", out.String())
+	}
+}
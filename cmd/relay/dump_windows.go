@@ -0,0 +1,12 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// handleGoroutineDumps is a no-op on Windows, which has no SIGUSR1.
+func handleGoroutineDumps(_ context.Context, _ *zap.Logger) {}
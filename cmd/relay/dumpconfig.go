@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+
+	"github.com/kubensage/relay/pkg/cli"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// dumpConfigFileMode is the permission of the effective configuration file.
+const dumpConfigFileMode = 0o600
+
+// dumpConfig writes the effective relay configuration as YAML to
+// relayCfg.DumpConfigPath, replacing any existing file. Secrets are redacted
+// as in the startup log. Failures are logged as warnings and do not stop the
+// relay.
+//
+// Parameters:
+//   - relayCfg: the parsed relay configuration.
+//   - logger: zap.Logger for observability.
+func dumpConfig(relayCfg *cli.RelayConfig, logger *zap.Logger) {
+	data, err := yaml.Marshal(relayCfg)
+	if err != nil {
+		logger.Warn("failed to marshal effective configuration", zap.Error(err))
+		return
+	}
+
+	path := relayCfg.DumpConfigPath
+	if err := os.WriteFile(path, data, dumpConfigFileMode); err != nil {
+		logger.Warn("failed to write effective configuration", zap.String("path", path), zap.Error(err))
+		return
+	}
+	// WriteFile keeps the mode of an existing file
+	if err := os.Chmod(path, dumpConfigFileMode); err != nil {
+		logger.Warn("failed to restrict effective configuration file mode", zap.String("path", path), zap.Error(err))
+	}
+	logger.Info("wrote effective configuration", zap.String("path", path))
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/kubensage/relay/pkg/cli"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+func TestDumpConfigWritesEffectiveConfiguration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "relay.yaml")
+	// An existing file is replaced and its mode restricted
+	if err := os.WriteFile(path, []byte("stale"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dumpConfig(&cli.RelayConfig{
+		RelayAddress:    "127.0.0.1:5000",
+		TokenSigningKey: "hunter2",
+		DumpConfigPath:  path,
+	}, zap.NewNop())
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dumped map[string]any
+	if err := yaml.Unmarshal(data, &dumped); err != nil {
+		t.Fatalf("dumped configuration is not YAML: %v", err)
+	}
+	if got := dumped["relayaddress"]; got != "127.0.0.1:5000" {
+		t.Fatalf("relay address: got %v, want 127.0.0.1:5000", got)
+	}
+	if got := dumped["tokensigningkey"]; got != "[redacted]" {
+		t.Fatalf("token signing key: got %v, want it redacted", got)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != dumpConfigFileMode {
+		t.Fatalf("file mode: got %v, want %v", mode, os.FileMode(dumpConfigFileMode))
+	}
+}
@@ -2,17 +2,25 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"net"
-	"os/signal"
-	"syscall"
+	"net/http"
+	"os"
 
+	"github.com/Masterminds/semver/v3"
 	gocli "github.com/kubensage/common/cli"
 	golog "github.com/kubensage/common/log"
 	"github.com/kubensage/relay/pkg/cli"
+	_ "github.com/kubensage/relay/pkg/codec" // Registers the application/grpc+json codec and the compressors
 	grpc2 "github.com/kubensage/relay/pkg/grpc"
+	"github.com/kubensage/relay/pkg/quota"
+	"github.com/kubensage/relay/pkg/sse"
+	"github.com/kubensage/relay/pkg/token"
 	"github.com/kubensage/relay/proto/gen"
+	"github.com/kubensage/relay/proto/gen/admin"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 )
@@ -25,7 +33,10 @@ const appName = "relay"
 //  1. Registers and parses logging and relay configuration flags.
 //  2. Initializes the logger and relay configuration.
 //  3. Sets up a gRPC server listening on the configured address.
-//  4. Handles graceful shutdown on SIGINT or SIGTERM.
+//  4. Optionally serves Prometheus metrics over HTTP.
+//  5. Handles graceful shutdown on SIGINT or SIGTERM, or on a Service Control
+//     Manager stop request when running as a Windows service.
+//  6. Dumps all goroutine stacks to stderr on SIGUSR1 (non-Windows only).
 func main() {
 	// Register CLI flags for logging and relay configuration
 	logCfgFn := gocli.RegisterLogStdFlags(flag.CommandLine)
@@ -41,10 +52,19 @@ func main() {
 	// Print startup configuration at INFO level
 	golog.LogStartupInfo(logger, appName, logCfg, relayCfg)
 
-	// Set up context that cancels on SIGINT or SIGTERM
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	// Snapshot the effective configuration before starting the server
+	if relayCfg.DumpConfigPath != "" {
+		dumpConfig(relayCfg, logger)
+	}
+
+	// Set up context that cancels on SIGINT or SIGTERM, or on a stop request
+	// when running as a Windows service
+	ctx, stop := shutdownContext(logger)
 	defer stop()
 
+	// Dump goroutine stacks to stderr on SIGUSR1
+	go handleGoroutineDumps(ctx, logger)
+
 	// Start TCP listener
 	listener, err := net.Listen("tcp", relayCfg.RelayAddress)
 	if err != nil {
@@ -52,9 +72,84 @@ func main() {
 	}
 
 	// Initialize gRPC server and register service
-	grpcServer := grpc.NewServer()
-	gen.RegisterMetricsServiceServer(grpcServer, grpc2.NewMetricsServer(logger))
+	var serverOpts []grpc2.ServerOption
+	if relayCfg.TokenSigningKey != "" {
+		signer := token.NewSigner([]byte(relayCfg.TokenSigningKey), relayCfg.TokenTTL)
+		serverOpts = append(serverOpts, grpc2.WithReconnectTokens(signer))
+	}
+	if relayCfg.AllowAgentIDReuse {
+		serverOpts = append(serverOpts, grpc2.WithAgentIDReuse())
+	}
+	if relayCfg.OneStreamPerIP {
+		serverOpts = append(serverOpts, grpc2.WithOneStreamPerIP())
+	}
+	serverOpts = append(serverOpts, grpc2.WithSendMetricsIdleTimeout(relayCfg.SendMetricsIdleTimeout))
+	serverOpts = append(serverOpts, grpc2.WithMinSendInterval(relayCfg.MinSendInterval))
+	serverOpts = append(serverOpts, grpc2.WithSubscriberFlowControl(relayCfg.MaxUnackedMessages, relayCfg.WindowBlockTimeout))
+	serverOpts = append(serverOpts, grpc2.WithAgentRateAlert(relayCfg.AgentRateAlertThreshold, relayCfg.AgentRateEWMAWindow))
+	serverOpts = append(serverOpts, grpc2.WithAgentLogInterval(relayCfg.AgentLogInterval))
+	if relayCfg.SupportedAgentVersions != "" {
+		// Already validated by the flag parser
+		constraints, _ := semver.NewConstraint(relayCfg.SupportedAgentVersions)
+		serverOpts = append(serverOpts, grpc2.WithSupportedAgentVersions(constraints, relayCfg.RequireSupportedAgentVersion))
+	}
+	serverOpts = append(serverOpts, grpc2.WithBatching(relayCfg.BatchSize, relayCfg.BatchFlushInterval))
+	serverOpts = append(serverOpts, grpc2.WithPersistentSubscribers(relayCfg.SubscriberPersistTTL))
+	serverOpts = append(serverOpts, grpc2.WithSendAcks(relayCfg.AckInterval, relayCfg.AckEveryMessages))
+	serverOpts = append(serverOpts, grpc2.WithMaxProtoDepth(relayCfg.MaxProtoDepth))
+	serverOpts = append(serverOpts, grpc2.WithMaxMessageSize(relayCfg.MaxMessageSizeBytes))
+	serverOpts = append(serverOpts, grpc2.WithMaxPodsPerMessage(relayCfg.MaxPodsPerMessage))
+	serverOpts = append(serverOpts, grpc2.WithMaxClusterTopics(relayCfg.MaxClusterTopics))
+	serverOpts = append(serverOpts, grpc2.WithPausedRetryAfter(relayCfg.PausedRetryAfter))
+	if relayCfg.RequireSubscriberAck {
+		serverOpts = append(serverOpts, grpc2.WithSubscriberAck(relayCfg.SubscriberAckTimeout))
+	}
+	if relayCfg.MergerChannelSize > 0 {
+		serverOpts = append(serverOpts, grpc2.WithMerger(ctx, relayCfg.MergerChannelSize))
+	}
+	if relayCfg.ForwardToRelay != "" {
+		var forwardDialOpts []grpc.DialOption
+		if relayCfg.ForwardTLSCert != "" || relayCfg.ForwardTLSCA != "" {
+			creds, err := grpc2.ForwardTLSCredentials(relayCfg.ForwardTLSCert, relayCfg.ForwardTLSKey, relayCfg.ForwardTLSCA)
+			if err != nil {
+				logger.Fatal("failed to load parent relay TLS credentials", zap.Error(err))
+			}
+			forwardDialOpts = append(forwardDialOpts, grpc.WithTransportCredentials(creds))
+		}
+		serverOpts = append(serverOpts, grpc2.WithForwardToRelay(ctx, relayCfg.ForwardToRelay, forwardDialOpts...))
+	}
+	if relayCfg.EnforceSendOrdering {
+		serverOpts = append(serverOpts, grpc2.WithSendOrdering())
+	}
+	if relayCfg.QuotaDailyMessages > 0 {
+		store := quota.NewMemoryStore(relayCfg.QuotaDailyMessages)
+		go quota.ResetDaily(ctx, store)
+		serverOpts = append(serverOpts, grpc2.WithQuota(store))
+	}
+
+	var grpcOpts []grpc.ServerOption
+	if relayCfg.GRPCMaxConcurrentStreams > 0 {
+		grpcOpts = append(grpcOpts, grpc.MaxConcurrentStreams(relayCfg.GRPCMaxConcurrentStreams))
+	}
+
+	grpcServer := grpc.NewServer(grpcOpts...)
+	broadcasterOpts := []grpc2.BroadcasterOption{
+		grpc2.WithLogger(logger),
+		grpc2.WithReplayBuffer(relayCfg.ReplayBufferSize),
+		grpc2.WithPauseBuffer(relayCfg.PauseBufferSize),
+	}
+	if relayCfg.BroadcastCloneMessages {
+		broadcasterOpts = append(broadcasterOpts, grpc2.WithMessageCloning())
+	}
+	broadcaster := grpc2.NewBroadcaster(ctx, broadcasterOpts...)
+	metricsServer := grpc2.NewMetricsServer(logger, broadcaster, serverOpts...)
+	gen.RegisterMetricsServiceServer(grpcServer, metricsServer)
+	if relayCfg.EnableAdmin {
+		admin.RegisterAdminServiceServer(grpcServer, grpc2.NewAdminServer(metricsServer, logger))
+		logger.Warn("admin service enabled without authentication")
+	}
 	logger.Info("gRPC server listening", zap.String("address", relayCfg.RelayAddress))
+	printReady(os.Stdout, relayCfg.RelayAddress, logger)
 
 	// Run gRPC server in a goroutine
 	go func() {
@@ -64,11 +159,55 @@ func main() {
 		}
 	}()
 
+	// Inject metrics from stdin if enabled
+	if relayCfg.StdinMetrics {
+		go readStdinMetrics(os.Stdin, broadcaster, logger)
+		logger.Info("reading metrics from stdin")
+	}
+
+	// Serve Prometheus metrics if enabled
+	var metricsHTTP *http.Server
+	if relayCfg.MetricsAddress != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		metricsHTTP = &http.Server{Addr: relayCfg.MetricsAddress, Handler: mux}
+
+		go func() {
+			if err := metricsHTTP.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Fatal("failed to serve metrics", zap.Error(err))
+			}
+		}()
+		logger.Info("metrics endpoint listening", zap.String("address", relayCfg.MetricsAddress))
+	}
+
+	// Serve server-sent events if enabled
+	var sseHTTP *http.Server
+	if relayCfg.SSEAddress != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/", sse.SSEHandler(broadcaster))
+		sseHTTP = &http.Server{Addr: relayCfg.SSEAddress, Handler: mux}
+
+		go func() {
+			if err := sseHTTP.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Fatal("failed to serve server-sent events", zap.Error(err))
+			}
+		}()
+		logger.Info("server-sent events endpoint listening", zap.String("address", relayCfg.SSEAddress))
+	}
+
 	// Wait for termination signal
 	<-ctx.Done()
 	logger.Info("received termination signal, shutting down...")
 
-	// Gracefully stop gRPC server
-	grpcServer.GracefulStop()
-	logger.Info("gRPC server stopped gracefully")
+	if metricsHTTP != nil {
+		_ = metricsHTTP.Close()
+	}
+	if sseHTTP != nil {
+		_ = sseHTTP.Close()
+	}
+
+	// Close subscriber streams, then gracefully stop gRPC server within the shutdown timeout
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), relayCfg.ShutdownTimeout)
+	defer cancel()
+	shutdown(shutdownCtx, grpcServer, metricsServer, logger)
 }
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// readyEvent is the line printed to stdout once the relay accepts connections.
+type readyEvent struct {
+	Status    string `json:"status"`
+	Address   string `json:"address"`
+	Timestamp string `json:"timestamp"`
+}
+
+// printReady writes a single JSON "ready" line to w (typically os.Stdout),
+// directly rather than through the logger, for init systems and orchestrators
+// that detect readiness from the output, e.g.
+// {"status":"ready","address":":50051","timestamp":"2024-01-02T15:04:05.123Z"}.
+// Unlike log entries, the line has no level field. Failures are logged as
+// warnings and do not stop the relay.
+//
+// Parameters:
+//   - w: destination of the ready line.
+//   - address: the configured relay listening address.
+//   - logger: zap.Logger for observability.
+func printReady(w io.Writer, address string, logger *zap.Logger) {
+	event := readyEvent{
+		Status:    "ready",
+		Address:   address,
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	// Encode appends the newline terminating the line
+	if err := json.NewEncoder(w).Encode(event); err != nil {
+		logger.Warn("failed to print ready event", zap.Error(err))
+	}
+}
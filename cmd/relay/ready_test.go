@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestPrintReadyWritesJSONLine(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	printReady(w, "localhost:50051", zap.NewNop())
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() {
+		t.Fatalf("no ready line: %v", scanner.Err())
+	}
+	var event map[string]string
+	if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+		t.Fatalf("ready line %q is not JSON: %v", scanner.Text(), err)
+	}
+	if event["status"] != "ready" || event["address"] != "localhost:50051" {
+		t.Fatalf("ready event: got %v, want status ready at localhost:50051", event)
+	}
+	ts, err := time.Parse(time.RFC3339Nano, event["timestamp"])
+	if err != nil || ts.Location() != time.UTC {
+		t.Fatalf("timestamp %q: want RFC 3339 UTC (%v)", event["timestamp"], err)
+	}
+	if scanner.Scan() {
+		t.Fatalf("unexpected output after the ready line: %q", scanner.Text())
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+)
+
+// shutdownContext returns a context that is canceled on SIGINT or SIGTERM.
+//
+// Parameters:
+//   - _ (*zap.Logger): unused; the Windows implementation logs service errors.
+//
+// Returns:
+//   - context.Context: canceled when the relay must shut down.
+//   - func(): releases the signal handlers; call it once the relay has shut down.
+func shutdownContext(_ *zap.Logger) (context.Context, func()) {
+	return signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+}
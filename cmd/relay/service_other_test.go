@@ -0,0 +1,25 @@
+//go:build !windows
+
+package main
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestShutdownContextIsCanceledOnSIGTERM(t *testing.T) {
+	ctx, stop := shutdownContext(zap.NewNop())
+	defer stop()
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the context was not canceled on SIGTERM")
+	}
+}
@@ -0,0 +1,94 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+	"golang.org/x/sys/windows/svc"
+)
+
+// shutdownContext returns a context that is canceled when the relay must shut
+// down. Under the Windows Service Control Manager, the relay runs as the
+// "relay" service and the context is canceled by a stop or shutdown request;
+// otherwise it is canceled on SIGINT or SIGTERM, as on other platforms.
+//
+// Parameters:
+//   - logger: zap.Logger for observability.
+//
+// Returns:
+//   - context.Context: canceled when the relay must shut down.
+//   - func(): call it once the relay has shut down; under the SCM, it reports
+//     the service as stopped and waits for the service dispatcher to return.
+func shutdownContext(logger *zap.Logger) (context.Context, func()) {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		logger.Fatal("failed to detect the Windows service environment", zap.Error(err))
+	}
+	if !isService {
+		return signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	handler := &serviceHandler{cancel: cancel, stopped: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := svc.Run(appName, handler); err != nil {
+			logger.Error("Windows service dispatcher failed", zap.Error(err))
+		}
+		// Also shut down if the dispatcher returns early
+		cancel()
+	}()
+
+	logger.Info("running as a Windows service", zap.String("service_name", appName))
+	return ctx, func() {
+		cancel()
+		close(handler.stopped)
+		<-done
+	}
+}
+
+// serviceHandler implements svc.Handler for the relay service.
+type serviceHandler struct {
+	cancel  context.CancelFunc // Starts the relay shutdown
+	stopped chan struct{}      // Closed once the relay has shut down
+}
+
+// Execute reports the service as running and forwards stop and shutdown
+// requests to the relay shutdown context. It returns once the relay has shut
+// down, which reports the service as stopped.
+//
+// Parameters:
+//   - _ ([]string): unused service arguments.
+//   - requests: change requests from the Service Control Manager.
+//   - changes: service status updates sent to the Service Control Manager.
+//
+// Returns:
+//   - bool: always false (no service-specific exit code).
+//   - uint32: always 0 (exit code).
+func (h *serviceHandler) Execute(_ []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				changes <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+				h.cancel()
+				<-h.stopped
+				return false, 0
+			}
+		case <-h.stopped:
+			// The relay shut down on its own
+			return false, 0
+		}
+	}
+}
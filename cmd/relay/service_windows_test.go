@@ -0,0 +1,59 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+func TestServiceHandlerForwardsStopRequests(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	handler := &serviceHandler{cancel: cancel, stopped: make(chan struct{})}
+	requests := make(chan svc.ChangeRequest)
+	changes := make(chan svc.Status, 4)
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		handler.Execute(nil, requests, changes)
+	}()
+
+	// next returns the next status reported by Execute
+	next := func() svc.State {
+		t.Helper()
+		select {
+		case s := <-changes:
+			return s.State
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for a service status")
+			return 0
+		}
+	}
+
+	if state := next(); state != svc.StartPending {
+		t.Fatalf("first status: got %v, want StartPending", state)
+	}
+	if state := next(); state != svc.Running {
+		t.Fatalf("second status: got %v, want Running", state)
+	}
+	requests <- svc.ChangeRequest{Cmd: svc.Interrogate, CurrentStatus: svc.Status{State: svc.Running}}
+	if state := next(); state != svc.Running {
+		t.Fatalf("interrogate: got %v, want Running", state)
+	}
+
+	requests <- svc.ChangeRequest{Cmd: svc.Stop}
+	if state := next(); state != svc.StopPending {
+		t.Fatalf("stop: got %v, want StopPending", state)
+	}
+	<-ctx.Done()
+	select {
+	case <-returned:
+		t.Fatal("Execute returned before the relay shut down")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(handler.stopped)
+	<-returned
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+
+	grpc2 "github.com/kubensage/relay/pkg/grpc"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// shutdown drains the subscriber streams and stops the gRPC server gracefully,
+// forcing it to stop if graceful shutdown does not complete before ctx is done.
+//
+// Behavior:
+//   - Subscriber channels are closed first, so that SubscribeMetrics streams return.
+//   - GracefulStop runs in its own goroutine while shutdown waits on it or on ctx.
+//   - When ctx is done first, the server is stopped forcibly and a warning is logged.
+//
+// Parameters:
+//   - ctx: bounds the graceful shutdown (typically a context.WithTimeout).
+//   - grpcServer: the server to stop.
+//   - metricsServer: the MetricsServer whose subscribers are drained.
+//   - logger: zap.Logger for observability.
+func shutdown(ctx context.Context, grpcServer *grpc.Server, metricsServer *grpc2.MetricsServer, logger *zap.Logger) {
+	metricsServer.DrainAndClose()
+
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		logger.Info("gRPC server stopped gracefully")
+	case <-ctx.Done():
+		logger.Warn("graceful shutdown timed out, forcing gRPC server stop", zap.Error(ctx.Err()))
+		// Stop closes every connection, which also lets GracefulStop return
+		grpcServer.Stop()
+		<-stopped
+	}
+}
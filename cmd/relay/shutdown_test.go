@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	grpc2 "github.com/kubensage/relay/pkg/grpc"
+	"github.com/kubensage/relay/proto/gen"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestShutdownForcesStopAfterTimeout(t *testing.T) {
+	broadcaster := grpc2.NewBroadcaster(t.Context(), grpc2.WithMetrics(prometheus.NewRegistry()))
+	metricsServer := grpc2.NewMetricsServer(zap.NewNop(), broadcaster)
+	grpcServer := grpc.NewServer()
+	gen.RegisterMetricsServiceServer(grpcServer, metricsServer)
+	lis := bufconn.Listen(1 << 20)
+	go func() { _ = grpcServer.Serve(lis) }()
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// An agent stream that is never closed keeps GracefulStop waiting
+	stream, err := gen.NewMetricsServiceClient(conn).SendMetrics(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Send(&gen.Metrics{}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for metricsServer.ActiveAgentCount() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("agent stream did not open")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	const timeout = 50 * time.Millisecond
+	ctx, cancel := context.WithTimeout(t.Context(), timeout)
+	defer cancel()
+	core, logs := observer.New(zap.WarnLevel)
+	start := time.Now()
+	shutdown(ctx, grpcServer, metricsServer, zap.New(core))
+
+	if d := time.Since(start); d < timeout || d > 20*timeout {
+		t.Fatalf("shutdown took %v, want about the %v timeout", d, timeout)
+	}
+	if logs.FilterMessage("graceful shutdown timed out, forcing gRPC server stop").Len() != 1 {
+		t.Fatal("forced stop was not logged")
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	grpc2 "github.com/kubensage/relay/pkg/grpc"
+	"github.com/kubensage/relay/proto/gen"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// maxStdinLineSize bounds a single JSON-encoded Metrics line read from stdin.
+const maxStdinLineSize = 16 << 20
+
+// readStdinMetrics reads newline-delimited JSON Metrics messages from r and
+// broadcasts each one, as if it had been received from an agent.
+//
+// Behavior:
+//   - Empty lines are skipped.
+//   - Lines that fail to unmarshal are logged as warnings and skipped.
+//   - Returns on EOF or on a read error.
+//
+// Parameters:
+//   - r: source of newline-delimited JSON (typically os.Stdin).
+//   - broadcaster: Broadcaster that receives the decoded messages.
+//   - logger: zap.Logger for observability.
+func readStdinMetrics(r io.Reader, broadcaster *grpc2.Broadcaster, logger *zap.Logger) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStdinLineSize)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		msg := &gen.Metrics{}
+		if err := protojson.Unmarshal(data, msg); err != nil {
+			logger.Warn("skipping invalid stdin metrics line", zap.Int("line", line), zap.Error(err))
+			continue
+		}
+
+		broadcaster.Broadcast(msg)
+	}
+
+	if err := scanner.Err(); err != nil {
+		logger.Error("failed to read metrics from stdin", zap.Error(err))
+		return
+	}
+	logger.Info("stdin closed, stopped reading metrics")
+}
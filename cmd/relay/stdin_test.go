@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	grpc2 "github.com/kubensage/relay/pkg/grpc"
+	"github.com/kubensage/relay/proto/gen"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+func TestReadStdinMetricsBroadcastsEachLine(t *testing.T) {
+	broadcaster := grpc2.NewBroadcaster(t.Context(), grpc2.WithMetrics(prometheus.NewRegistry()))
+	ch := make(chan *gen.Metrics, 10)
+	if _, err := broadcaster.Register("sub", ch); err != nil {
+		t.Fatal(err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		readStdinMetrics(r, broadcaster, zap.NewNop())
+		close(done)
+	}()
+
+	for i := range 5 {
+		fmt.Fprintf(w, "{\"nodeMetrics\":{\"hostname\":\"node-%d\"}}\n", i)
+		if i == 2 {
+			fmt.Fprintln(w, "not json")
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("readStdinMetrics did not return on EOF")
+	}
+	if len(ch) != 5 {
+		t.Fatalf("broadcast messages: got %d, want 5", len(ch))
+	}
+	for i := range 5 {
+		if got, want := (<-ch).GetNodeMetrics().GetHostname(), fmt.Sprintf("node-%d", i); got != want {
+			t.Fatalf("message %d: got host %q, want %q", i, got, want)
+		}
+	}
+}
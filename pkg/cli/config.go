@@ -1,10 +1,17 @@
 package cli
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"math"
+	"net"
 	"os"
+	"strconv"
+	"time"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/kubensage/relay/pkg/buildinfo"
 	"go.uber.org/zap"
 )
@@ -14,8 +21,130 @@ import (
 // Fields:
 //   - RelayAddress: TCP address where the relay's gRPC server will listen
 //     for incoming agent connections. Typically, in the form "host:port".
+//   - TokenSigningKey: HMAC-SHA256 key used to sign subscriber reconnection tokens.
+//     Empty disables reconnection tokens.
+//   - TokenTTL: lifetime of issued reconnection tokens.
+//   - MetricsAddress: TCP address of the Prometheus /metrics HTTP endpoint.
+//     Empty disables the endpoint.
+//   - SSEAddress: TCP address of the server-sent events HTTP endpoint streaming
+//     broadcast metrics. Empty disables the endpoint.
+//   - EnableAdmin: whether the unauthenticated AdminService is registered on the
+//     relay gRPC server.
+//   - OneStreamPerIP: whether each agent IP is limited to a single open agent stream.
+//   - SendMetricsIdleTimeout: SendMetrics streams idle for this long are closed (0 = disabled).
+//   - AgentRateAlertThreshold: per-agent messages/sec above which a warning is logged (0 = disabled).
+//   - AgentRateEWMAWindow: averaging window of the per-agent message rate.
+//   - AgentLogInterval: interval of the per-agent SendMetrics summary log (0 = disabled).
+//   - SupportedAgentVersions: semver constraints checked against the relay-agent-version
+//     metadata of agent streams. Empty disables the check.
+//   - RequireSupportedAgentVersion: whether agent streams with an unsupported version are rejected.
+//   - GRPCMaxConcurrentStreams: HTTP/2 SETTINGS_MAX_CONCURRENT_STREAMS advertised by the
+//     gRPC server (0 = gRPC default, unlimited).
+//   - QuotaDailyMessages: messages each agent may send per UTC day (0 = unlimited).
+//   - BatchSize: number of SendMetrics messages broadcast together (1 = no batching).
+//   - BatchFlushInterval: maximum wait before a partial batch is broadcast (0 = only when full).
+//   - ReplayBufferSize: number of recent messages replayed to new subscribers (0 = disabled).
+//   - BroadcastCloneMessages: whether every subscriber receives its own copy of each message.
+//   - PauseBufferSize: number of messages held while broadcasting is paused.
+//   - SubscriberPersistTTL: retention of persistent subscriber delivery positions (0 = disabled).
+//   - EnforceSendOrdering: whether out-of-order SendMetrics sequence numbers are rejected.
+//   - AckInterval: interval of the SendMetricsV2 intermediate acknowledgments (0 = final only).
+//   - AckEveryMessages: number of messages that triggers a SendMetricsV2 acknowledgment (0 = final only).
+//   - MaxProtoDepth: maximum nesting depth of agent messages (0 = unlimited).
+//   - MaxMessageSizeBytes: maximum encoded size of agent messages (0 = unlimited).
+//   - MaxPodsPerMessage: maximum number of PodMetrics per agent message (0 = unlimited).
+//   - MaxClusterTopics: maximum number of relay-cluster-name topics (0 = unlimited).
+//   - PausedRetryAfter: retry delay suggested to agents rejected while broadcasting is paused.
+//   - ShutdownTimeout: maximum duration of the graceful shutdown before the gRPC server is stopped forcibly.
+//   - StdinMetrics: whether newline-delimited JSON Metrics read from stdin are
+//     broadcast to subscribers (local testing aid).
+//   - DumpConfigPath: file the effective configuration is written to as YAML at
+//     startup. Empty disables it.
+//   - RequireSubscriberAck: whether agent streams wait for a subscriber to receive
+//     each message before processing the next one.
+//   - SubscriberAckTimeout: maximum wait per message with RequireSubscriberAck.
+//   - MergerChannelSize: capacity of the queue through which agent streams hand
+//     their messages to a single broadcasting goroutine (0 = streams broadcast directly).
+//   - AllowAgentIDReuse: whether several SendMetrics streams may share the same agent ID.
+//   - MinSendInterval: minimum interval between two messages of a SendMetrics
+//     stream; a faster stream is closed (0 = unlimited).
+//   - MaxUnackedMessages: messages a SubscribeMetricsFlowControlled subscriber may
+//     leave unacknowledged before the relay stops sending to it (0 = unlimited).
+//   - WindowBlockTimeout: maximum wait for an acknowledgment while that window is full.
+//   - ForwardToRelay: address of a parent relay receiving every message accepted
+//     from local agents. Empty disables forwarding.
+//   - ForwardTLSCert, ForwardTLSKey: PEM client certificate and key presented to
+//     the parent relay (mutual TLS). Empty disables client authentication.
+//   - ForwardTLSCA: PEM CA certificates verifying the parent relay. Empty uses
+//     the system roots when another TLS flag is set.
 type RelayConfig struct {
-	RelayAddress string
+	RelayAddress                 string
+	TokenSigningKey              Secret
+	TokenTTL                     time.Duration
+	MetricsAddress               string
+	SSEAddress                   string
+	EnableAdmin                  bool
+	OneStreamPerIP               bool
+	SendMetricsIdleTimeout       time.Duration
+	AgentRateAlertThreshold      float64
+	AgentRateEWMAWindow          time.Duration
+	AgentLogInterval             time.Duration
+	SupportedAgentVersions       string
+	RequireSupportedAgentVersion bool
+	GRPCMaxConcurrentStreams     uint32
+	QuotaDailyMessages           int64
+	BatchSize                    int
+	BatchFlushInterval           time.Duration
+	ReplayBufferSize             int
+	BroadcastCloneMessages       bool
+	PauseBufferSize              int
+	SubscriberPersistTTL         time.Duration
+	EnforceSendOrdering          bool
+	AckInterval                  time.Duration
+	AckEveryMessages             int
+	MaxProtoDepth                int
+	MaxMessageSizeBytes          int
+	MaxPodsPerMessage            int
+	MaxClusterTopics             int
+	PausedRetryAfter             time.Duration
+	ShutdownTimeout              time.Duration
+	StdinMetrics                 bool
+	DumpConfigPath               string
+	RequireSubscriberAck         bool
+	SubscriberAckTimeout         time.Duration
+	MergerChannelSize            int
+	AllowAgentIDReuse            bool
+	MinSendInterval              time.Duration
+	MaxUnackedMessages           int
+	WindowBlockTimeout           time.Duration
+	ForwardToRelay               string
+	ForwardTLSCert               string
+	ForwardTLSKey                string
+	ForwardTLSCA                 string
+}
+
+// Secret is a string configuration value that must never appear in logs.
+//
+// It is rendered as "[redacted]" by fmt, JSON and YAML encoding, so it is safe
+// to pass a RelayConfig to golog.LogStartupInfo or to dump it.
+type Secret string
+
+// String implements fmt.Stringer.
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (s Secret) MarshalYAML() (any, error) {
+	return s.String(), nil
 }
 
 // RegisterRelayFlags registers relay-specific command-line flags into the provided FlagSet.
@@ -28,11 +157,165 @@ type RelayConfig struct {
 //
 //	--relay-address string
 //	  The address of the metrics relay gRPC server (e.g. "localhost:5000").
+//	  A named port (e.g. ":grpc") is resolved to its number through the system
+//	  services database (/etc/services).
+//	  --listen-address is an alias; if both are set, the last one on the command line wins.
 //
 // Optional flags:
 //
+//	--token-signing-key string
+//	  HMAC-SHA256 key used to sign subscriber reconnection tokens. Empty disables them.
+//
+//	--token-ttl duration
+//	  Lifetime of issued reconnection tokens (default 1h).
+//
+//	--metrics-address string
+//	  TCP address of the Prometheus /metrics HTTP endpoint (e.g. ":9090"). Empty disables it.
+//
+//	--sse-address string
+//	  TCP address of the HTTP endpoint streaming metrics as server-sent events (e.g. ":8080"). Empty disables it.
+//
+//	--enable-admin
+//	  If set, registers the AdminService on the relay gRPC server. It is unauthenticated.
+//
+//	--one-stream-per-ip
+//	  If set, rejects agent streams from an IP that already has an open agent stream.
+//
+//	--send-metrics-idle-timeout duration
+//	  Closes SendMetrics streams that receive no message for this long (default 60s, 0 = disabled).
+//
+//	--agent-rate-alert-threshold float
+//	  Logs a warning when an agent's moving average send rate exceeds this many
+//	  messages per second (default 0 = disabled).
+//
+//	--agent-rate-ewma-window duration
+//	  Averaging window of the per-agent send rate (default 10s).
+//
+//	--agent-log-interval duration
+//	  Interval of the per-agent INFO summary of received messages (default 1m, 0 = disabled).
+//
+//	--supported-agent-versions string
+//	  Semver constraints (e.g. ">=1.0.0, <2.0.0") checked against the relay-agent-version
+//	  metadata of agent streams. Unsupported versions are logged. Empty disables the check.
+//
+//	--require-supported-agent-version
+//	  If set, rejects agent streams whose version does not satisfy --supported-agent-versions.
+//
+//	--grpc-max-concurrent-streams uint
+//	  Maximum number of concurrent streams per client connection (HTTP/2
+//	  SETTINGS_MAX_CONCURRENT_STREAMS). Further streams wait for a free slot (default 250, 0 = unlimited).
+//
+//	--quota-daily-messages int
+//	  Messages each agent may send per UTC day; further messages end the stream with
+//	  RESOURCE_EXHAUSTED. Quotas reset at midnight UTC (default 0 = unlimited).
+//
+//	--batch-size int
+//	  Number of messages of a SendMetrics stream broadcast together (default 1 = no batching).
+//
+//	--batch-flush-interval duration
+//	  Maximum time a message waits for its batch to fill (default 0 = only flush when full).
+//
+//	--replay-buffer-size int
+//	  Number of recent messages replayed to every new subscriber (default 0 = disabled).
+//
+//	--broadcast-clone-messages
+//	  If set, delivers a separate copy of every message to each subscriber.
+//
+//	--pause-buffer-size int
+//	  Number of messages held while broadcasting is paused, delivered in order on
+//	  resume (default 1000, 0 = discard them).
+//
+//	--paused-retry-after duration
+//	  Retry delay, in the retry-after header, suggested to agent streams rejected while
+//	  broadcasting is paused (default 10s).
+//
+//	--subscriber-persist-ttl duration
+//	  Enables the relay-subscriber-persist-id metadata: a subscriber reconnecting within
+//	  this duration resumes after the last message delivered to it, within the replay
+//	  buffer, without duplicates (default 0 = disabled).
+//
+//	--enforce-send-ordering
+//	  If set, ends a SendMetrics stream with OUT_OF_RANGE when a message carries a non-zero
+//	  sequence_number other than the previous one of the stream plus one.
+//
+//	--ack-interval duration
+//	  Interval at which SendMetricsV2 streams receive an acknowledgment of the messages
+//	  processed so far (default 0 = final acknowledgment only).
+//
+//	--ack-every-messages int
+//	  Number of processed messages after which SendMetricsV2 streams receive an
+//	  acknowledgment (default 0 = final acknowledgment only).
+//
+//	--max-message-size-bytes int
+//	  Maximum encoded size of agent messages; larger ones end the stream with
+//	  INVALID_ARGUMENT (default 0 = unlimited).
+//
+//	--max-pods-per-message int
+//	  Maximum number of pod metrics per agent message; larger ones end the stream with
+//	  INVALID_ARGUMENT (default 0 = unlimited).
+//
+//	--max-proto-depth int
+//	  Maximum nesting depth of agent messages; deeper ones end the stream with
+//	  INVALID_ARGUMENT (default 10, 0 = unlimited).
+//
+//	--max-cluster-topics int
+//	  Maximum number of relay-cluster-name topics; streams naming a new cluster beyond it
+//	  are rejected with RESOURCE_EXHAUSTED (default 100, 0 = unlimited).
+//
+//	--min-send-interval duration
+//	  Minimum interval between two messages of a SendMetrics stream; faster streams end
+//	  with RESOURCE_EXHAUSTED (default 0 = unlimited).
+//
+//	--allow-agent-id-reuse
+//	  If set, accepts several concurrent SendMetrics streams with the same relay-agent-id,
+//	  which are otherwise rejected with ALREADY_EXISTS.
+//
+//	--require-subscriber-ack
+//	  If set, waits for a subscriber to receive each agent message before processing the
+//	  next one of the stream.
+//
+//	--subscriber-ack-timeout duration
+//	  Maximum wait for a subscriber to receive an agent message with
+//	  --require-subscriber-ack (default 5s).
+//
+//	--merger-channel-size int
+//	  Capacity of the queue through which agent streams hand their messages to a single
+//	  broadcasting goroutine (default 0 = disabled, streams broadcast directly).
+//
+//	--max-unacked-messages int
+//	  Messages a SubscribeMetricsFlowControlled subscriber may leave unacknowledged before
+//	  the relay stops sending to it (default 1000, 0 = unlimited).
+//
+//	--window-block-timeout duration
+//	  Maximum wait for a subscriber acknowledgment while its --max-unacked-messages window
+//	  is full (default 30s).
+//
+//	--forward-to-relay string
+//	  Address of a parent relay all agent metrics are forwarded to. Empty disables forwarding.
+//
+//	--forward-tls-cert string
+//	  PEM client certificate presented to the parent relay, with --forward-tls-key.
+//	  Empty presents no client certificate.
+//
+//	--forward-tls-key string
+//	  PEM private key of --forward-tls-cert.
+//
+//	--forward-tls-ca string
+//	  PEM CA certificates verifying the parent relay; setting it enables TLS to the parent
+//	  relay. Empty uses the system roots with a client certificate, plaintext otherwise.
+//
+//	--shutdown-timeout duration
+//	  Maximum duration of the graceful shutdown; open streams are then closed forcibly (default 30s).
+//
+//	--stdin-metrics
+//	  If set, reads newline-delimited JSON Metrics messages from stdin and broadcasts them.
+//
+//	--dump-config-path string
+//	  Writes the effective configuration as YAML to this file (mode 0600) at startup. Empty disables it.
+//
 //	--version
-//	  If set, prints the current agent version (as defined in pkg/buildinfo.Version) and exits.
+//	  If set, prints the current agent version (as defined in pkg/buildinfo.Version), followed
+//	  by the names of the listening address flags, and exits.
 //
 // Parameters:
 //   - fs *flag.FlagSet:
@@ -44,22 +327,255 @@ type RelayConfig struct {
 //     and returns a populated RelayConfig instance.
 func RegisterRelayFlags(fs *flag.FlagSet) func(logger *zap.Logger) *RelayConfig {
 	relayAddress := fs.String("relay-address", "", "TCP address where the relay will listen for gRPC traffic")
+	// --listen-address is a common infrastructure convention; both names share the same value
+	fs.StringVar(relayAddress, "listen-address", "", "Alias of --relay-address")
+	tokenSigningKey := fs.String("token-signing-key", "", "HMAC-SHA256 key used to sign subscriber reconnection tokens (empty = disabled)")
+	tokenTTL := fs.Duration("token-ttl", time.Hour, "Lifetime of issued subscriber reconnection tokens")
+	metricsAddress := fs.String("metrics-address", "", "TCP address of the Prometheus /metrics HTTP endpoint (empty = disabled)")
+	sseAddress := fs.String("sse-address", "", "TCP address of the server-sent events HTTP endpoint (empty = disabled)")
+	enableAdmin := fs.Bool("enable-admin", false, "Register the unauthenticated AdminService on the relay gRPC server")
+	oneStreamPerIP := fs.Bool("one-stream-per-ip", false, "Allow at most one open agent stream per agent IP")
+	sendIdleTimeout := fs.Duration("send-metrics-idle-timeout", 60*time.Second, "Close SendMetrics streams idle for this long (0 = disabled)")
+	rateThreshold := fs.Float64("agent-rate-alert-threshold", 0, "Warn when an agent sends more than this many messages per second (0 = disabled)")
+	rateWindow := fs.Duration("agent-rate-ewma-window", 10*time.Second, "Averaging window of the per-agent send rate")
+	agentLogInterval := fs.Duration("agent-log-interval", 60*time.Second, "Interval of the per-agent summary of received messages (0 = disabled)")
+	agentVersions := fs.String("supported-agent-versions", "", "Semver constraints for relay-agent-version, e.g. \">=1.0.0, <2.0.0\" (empty = unchecked)")
+	requireAgentVersion := fs.Bool("require-supported-agent-version", false, "Reject agent streams whose version is outside --supported-agent-versions")
+	maxConcurrentStreams := fs.Uint("grpc-max-concurrent-streams", 250, "Maximum concurrent gRPC streams per client connection (0 = unlimited)")
+	quotaDaily := fs.Int64("quota-daily-messages", 0, "Messages each agent may send per UTC day (0 = unlimited)")
+	batchSize := fs.Int("batch-size", 1, "Number of SendMetrics messages broadcast together (1 = no batching)")
+	batchFlushInterval := fs.Duration("batch-flush-interval", 0, "Maximum wait before a partial batch is broadcast (0 = only when full)")
+	replayBufferSize := fs.Int("replay-buffer-size", 0, "Number of recent messages replayed to new subscribers (0 = disabled)")
+	broadcastClone := fs.Bool("broadcast-clone-messages", false, "Deliver a separate copy of every message to each subscriber")
+	pauseBufferSize := fs.Int("pause-buffer-size", 1000, "Number of messages held while broadcasting is paused (0 = discard them)")
+	pausedRetryAfter := fs.Duration("paused-retry-after", 10*time.Second, "Retry delay suggested to agent streams rejected while broadcasting is paused")
+	persistTTL := fs.Duration("subscriber-persist-ttl", 0, "Retention of persistent subscriber delivery positions after disconnect (0 = disabled)")
+	enforceSendOrdering := fs.Bool("enforce-send-ordering", false, "Reject SendMetrics messages whose sequence_number is not the previous one plus one")
+	ackInterval := fs.Duration("ack-interval", 0, "Interval of SendMetricsV2 intermediate acknowledgments (0 = final only)")
+	ackEvery := fs.Int("ack-every-messages", 0, "Messages per SendMetricsV2 intermediate acknowledgment (0 = final only)")
+	maxMessageSize := fs.Int("max-message-size-bytes", 0, "Maximum encoded size of agent messages; larger ones are rejected (0 = unlimited)")
+	maxPodsPerMessage := fs.Int("max-pods-per-message", 0, "Maximum number of pod metrics per agent message; larger ones are rejected (0 = unlimited)")
+	maxClusterTopics := fs.Int("max-cluster-topics", 100, "Maximum number of relay-cluster-name topics; streams naming a new cluster beyond it are rejected (0 = unlimited)")
+	maxProtoDepth := fs.Int("max-proto-depth", 10, "Maximum nesting depth of agent messages; deeper ones are rejected (0 = unlimited)")
+	shutdownTimeout := fs.Duration("shutdown-timeout", 30*time.Second, "Maximum duration of the graceful shutdown")
+	dumpConfigPath := fs.String("dump-config-path", "", "File the effective configuration is written to as YAML at startup (empty = disabled)")
+	requireSubscriberAck := fs.Bool("require-subscriber-ack", false, "Wait for a subscriber to receive each agent message before processing the next one")
+	subscriberAckTimeout := fs.Duration("subscriber-ack-timeout", 5*time.Second, "Maximum wait for a subscriber to receive an agent message with --require-subscriber-ack")
+	mergerChannelSize := fs.Int("merger-channel-size", 0, "Capacity of the queue through which agent streams hand their messages to a single broadcasting goroutine (0 = disabled)")
+	allowAgentIDReuse := fs.Bool("allow-agent-id-reuse", false, "Accept several concurrent SendMetrics streams with the same relay-agent-id")
+	minSendInterval := fs.Duration("min-send-interval", 0, "Minimum interval between two messages of a SendMetrics stream; faster streams are closed (0 = unlimited)")
+	maxUnacked := fs.Int("max-unacked-messages", 1000, "Messages a SubscribeMetricsFlowControlled subscriber may leave unacknowledged before the relay stops sending (0 = unlimited)")
+	windowBlockTimeout := fs.Duration("window-block-timeout", 30*time.Second, "Maximum wait for a subscriber acknowledgment while its --max-unacked-messages window is full")
+	forwardToRelay := fs.String("forward-to-relay", "", "Address of a parent relay all agent metrics are forwarded to (empty = disabled)")
+	forwardTLSCert := fs.String("forward-tls-cert", "", "PEM client certificate presented to the parent relay, with --forward-tls-key (empty = no client certificate)")
+	forwardTLSKey := fs.String("forward-tls-key", "", "PEM private key of --forward-tls-cert")
+	forwardTLSCA := fs.String("forward-tls-ca", "", "PEM CA certificates verifying the parent relay; enables TLS to the parent relay (empty = system roots with a client certificate, plaintext otherwise)")
+	stdinMetrics := fs.Bool("stdin-metrics", false, "Broadcast newline-delimited JSON Metrics messages read from stdin")
 	version := fs.Bool("version", false, "Print the current version and exit")
 
 	return func(logger *zap.Logger) *RelayConfig {
 		// Handle version flag
 		if *version {
-			fmt.Printf("%s\n", buildinfo.Version)
+			printVersion(os.Stdout)
 			os.Exit(0)
 		}
 
 		if *relayAddress == "" {
 			// Fatal is appropriate here because the relay cannot start without a listening address
-			logger.Fatal("missing required flag: --relay-address")
+			logger.Fatal("missing required flag: --relay-address (or --listen-address)")
+		}
+		resolvedAddress, err := resolveNamedPort(*relayAddress)
+		if err != nil {
+			logger.Fatal("invalid flag: --relay-address", zap.String("relay_address", *relayAddress), zap.Error(err))
+		}
+
+		if *sendIdleTimeout < 0 {
+			logger.Fatal("invalid flag: --send-metrics-idle-timeout must not be negative", zap.Duration("send_metrics_idle_timeout", *sendIdleTimeout))
+		}
+
+		if *minSendInterval < 0 {
+			logger.Fatal("invalid flag: --min-send-interval must not be negative", zap.Duration("min_send_interval", *minSendInterval))
+		}
+
+		if *rateThreshold < 0 {
+			logger.Fatal("invalid flag: --agent-rate-alert-threshold must not be negative", zap.Float64("agent_rate_alert_threshold", *rateThreshold))
+		}
+
+		if *rateThreshold > 0 && *rateWindow <= 0 {
+			logger.Fatal("invalid flag: --agent-rate-ewma-window must be positive", zap.Duration("agent_rate_ewma_window", *rateWindow))
+		}
+
+		if *agentLogInterval < 0 {
+			logger.Fatal("invalid flag: --agent-log-interval must not be negative", zap.Duration("agent_log_interval", *agentLogInterval))
+		}
+
+		if *agentVersions != "" {
+			if _, err := semver.NewConstraint(*agentVersions); err != nil {
+				logger.Fatal("invalid flag: --supported-agent-versions", zap.String("supported_agent_versions", *agentVersions), zap.Error(err))
+			}
+		} else if *requireAgentVersion {
+			logger.Fatal("invalid flag: --require-supported-agent-version requires --supported-agent-versions")
+		}
+
+		if *maxConcurrentStreams > math.MaxUint32 {
+			logger.Fatal("invalid flag: --grpc-max-concurrent-streams is too large", zap.Uint("grpc_max_concurrent_streams", *maxConcurrentStreams))
+		}
+
+		if *quotaDaily < 0 {
+			logger.Fatal("invalid flag: --quota-daily-messages must not be negative", zap.Int64("quota_daily_messages", *quotaDaily))
+		}
+
+		if *batchSize < 1 {
+			logger.Fatal("invalid flag: --batch-size must be at least 1", zap.Int("batch_size", *batchSize))
+		}
+
+		if *batchFlushInterval < 0 {
+			logger.Fatal("invalid flag: --batch-flush-interval must not be negative", zap.Duration("batch_flush_interval", *batchFlushInterval))
+		}
+
+		if *replayBufferSize < 0 {
+			logger.Fatal("invalid flag: --replay-buffer-size must not be negative", zap.Int("replay_buffer_size", *replayBufferSize))
+		}
+
+		if *pauseBufferSize < 0 {
+			logger.Fatal("invalid flag: --pause-buffer-size must not be negative", zap.Int("pause_buffer_size", *pauseBufferSize))
+		}
+
+		if *persistTTL < 0 {
+			logger.Fatal("invalid flag: --subscriber-persist-ttl must not be negative", zap.Duration("subscriber_persist_ttl", *persistTTL))
+		}
+
+		if *persistTTL > 0 && *replayBufferSize == 0 {
+			logger.Warn("--subscriber-persist-ttl has no effect on replay without --replay-buffer-size")
+		}
+
+		if *ackInterval < 0 {
+			logger.Fatal("invalid flag: --ack-interval must not be negative", zap.Duration("ack_interval", *ackInterval))
+		}
+		if *ackEvery < 0 {
+			logger.Fatal("invalid flag: --ack-every-messages must not be negative", zap.Int("ack_every_messages", *ackEvery))
+		}
+		if *maxMessageSize < 0 {
+			logger.Fatal("invalid flag: --max-message-size-bytes must not be negative", zap.Int("max_message_size_bytes", *maxMessageSize))
+		}
+		if *maxPodsPerMessage < 0 {
+			logger.Fatal("invalid flag: --max-pods-per-message must not be negative", zap.Int("max_pods_per_message", *maxPodsPerMessage))
+		}
+		if *pausedRetryAfter <= 0 {
+			logger.Fatal("invalid flag: --paused-retry-after must be positive", zap.Duration("paused_retry_after", *pausedRetryAfter))
+		}
+		if *maxClusterTopics < 0 {
+			logger.Fatal("invalid flag: --max-cluster-topics must not be negative", zap.Int("max_cluster_topics", *maxClusterTopics))
+		}
+		if *maxProtoDepth < 0 {
+			logger.Fatal("invalid flag: --max-proto-depth must not be negative", zap.Int("max_proto_depth", *maxProtoDepth))
+		}
+		if *mergerChannelSize < 0 {
+			logger.Fatal("invalid flag: --merger-channel-size must not be negative", zap.Int("merger_channel_size", *mergerChannelSize))
+		}
+		if *requireSubscriberAck && *subscriberAckTimeout <= 0 {
+			logger.Fatal("invalid flag: --subscriber-ack-timeout must be positive", zap.Duration("subscriber_ack_timeout", *subscriberAckTimeout))
+		}
+		if *maxUnacked < 0 {
+			logger.Fatal("invalid flag: --max-unacked-messages must not be negative", zap.Int("max_unacked_messages", *maxUnacked))
+		}
+		if *maxUnacked > 0 && *windowBlockTimeout <= 0 {
+			logger.Fatal("invalid flag: --window-block-timeout must be positive", zap.Duration("window_block_timeout", *windowBlockTimeout))
+		}
+		if (*forwardTLSCert == "") != (*forwardTLSKey == "") {
+			logger.Fatal("invalid flag: --forward-tls-cert and --forward-tls-key must be set together")
+		}
+		if *forwardToRelay == "" && (*forwardTLSCert != "" || *forwardTLSCA != "") {
+			logger.Warn("--forward-tls-cert, --forward-tls-key and --forward-tls-ca have no effect without --forward-to-relay")
+		}
+		if *shutdownTimeout <= 0 {
+			logger.Fatal("invalid flag: --shutdown-timeout must be positive", zap.Duration("shutdown_timeout", *shutdownTimeout))
+		}
+
+		if *tokenSigningKey != "" && *tokenTTL <= 0 {
+			logger.Fatal("invalid flag: --token-ttl must be positive", zap.Duration("token_ttl", *tokenTTL))
 		}
 
 		return &RelayConfig{
-			RelayAddress: *relayAddress,
+			RelayAddress:                 resolvedAddress,
+			TokenSigningKey:              Secret(*tokenSigningKey),
+			TokenTTL:                     *tokenTTL,
+			MetricsAddress:               *metricsAddress,
+			SSEAddress:                   *sseAddress,
+			EnableAdmin:                  *enableAdmin,
+			OneStreamPerIP:               *oneStreamPerIP,
+			SendMetricsIdleTimeout:       *sendIdleTimeout,
+			AgentRateAlertThreshold:      *rateThreshold,
+			AgentRateEWMAWindow:          *rateWindow,
+			AgentLogInterval:             *agentLogInterval,
+			SupportedAgentVersions:       *agentVersions,
+			RequireSupportedAgentVersion: *requireAgentVersion,
+			GRPCMaxConcurrentStreams:     uint32(*maxConcurrentStreams),
+			QuotaDailyMessages:           *quotaDaily,
+			BatchSize:                    *batchSize,
+			BatchFlushInterval:           *batchFlushInterval,
+			ReplayBufferSize:             *replayBufferSize,
+			BroadcastCloneMessages:       *broadcastClone,
+			PauseBufferSize:              *pauseBufferSize,
+			SubscriberPersistTTL:         *persistTTL,
+			EnforceSendOrdering:          *enforceSendOrdering,
+			AckInterval:                  *ackInterval,
+			AckEveryMessages:             *ackEvery,
+			MaxProtoDepth:                *maxProtoDepth,
+			MaxMessageSizeBytes:          *maxMessageSize,
+			MaxPodsPerMessage:            *maxPodsPerMessage,
+			MaxClusterTopics:             *maxClusterTopics,
+			PausedRetryAfter:             *pausedRetryAfter,
+			ShutdownTimeout:              *shutdownTimeout,
+			StdinMetrics:                 *stdinMetrics,
+			DumpConfigPath:               *dumpConfigPath,
+			RequireSubscriberAck:         *requireSubscriberAck,
+			SubscriberAckTimeout:         *subscriberAckTimeout,
+			MergerChannelSize:            *mergerChannelSize,
+			AllowAgentIDReuse:            *allowAgentIDReuse,
+			MinSendInterval:              *minSendInterval,
+			MaxUnackedMessages:           *maxUnacked,
+			WindowBlockTimeout:           *windowBlockTimeout,
+			ForwardToRelay:               *forwardToRelay,
+			ForwardTLSCert:               *forwardTLSCert,
+			ForwardTLSKey:                *forwardTLSKey,
+			ForwardTLSCA:                 *forwardTLSCA,
 		}
 	}
 }
+
+// printVersion writes the --version output to w: the build version on the first
+// line, then the flags setting the listening address.
+func printVersion(w io.Writer) {
+	_, _ = fmt.Fprintf(w, "%s\n", buildinfo.Version)
+	_, _ = fmt.Fprintln(w, "listening address: --relay-address (alias --listen-address)")
+}
+
+// lookupPort resolves a named port; it is a variable so that tests can replace it.
+var lookupPort = net.LookupPort
+
+// resolveNamedPort replaces a named port in address (e.g. ":grpc") with its
+// number, as listed in the system services database.
+//
+// Parameters:
+//   - address: a "host:port" address.
+//
+// Returns:
+//   - string: address with a numeric port; address itself if it has no port
+//     component or its port is already numeric.
+//   - error: if the named port is not a known TCP service.
+func resolveNamedPort(address string) (string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || port == "" {
+		// Left to net.Listen, which reports malformed addresses
+		return address, nil
+	}
+	if _, err := strconv.Atoi(port); err == nil {
+		return address, nil
+	}
+	number, err := lookupPort("tcp", port)
+	if err != nil {
+		return "", fmt.Errorf("unknown service name %q: %w", port, err)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(number)), nil
+}
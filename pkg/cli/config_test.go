@@ -0,0 +1,233 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubensage/relay/pkg/buildinfo"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// parseRelayConfig is parseRelayArgs with a valid --relay-address before args.
+func parseRelayConfig(t *testing.T, args ...string) (*RelayConfig, string) {
+	t.Helper()
+	return parseRelayArgs(t, append([]string{"--relay-address=127.0.0.1:5000"}, args...)...)
+}
+
+// parseRelayArgs parses args with the flags of RegisterRelayFlags.
+//
+// Returns:
+//   - *RelayConfig: the parsed configuration (nil if it was rejected).
+//   - string: the message of the Fatal log line rejecting it ("" = accepted).
+func parseRelayArgs(t *testing.T, args ...string) (cfg *RelayConfig, fatal string) {
+	t.Helper()
+	fs := flag.NewFlagSet(t.Name(), flag.ContinueOnError)
+	load := RegisterRelayFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("parse %v: %v", args, err)
+	}
+
+	// Fatal panics instead of exiting, and the panic is turned into the message
+	core, logs := observer.New(zap.FatalLevel)
+	defer func() {
+		if recover() != nil {
+			cfg, fatal = nil, logs.All()[0].Message
+		}
+	}()
+	return load(zap.New(core, zap.WithFatalHook(zapcore.WriteThenPanic))), ""
+}
+
+func TestGRPCMaxConcurrentStreamsFlag(t *testing.T) {
+	cfg, fatal := parseRelayConfig(t)
+	if fatal != "" || cfg.GRPCMaxConcurrentStreams != 250 {
+		t.Fatalf("default: got %+v (%q), want 250", cfg, fatal)
+	}
+	cfg, fatal = parseRelayConfig(t, "--grpc-max-concurrent-streams=1000")
+	if fatal != "" || cfg.GRPCMaxConcurrentStreams != 1000 {
+		t.Fatalf("set: got %+v (%q), want 1000", cfg, fatal)
+	}
+	if _, fatal = parseRelayConfig(t, "--grpc-max-concurrent-streams=4294967296"); fatal == "" {
+		t.Fatal("a value beyond uint32 was accepted")
+	}
+}
+
+func TestListenAddressIsRelayAddressAlias(t *testing.T) {
+	cfg, fatal := parseRelayArgs(t, "--listen-address=127.0.0.1:6000")
+	if fatal != "" || cfg.RelayAddress != "127.0.0.1:6000" {
+		t.Fatalf("--listen-address: got %+v (%q), want RelayAddress 127.0.0.1:6000", cfg, fatal)
+	}
+	cfg, _ = parseRelayArgs(t, "--listen-address=127.0.0.1:6000", "--relay-address=127.0.0.1:7000")
+	if cfg.RelayAddress != "127.0.0.1:7000" {
+		t.Fatalf("both flags: got RelayAddress %s, want the last one", cfg.RelayAddress)
+	}
+	if _, fatal := parseRelayArgs(t); fatal == "" {
+		t.Fatal("a configuration without an address was accepted")
+	}
+}
+
+func TestVersionNotesBothAddressFlags(t *testing.T) {
+	var out strings.Builder
+	printVersion(&out)
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 2 || lines[0] != buildinfo.Version {
+		t.Fatalf("version output: got %q, want the version then the address flags", out.String())
+	}
+	for _, name := range []string{"--relay-address", "--listen-address"} {
+		if !strings.Contains(lines[1], name) {
+			t.Fatalf("version output: got %q, want it to name %s", lines[1], name)
+		}
+	}
+}
+
+func TestShutdownTimeoutFlag(t *testing.T) {
+	cfg, fatal := parseRelayConfig(t)
+	if fatal != "" || cfg.ShutdownTimeout != 30*time.Second {
+		t.Fatalf("default: got %+v (%q), want 30s", cfg, fatal)
+	}
+	cfg, _ = parseRelayConfig(t, "--shutdown-timeout=5s")
+	if cfg.ShutdownTimeout != 5*time.Second {
+		t.Fatalf("set: got %v, want 5s", cfg.ShutdownTimeout)
+	}
+	if _, fatal := parseRelayConfig(t, "--shutdown-timeout=0s"); fatal == "" {
+		t.Fatal("a zero shutdown timeout was accepted")
+	}
+}
+
+func TestAckFlags(t *testing.T) {
+	cfg, fatal := parseRelayConfig(t)
+	if fatal != "" || cfg.AckInterval != 0 || cfg.AckEveryMessages != 0 {
+		t.Fatalf("default: got %+v (%q), want final acknowledgments only", cfg, fatal)
+	}
+	cfg, _ = parseRelayConfig(t, "--ack-interval=2s", "--ack-every-messages=100")
+	if cfg.AckInterval != 2*time.Second || cfg.AckEveryMessages != 100 {
+		t.Fatalf("set: got %v and %d, want 2s and 100", cfg.AckInterval, cfg.AckEveryMessages)
+	}
+	if _, fatal := parseRelayConfig(t, "--ack-interval=-1s"); fatal == "" {
+		t.Fatal("a negative ack interval was accepted")
+	}
+	if _, fatal := parseRelayConfig(t, "--ack-every-messages=-1"); fatal == "" {
+		t.Fatal("a negative ack message count was accepted")
+	}
+}
+
+func TestMaxMessageSizeBytesFlag(t *testing.T) {
+	cfg, fatal := parseRelayConfig(t)
+	if fatal != "" || cfg.MaxMessageSizeBytes != 0 {
+		t.Fatalf("default: got %+v (%q), want unlimited", cfg, fatal)
+	}
+	cfg, _ = parseRelayConfig(t, "--max-message-size-bytes=1048576")
+	if cfg.MaxMessageSizeBytes != 1<<20 {
+		t.Fatalf("set: got %d, want 1048576", cfg.MaxMessageSizeBytes)
+	}
+	if _, fatal := parseRelayConfig(t, "--max-message-size-bytes=-1"); fatal == "" {
+		t.Fatal("a negative size was accepted")
+	}
+}
+
+func TestPausedRetryAfterFlag(t *testing.T) {
+	cfg, fatal := parseRelayConfig(t)
+	if fatal != "" || cfg.PausedRetryAfter != 10*time.Second {
+		t.Fatalf("default: got %+v (%q), want 10s", cfg, fatal)
+	}
+	cfg, _ = parseRelayConfig(t, "--paused-retry-after=1m")
+	if cfg.PausedRetryAfter != time.Minute {
+		t.Fatalf("set: got %v, want 1m", cfg.PausedRetryAfter)
+	}
+	if _, fatal := parseRelayConfig(t, "--paused-retry-after=0"); fatal == "" {
+		t.Fatal("a zero delay was accepted")
+	}
+}
+
+func TestMaxPodsPerMessageFlag(t *testing.T) {
+	cfg, fatal := parseRelayConfig(t)
+	if fatal != "" || cfg.MaxPodsPerMessage != 0 {
+		t.Fatalf("default: got %+v (%q), want unlimited", cfg, fatal)
+	}
+	cfg, _ = parseRelayConfig(t, "--max-pods-per-message=1000")
+	if cfg.MaxPodsPerMessage != 1000 {
+		t.Fatalf("set: got %d, want 1000", cfg.MaxPodsPerMessage)
+	}
+	if _, fatal := parseRelayConfig(t, "--max-pods-per-message=-1"); fatal == "" {
+		t.Fatal("a negative limit was accepted")
+	}
+}
+
+func TestAgentLogIntervalFlag(t *testing.T) {
+	cfg, fatal := parseRelayConfig(t)
+	if fatal != "" || cfg.AgentLogInterval != time.Minute {
+		t.Fatalf("default: got %+v (%q), want 1m", cfg, fatal)
+	}
+	cfg, _ = parseRelayConfig(t, "--agent-log-interval=0")
+	if cfg.AgentLogInterval != 0 {
+		t.Fatalf("disabled: got %v, want 0", cfg.AgentLogInterval)
+	}
+	if _, fatal := parseRelayConfig(t, "--agent-log-interval=-1s"); fatal == "" {
+		t.Fatal("a negative interval was accepted")
+	}
+}
+
+func TestMergerChannelSizeFlag(t *testing.T) {
+	cfg, fatal := parseRelayConfig(t)
+	if fatal != "" || cfg.MergerChannelSize != 0 {
+		t.Fatalf("default: got %+v (%q), want the merger disabled", cfg, fatal)
+	}
+	cfg, _ = parseRelayConfig(t, "--merger-channel-size=512")
+	if cfg.MergerChannelSize != 512 {
+		t.Fatalf("set: got %d, want 512", cfg.MergerChannelSize)
+	}
+	if _, fatal := parseRelayConfig(t, "--merger-channel-size=-1"); fatal == "" {
+		t.Fatal("a negative size was accepted")
+	}
+}
+
+func TestForwardTLSFlags(t *testing.T) {
+	cfg, fatal := parseRelayConfig(t, "--forward-to-relay=parent:5000", "--forward-tls-cert=c.pem", "--forward-tls-key=k.pem", "--forward-tls-ca=ca.pem")
+	if fatal != "" || cfg.ForwardTLSCert != "c.pem" || cfg.ForwardTLSKey != "k.pem" || cfg.ForwardTLSCA != "ca.pem" {
+		t.Fatalf("mutual TLS: got %+v (%q)", cfg, fatal)
+	}
+	if _, fatal := parseRelayConfig(t, "--forward-to-relay=parent:5000", "--forward-tls-ca=ca.pem"); fatal != "" {
+		t.Fatalf("server-only TLS was rejected: %s", fatal)
+	}
+	if _, fatal := parseRelayConfig(t, "--forward-to-relay=parent:5000", "--forward-tls-cert=c.pem"); fatal == "" {
+		t.Fatal("a certificate without its key was accepted")
+	}
+	if _, fatal := parseRelayConfig(t, "--forward-to-relay=parent:5000", "--forward-tls-key=k.pem"); fatal == "" {
+		t.Fatal("a key without its certificate was accepted")
+	}
+}
+
+func TestRelayAddressNamedPortIsResolved(t *testing.T) {
+	// Replaced so that the test does not depend on /etc/services
+	lookupPort = func(network, service string) (int, error) {
+		if network == "tcp" && service == "grpc" {
+			return 5000, nil
+		}
+		return 0, errors.New("unknown port")
+	}
+	t.Cleanup(func() { lookupPort = net.LookupPort })
+
+	for address, want := range map[string]string{
+		":grpc":          ":5000",
+		"127.0.0.1:grpc": "127.0.0.1:5000",
+		"[::1]:grpc":     "[::1]:5000",
+		"127.0.0.1:6000": "127.0.0.1:6000",
+	} {
+		cfg, fatal := parseRelayArgs(t, "--relay-address="+address)
+		if fatal != "" || cfg.RelayAddress != want {
+			t.Fatalf("%s: got %+v (%q), want RelayAddress %s", address, cfg, fatal, want)
+		}
+	}
+
+	if _, fatal := parseRelayArgs(t, "--relay-address=:nosuchservice"); fatal != "invalid flag: --relay-address" {
+		t.Fatalf("unknown service: got %q, want the invalid flag log", fatal)
+	}
+	if _, err := resolveNamedPort(":nosuchservice"); err == nil || !strings.Contains(err.Error(), `"nosuchservice"`) {
+		t.Fatalf("unknown service error: got %v, want it to name the service", err)
+	}
+}
@@ -0,0 +1,84 @@
+package codec
+
+import (
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/gzip" // Registers the gzip compressor
+)
+
+// Compressor names accepted in the relay-accept-encoding subscriber metadata.
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+func init() {
+	encoding.RegisterCompressor(newZstd())
+}
+
+// Zstd is a gRPC compressor using Zstandard. Encoders are pooled, since
+// allocating one per message would dominate the cost of small messages.
+type Zstd struct {
+	encoders sync.Pool // *zstd.Encoder
+}
+
+// newZstd creates the zstd compressor.
+func newZstd() *Zstd {
+	return &Zstd{encoders: sync.Pool{New: func() any {
+		// Without options, NewWriter cannot fail
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return enc
+	}}}
+}
+
+// Compress implements encoding.Compressor.
+func (z *Zstd) Compress(w io.Writer) (io.WriteCloser, error) {
+	enc := z.encoders.Get().(*zstd.Encoder)
+	enc.Reset(w)
+	return &zstdWriter{Encoder: enc, pool: &z.encoders}, nil
+}
+
+// Decompress implements encoding.Compressor.
+func (z *Zstd) Decompress(r io.Reader) (io.Reader, error) {
+	dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return &zstdReader{Decoder: dec}, nil
+}
+
+// Name implements encoding.Compressor.
+func (z *Zstd) Name() string {
+	return CompressionZstd
+}
+
+// zstdWriter returns its encoder to the pool once closed.
+type zstdWriter struct {
+	*zstd.Encoder
+	pool *sync.Pool
+}
+
+// Close flushes the compressed frame and releases the encoder.
+func (w *zstdWriter) Close() error {
+	err := w.Encoder.Close()
+	w.pool.Put(w.Encoder)
+	return err
+}
+
+// zstdReader releases its decoder at the end of the stream.
+type zstdReader struct {
+	*zstd.Decoder
+}
+
+// Read implements io.Reader.
+func (r *zstdReader) Read(p []byte) (int, error) {
+	n, err := r.Decoder.Read(p)
+	if err == io.EOF {
+		r.Decoder.Close()
+	}
+	return n, err
+}
@@ -0,0 +1,48 @@
+package codec
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Name is the codec name, negotiated through the application/grpc+json content type.
+const Name = "json"
+
+// JSON is a gRPC codec encoding protobuf messages with protojson.
+//
+// Once registered, gRPC selects it for every call whose content-type is
+// application/grpc+json, so any RPC (e.g., SubscribeMetrics) can be used by
+// JSON clients without changing its handler. Calls with application/grpc or
+// application/grpc+proto keep the default protobuf codec.
+type JSON struct{}
+
+func init() {
+	encoding.RegisterCodec(JSON{})
+}
+
+// Marshal implements encoding.Codec.
+func (JSON) Marshal(v any) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("json codec: cannot marshal %T: not a proto.Message", v)
+	}
+	return protojson.Marshal(msg)
+}
+
+// Unmarshal implements encoding.Codec. Unknown fields are ignored so that
+// clients built against newer schemas remain compatible.
+func (JSON) Unmarshal(data []byte, v any) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("json codec: cannot unmarshal into %T: not a proto.Message", v)
+	}
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, msg)
+}
+
+// Name implements encoding.Codec.
+func (JSON) Name() string {
+	return Name
+}
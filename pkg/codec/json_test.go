@@ -0,0 +1,39 @@
+package codec
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/kubensage/relay/proto/gen"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestJSONCodecIsRegistered(t *testing.T) {
+	if _, ok := encoding.GetCodec(Name).(JSON); !ok {
+		t.Fatalf("codec %q is not the JSON codec", Name)
+	}
+}
+
+func TestJSONCodecRoundTrip(t *testing.T) {
+	msg := &gen.Metrics{Timestamp: 42, NodeMetrics: &gen.NodeMetrics{Hostname: "node"}}
+	data, err := JSON{}.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !json.Valid(data) {
+		t.Fatalf("encoded message is not JSON: %s", data)
+	}
+
+	got := &gen.Metrics{}
+	if err := (JSON{}).Unmarshal([]byte(`{"timestamp":"42","nodeMetrics":{"hostname":"node"},"futureField":1}`), got); err != nil {
+		t.Fatalf("unmarshal with an unknown field: %v", err)
+	}
+	if !proto.Equal(got, msg) {
+		t.Fatalf("decoded message: got %v, want %v", got, msg)
+	}
+
+	if _, err := (JSON{}).Marshal("not a message"); err == nil {
+		t.Fatal("marshaling a non-proto value succeeded")
+	}
+}
@@ -0,0 +1,191 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/kubensage/relay/proto/gen"
+	"github.com/kubensage/relay/proto/gen/admin"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// AdminServer implements the gRPC AdminServiceServer interface.
+//
+// It exposes operational endpoints on top of a MetricsServer and carries no
+// authentication of its own; it should only be enabled on trusted networks.
+type AdminServer struct {
+	admin.UnimplementedAdminServiceServer
+	metricsServer *MetricsServer // Server whose state is inspected and controlled
+	logger        *zap.Logger    // Structured logger for observability
+}
+
+// NewAdminServer creates a new AdminServer.
+//
+// Parameters:
+//   - metricsServer: the MetricsServer to administer.
+//   - logger: zap.Logger for structured logging.
+//
+// Returns:
+//   - *AdminServer: initialized server ready to be registered with gRPC.
+func NewAdminServer(metricsServer *MetricsServer, logger *zap.Logger) *AdminServer {
+	return &AdminServer{
+		metricsServer: metricsServer,
+		logger:        logger,
+	}
+}
+
+// SendAgentControl enqueues a control command for a connected agent.
+//
+// Parameters:
+//   - _ (context.Context): unused request context.
+//   - req: target agent ID, command and optional metric groups.
+//
+// Returns:
+//   - *emptypb.Empty: on success.
+//   - error: codes.InvalidArgument for an unspecified command, codes.NotFound if the
+//     agent has no control stream, codes.ResourceExhausted if its queue is full.
+func (a *AdminServer) SendAgentControl(_ context.Context, req *admin.SendAgentControlRequest) (*emptypb.Empty, error) {
+	var cmd gen.ControlCommand
+	switch req.GetCommand() {
+	case admin.AgentCommand_PAUSE:
+		cmd = gen.ControlCommand_PAUSE
+	case admin.AgentCommand_RESUME:
+		cmd = gen.ControlCommand_RESUME
+	case admin.AgentCommand_FILTER_UPDATE:
+		cmd = gen.ControlCommand_FILTER_UPDATE
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unsupported command: %s", req.GetCommand())
+	}
+
+	err := a.metricsServer.SendAgentControl(req.GetAgentId(), &gen.ControlMessage{
+		Command:      cmd,
+		MetricGroups: req.GetMetricGroups(),
+	})
+	switch {
+	case errors.Is(err, ErrAgentNotFound):
+		return nil, status.Errorf(codes.NotFound, "agent %s not found", req.GetAgentId())
+	case errors.Is(err, ErrControlQueueFull):
+		return nil, status.Errorf(codes.ResourceExhausted, "control queue of agent %s is full", req.GetAgentId())
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	a.logger.Info("queued agent control command",
+		zap.String("agent_id", req.GetAgentId()),
+		zap.Stringer("command", cmd),
+	)
+	return &emptypb.Empty{}, nil
+}
+
+// DisconnectSubscriber ends the stream of a connected subscriber (see
+// MetricsServer.DisconnectSubscriber).
+//
+// Parameters:
+//   - _ (context.Context): unused request context.
+//   - req: ID of the subscriber to disconnect.
+//
+// Returns:
+//   - *emptypb.Empty: on success.
+//   - error: codes.NotFound if no subscriber stream has the ID; other failures
+//     keep their gRPC status, or are reported as codes.Internal.
+func (a *AdminServer) DisconnectSubscriber(_ context.Context, req *admin.DisconnectRequest) (*emptypb.Empty, error) {
+	err := a.metricsServer.DisconnectSubscriber(req.GetSubscriberId())
+	switch {
+	case errors.Is(err, ErrSubscriberNotFound):
+		return nil, status.Errorf(codes.NotFound, "subscriber %s not found", req.GetSubscriberId())
+	case err != nil:
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	a.logger.Info("disconnected subscriber", zap.String("subscriber_id", req.GetSubscriberId()))
+	return &emptypb.Empty{}, nil
+}
+
+// GetBroadcasterStatus returns the broadcaster telemetry along with the number
+// of active agents and the registered subscribers. The counters describe the
+// default topic broadcaster; the subscribers of every topic are listed.
+//
+// Parameters:
+//   - _ (context.Context): unused request context.
+//   - _ (*emptypb.Empty): unused request.
+//
+// Returns:
+//   - *admin.BroadcasterStatus: the status snapshot.
+//   - error: always nil.
+func (a *AdminServer) GetBroadcasterStatus(_ context.Context, _ *emptypb.Empty) (*admin.BroadcasterStatus, error) {
+	b := a.metricsServer.broadcaster
+	stats := b.Stats()
+
+	var subscribers []*admin.SubscriberStatus
+	a.metricsServer.forEachTopic(func(name string, t *topic) {
+		tb := t.broadcaster
+		tb.ForEach(func(id string, _ chan *gen.Metrics) {
+			sub := &admin.SubscriberStatus{Id: id, Topic: name}
+			// The channel is nil for ring buffer subscribers
+			if n, ok := tb.QueueLen(id); ok {
+				sub.QueueLength = uint32(n)
+			}
+			if at, ok := tb.RegisteredSince(id); ok {
+				sub.RegisteredAt = timestamppb.New(at)
+			}
+			if info, ok := a.metricsServer.Subscriber(id); ok {
+				sub.Name = info.Name
+			}
+			subscribers = append(subscribers, sub)
+		})
+	})
+
+	return &admin.BroadcasterStatus{
+		SubscriberCount:   uint32(stats.SubscriberCount),
+		TotalBroadcasts:   stats.TotalBroadcasts,
+		TotalDropped:      stats.TotalDropped,
+		TotalDeduplicated: stats.TotalDeduplicated,
+		TotalFiltered:     stats.TotalFiltered,
+		SequenceNumber:    stats.SequenceNumber,
+		ActiveAgents:      uint32(a.metricsServer.ActiveAgentCount()),
+		Subscribers:       subscribers,
+	}, nil
+}
+
+// GetBroadcasterMetrics returns the counters of the default topic broadcaster
+// (see Broadcaster.Metrics).
+//
+// Parameters:
+//   - _ (context.Context): unused request context.
+//   - _ (*emptypb.Empty): unused request.
+//
+// Returns:
+//   - *admin.BroadcasterMetrics: the counter snapshot.
+//   - error: always nil.
+func (a *AdminServer) GetBroadcasterMetrics(_ context.Context, _ *emptypb.Empty) (*admin.BroadcasterMetrics, error) {
+	return a.metricsServer.broadcaster.Metrics(), nil
+}
+
+// ListAgents returns the agents with an open agent stream (see MetricsServer.Agents).
+//
+// Parameters:
+//   - _ (context.Context): unused request context.
+//   - _ (*emptypb.Empty): unused request.
+//
+// Returns:
+//   - *admin.AgentList: the connected agents, oldest connection first.
+//   - error: always nil.
+func (a *AdminServer) ListAgents(_ context.Context, _ *emptypb.Empty) (*admin.AgentList, error) {
+	agents := a.metricsServer.Agents()
+	list := &admin.AgentList{Agents: make([]*admin.AgentInfo, 0, len(agents))}
+	for _, agent := range agents {
+		list.Agents = append(list.Agents, &admin.AgentInfo{
+			AgentId:      agent.ID,
+			PeerAddr:     agent.PeerAddr,
+			ConnectedAt:  timestamppb.New(agent.ConnectedAt),
+			MessagesSent: agent.MessagesSent,
+		})
+	}
+	return list, nil
+}
@@ -0,0 +1,154 @@
+package grpc
+
+import (
+	"testing"
+
+	"github.com/kubensage/relay/pkg/ringbuf"
+	"github.com/kubensage/relay/proto/gen"
+	"github.com/kubensage/relay/proto/gen/admin"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// startTestAdmin serves an AdminServer for ms over an in-memory connection
+// until the test ends and returns a client connected to it.
+func startTestAdmin(t testing.TB, ms *MetricsServer) admin.AdminServiceClient {
+	t.Helper()
+	return admin.NewAdminServiceClient(serveTest(t, func(srv *grpc.Server) {
+		admin.RegisterAdminServiceServer(srv, NewAdminServer(ms, zap.NewNop()))
+	}))
+}
+
+func TestBroadcasterStatusReportsRingQueueLengthAndTopics(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	_, ms := startTestServer(t, b)
+	client := startTestAdmin(t, ms)
+
+	ring := ringbuf.New[*gen.Metrics](4)
+	if _, err := b.RegisterRing("ring", ring, 0); err != nil {
+		t.Fatal(err)
+	}
+	east, err := ms.topicFor("east")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := east.broadcaster.Register("east-sub", make(chan *gen.Metrics, 4)); err != nil {
+		t.Fatal(err)
+	}
+	b.Broadcast(&gen.Metrics{})
+	b.Broadcast(&gen.Metrics{})
+	east.broadcaster.Broadcast(&gen.Metrics{})
+
+	st, err := client.GetBroadcasterStatus(t.Context(), &emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]*admin.SubscriberStatus{}
+	for _, sub := range st.GetSubscribers() {
+		got[sub.GetId()] = sub
+	}
+	if sub := got["ring"]; sub == nil || sub.GetQueueLength() != 2 || sub.GetTopic() != defaultTopic {
+		t.Fatalf("ring subscriber: got %v, want 2 queued on %s", sub, defaultTopic)
+	}
+	if sub := got["east-sub"]; sub == nil || sub.GetQueueLength() != 1 || sub.GetTopic() != "east" {
+		t.Fatalf("east subscriber: got %v, want 1 queued on east", sub)
+	}
+}
+
+func TestDisconnectSubscriberEndsItsStream(t *testing.T) {
+	client, ms := startTestServer(t, newTestBroadcaster(t, nil))
+	adminClient := startTestAdmin(t, ms)
+
+	stream, err := client.SubscribeMetrics(t.Context(), &emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := stream.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := header.Get(subscriberIDKey)[0]
+
+	if _, err := adminClient.DisconnectSubscriber(t.Context(), &admin.DisconnectRequest{SubscriberId: id}); err != nil {
+		t.Fatalf("DisconnectSubscriber: %v", err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.Canceled {
+		t.Fatalf("disconnected stream: got %v, want Canceled", err)
+	}
+
+	_, err = adminClient.DisconnectSubscriber(t.Context(), &admin.DisconnectRequest{SubscriberId: "unknown"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("unknown subscriber: got %v, want NotFound", err)
+	}
+}
+
+func TestListAgentsReturnsConnectedAgents(t *testing.T) {
+	client, ms := startTestServer(t, newTestBroadcaster(t, nil))
+	admClient := startTestAdmin(t, ms)
+
+	// list returns the listed agents by ID
+	list := func() map[string]*admin.AgentInfo {
+		t.Helper()
+		agents, err := admClient.ListAgents(t.Context(), &emptypb.Empty{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]*admin.AgentInfo{}
+		for _, a := range agents.GetAgents() {
+			got[a.GetAgentId()] = a
+		}
+		return got
+	}
+
+	streams := map[string]gen.MetricsService_SendMetricsClient{}
+	for id, messages := range map[string]int{"agent-a": 2, "agent-b": 1} {
+		stream, err := client.SendMetrics(withMetadata(t, agentIDKey, id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for range messages {
+			if err := stream.Send(hostMetrics(id)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		streams[id] = stream
+	}
+	waitFor(t, "the agent messages to be counted", func() bool {
+		got := list()
+		return got["agent-a"].GetMessagesSent() == 2 && got["agent-b"].GetMessagesSent() == 1
+	})
+	for id, a := range list() {
+		if a.GetPeerAddr() == "" || a.GetConnectedAt() == nil {
+			t.Fatalf("agent %s: got %v, want its peer address and connection time", id, a)
+		}
+	}
+	if n := len(list()); n != 2 {
+		t.Fatalf("listed agents: got %d, want 2", n)
+	}
+
+	if _, err := streams["agent-a"].CloseAndRecv(); err != nil {
+		t.Fatal(err)
+	}
+	got := list()
+	if _, ok := got["agent-a"]; ok || len(got) != 1 {
+		t.Fatalf("after agent-a disconnected: got %v, want agent-b only", got)
+	}
+}
+
+func TestGetBroadcasterMetricsServesDefaultTopic(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	_, ms := startTestServer(t, b)
+	client := startTestAdmin(t, ms)
+	b.Broadcast(hostMetrics("node"))
+
+	got, err := client.GetBroadcasterMetrics(t.Context(), &emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.GetTotalBroadcasts() != 1 || got.GetSequenceNumber() != 1 || got.GetLastBroadcastAt() == nil {
+		t.Fatalf("broadcaster metrics: got %v, want one broadcast", got)
+	}
+}
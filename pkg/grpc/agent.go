@@ -0,0 +1,58 @@
+package grpc
+
+import (
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// AgentInfo describes a connected agent stream (SendMetrics, SendMetricsV2 or
+// AgentControl).
+//
+// Fields:
+//   - ID: agent ID from the relay-agent-id metadata, or a generated UUID if absent.
+//   - PeerAddr: remote address of the agent ("unknown" if unavailable).
+//   - ConnectedAt: time the stream was opened.
+//   - MessagesSent: number of Metrics messages received on the stream so far.
+type AgentInfo struct {
+	ID           string
+	PeerAddr     string
+	ConnectedAt  time.Time
+	MessagesSent uint64
+}
+
+// agentConn is the live state of a connected agent stream, from which
+// AgentInfo snapshots are taken.
+type agentConn struct {
+	id          string
+	peerAddr    string
+	connectedAt time.Time
+	messages    atomic.Uint64 // Messages received on the stream
+}
+
+// info returns a snapshot of the connection.
+func (c *agentConn) info() AgentInfo {
+	return AgentInfo{
+		ID:           c.id,
+		PeerAddr:     c.peerAddr,
+		ConnectedAt:  c.connectedAt,
+		MessagesSent: c.messages.Load(),
+	}
+}
+
+// Agents returns the connected agent streams, oldest first. When several open
+// streams share an agent ID, only the most recently opened one is listed.
+//
+// Returns:
+//   - []AgentInfo: a snapshot of the connected agents.
+func (s *MetricsServer) Agents() []AgentInfo {
+	var agents []AgentInfo
+	s.agentConns.Range(func(_, v any) bool {
+		agents = append(agents, v.(*agentConn).info())
+		return true
+	})
+	slices.SortFunc(agents, func(a, b AgentInfo) int {
+		return a.ConnectedAt.Compare(b.ConnectedAt)
+	})
+	return agents
+}
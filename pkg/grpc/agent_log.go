@@ -0,0 +1,48 @@
+package grpc
+
+import (
+	"github.com/kubensage/relay/proto/gen"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+// agentIntervalStats accumulates what an agent stream received since its last
+// periodic summary (WithAgentLogInterval). It is not safe for concurrent use.
+type agentIntervalStats struct {
+	hostname string              // Hostname of the last received message
+	messages uint64              // Messages received
+	bytes    uint64              // Encoded size of the received messages
+	pods     map[string]struct{} // Distinct pods (namespace/name) seen
+}
+
+// newAgentIntervalStats creates empty stats for a stream.
+func newAgentIntervalStats() *agentIntervalStats {
+	return &agentIntervalStats{pods: make(map[string]struct{})}
+}
+
+// record accounts for a received message.
+func (a *agentIntervalStats) record(req *gen.Metrics) {
+	a.hostname = req.GetNodeMetrics().GetHostname()
+	a.messages++
+	a.bytes += uint64(proto.Size(req))
+	for _, pod := range req.GetPodMetrics() {
+		a.pods[pod.GetNamespace()+"/"+pod.GetName()] = struct{}{}
+	}
+}
+
+// logAndReset logs the summary of the interval at INFO level and resets the
+// counters for the next one.
+//
+// Parameters:
+//   - logger: the stream's child logger, carrying the agent_id.
+func (a *agentIntervalStats) logAndReset(logger *zap.Logger) {
+	logger.Info("agent stream summary",
+		zap.String("hostname", a.hostname),
+		zap.Uint64("messages_last_interval", a.messages),
+		zap.Uint64("bytes_last_interval", a.bytes),
+		zap.Int("unique_pods", len(a.pods)),
+	)
+	a.messages = 0
+	a.bytes = 0
+	clear(a.pods)
+}
@@ -0,0 +1,78 @@
+package grpc
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kubensage/relay/proto/gen"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestAgentIntervalStatsSummarizesAndResets(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	logger := zap.New(core).With(zap.String("agent_id", "agent-1"))
+	stats := newAgentIntervalStats()
+
+	// Ticks of the summary interval are simulated by calling logAndReset
+	var size uint64
+	for i := range 100 {
+		msg := hostMetrics("node")
+		msg.PodMetrics = []*gen.PodMetrics{{Namespace: "default", Name: fmt.Sprintf("pod-%d", i%10)}}
+		size += uint64(proto.Size(msg))
+		stats.record(msg)
+	}
+	stats.logAndReset(logger)
+	stats.logAndReset(logger)
+
+	summaries := logs.FilterMessage("agent stream summary").All()
+	if len(summaries) != 2 {
+		t.Fatalf("summaries: got %d, want 2", len(summaries))
+	}
+	for i, want := range []struct {
+		messages, bytes uint64
+		pods            int64
+	}{{100, size, 10}, {0, 0, 0}} {
+		fields := summaries[i].ContextMap()
+		if fields["agent_id"] != "agent-1" || fields["hostname"] != "node" || fields["messages_last_interval"] != want.messages ||
+			fields["bytes_last_interval"] != want.bytes || fields["unique_pods"] != want.pods {
+			t.Errorf("summary %d: got %v, want agent-1 on node with %+v", i, fields, want)
+		}
+	}
+}
+
+func TestSendMetricsLogsAgentSummaries(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	client, ms := startLoggedTestServer(t, zap.New(core), newTestBroadcaster(t, nil), WithAgentLogInterval(10*time.Millisecond))
+
+	// Without relay-agent-id, the summaries report the generated ID the
+	// stream is tracked with
+	stream, err := client.SendMetrics(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 100 {
+		if err := stream.Send(hostMetrics("node")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "the agent stream to be tracked", func() bool { return len(ms.Agents()) == 1 })
+	agentID := ms.Agents()[0].ID
+
+	// The messages may span several intervals
+	counted := func() (n uint64) {
+		for _, entry := range logs.FilterMessage("agent stream summary").All() {
+			if fields := entry.ContextMap(); fields["agent_id"] != agentID || fields["hostname"] != "node" {
+				t.Fatalf("summary identity: got %v and %v, want %s and node", fields["agent_id"], fields["hostname"], agentID)
+			}
+			n += entry.ContextMap()["messages_last_interval"].(uint64)
+		}
+		return n
+	}
+	waitFor(t, "summaries of the 100 messages", func() bool { return counted() == 100 })
+	if _, err := stream.CloseAndRecv(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,53 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/Masterminds/semver/v3"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// agentVersionKey is the metadata key carrying the optional agent version.
+const agentVersionKey = "relay-agent-version"
+
+// checkAgentVersion compares the relay-agent-version metadata of an agent
+// stream against the constraints set with WithSupportedAgentVersions.
+//
+// Behavior:
+//   - Streams without constraints configured or without version metadata pass.
+//   - A version that cannot be parsed or does not satisfy the constraints is
+//     logged as a warning, and rejected only when the option requires it.
+//
+// Parameters:
+//   - ctx: stream context carrying the incoming metadata.
+//   - logger: the stream's child logger.
+//
+// Returns:
+//   - error: codes.FailedPrecondition if the version is unsupported and required.
+func (s *MetricsServer) checkAgentVersion(ctx context.Context, logger *zap.Logger) error {
+	if s.cfg.agentVersions == nil {
+		return nil
+	}
+	values := metadata.ValueFromIncomingContext(ctx, agentVersionKey)
+	if len(values) == 0 {
+		return nil
+	}
+
+	raw := values[0]
+	v, err := semver.NewVersion(raw)
+	if err == nil && s.cfg.agentVersions.Check(v) {
+		return nil
+	}
+
+	logger.Warn("agent version outside supported range",
+		zap.String("agent_version", raw),
+		zap.Stringer("supported_agent_versions", s.cfg.agentVersions),
+	)
+	if s.cfg.requireAgentVersion {
+		return status.Errorf(codes.FailedPrecondition, "unsupported agent version %q (supported: %s)", raw, s.cfg.agentVersions)
+	}
+	return nil
+}
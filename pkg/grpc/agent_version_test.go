@@ -0,0 +1,51 @@
+package grpc
+
+import (
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestCheckAgentVersion(t *testing.T) {
+	constraints, err := semver.NewConstraint(">=1.0.0, <2.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		version string // "" = no metadata
+		require bool
+		warned  bool
+		code    codes.Code
+	}{
+		{name: "supported", version: "1.5.0"},
+		{name: "no version", require: true},
+		{name: "unsupported", version: "2.1.0", warned: true},
+		{name: "unparsable", version: "latest", warned: true},
+		{name: "unsupported and required", version: "2.1.0", require: true, warned: true, code: codes.FailedPrecondition},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zap.WarnLevel)
+			s := NewMetricsServer(zap.New(core), newTestBroadcaster(t, nil), WithSupportedAgentVersions(constraints, tt.require))
+			ctx := t.Context()
+			if tt.version != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(agentVersionKey, tt.version))
+			}
+
+			err := s.checkAgentVersion(ctx, s.logger)
+			if status.Code(err) != tt.code {
+				t.Fatalf("error: got %v, want code %s", err, tt.code)
+			}
+			if warned := logs.Len() > 0; warned != tt.warned {
+				t.Fatalf("warning logged: got %v, want %v", warned, tt.warned)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package grpc
+
+import (
+	"time"
+
+	"github.com/kubensage/relay/proto/gen"
+)
+
+// batchSubscriberStream adapts a SubscribeMetricsBatch stream to
+// subscriberStream: Send queues messages in a batcher, which sends them as one
+// MetricsBatch when full or due. Like the batcher, it is not safe for
+// concurrent use.
+type batchSubscriberStream struct {
+	gen.MetricsService_SubscribeMetricsBatchServer
+	batch *batcher // Pending messages
+	err   error    // First error returned by the underlying Send
+}
+
+// newBatchSubscriberStream wraps stream with a batcher of the given size and flush interval.
+func newBatchSubscriberStream(stream gen.MetricsService_SubscribeMetricsBatchServer, size int, interval time.Duration) *batchSubscriberStream {
+	s := &batchSubscriberStream{MetricsService_SubscribeMetricsBatchServer: stream}
+	s.batch = newBatcher(size, interval, func(msgs []*gen.Metrics) {
+		if s.err == nil {
+			s.err = stream.Send(&gen.MetricsBatch{Messages: msgs})
+		}
+	})
+	return s
+}
+
+// Send queues msg, sending the batch if it is full.
+//
+// Returns:
+//   - error: the error of a failed batch send, if any; once a send fails, every call returns it.
+func (s *batchSubscriberStream) Send(msg *gen.Metrics) error {
+	s.batch.add(msg)
+	return s.err
+}
+
+// flush sends the pending messages, if any.
+//
+// Returns:
+//   - error: as in Send.
+func (s *batchSubscriberStream) flush() error {
+	s.batch.flush()
+	return s.err
+}
+
+// batcher accumulates the messages of a single agent stream and hands them
+// over as one batch once size messages are pending, or interval after the
+// first pending message. It is not safe for concurrent use.
+type batcher struct {
+	size     int                  // Number of messages that triggers a flush
+	interval time.Duration        // Maximum age of the oldest pending message (0 = no timed flush)
+	flushFn  func([]*gen.Metrics) // Receives every flushed batch
+	pending  []*gen.Metrics       // Messages waiting for the next flush
+	timer    *time.Timer          // Timed flush, created on first use
+	timerC   <-chan time.Time     // timer.C while a timed flush is pending, nil otherwise
+}
+
+// newBatcher creates a batcher calling flushFn with every flushed batch.
+func newBatcher(size int, interval time.Duration, flushFn func([]*gen.Metrics)) *batcher {
+	return &batcher{size: size, interval: interval, flushFn: flushFn}
+}
+
+// add queues msg and flushes the batch if it is full.
+func (b *batcher) add(msg *gen.Metrics) {
+	b.pending = append(b.pending, msg)
+	if len(b.pending) >= b.size {
+		b.flush()
+		return
+	}
+
+	if len(b.pending) == 1 && b.interval > 0 {
+		if b.timer == nil {
+			b.timer = time.NewTimer(b.interval)
+		} else {
+			// Since Go 1.23, Reset discards any pending expiry; no drain is needed
+			b.timer.Reset(b.interval)
+		}
+		b.timerC = b.timer.C
+	}
+}
+
+// C returns a channel that fires when the pending batch is due for a timed
+// flush, or nil if no timed flush is pending.
+func (b *batcher) C() <-chan time.Time {
+	return b.timerC
+}
+
+// flush hands the pending messages to flushFn, if any.
+func (b *batcher) flush() {
+	b.timerC = nil
+	if len(b.pending) == 0 {
+		return
+	}
+	batch := b.pending
+	b.pending = nil
+	b.flushFn(batch)
+}
+
+// stop flushes the pending messages and releases the timer.
+func (b *batcher) stop() {
+	b.flush()
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+}
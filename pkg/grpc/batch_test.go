@@ -0,0 +1,70 @@
+package grpc
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/kubensage/relay/proto/gen"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestSendMetricsBatchesBroadcasts(t *testing.T) {
+	var broadcasts, delivered atomic.Int64
+	b := newTestBroadcaster(t, nil, WithBroadcastCallback(func(sent, _ int) {
+		broadcasts.Add(1)
+		delivered.Add(int64(sent))
+	}))
+	client, _ := startTestServer(t, b, WithBatching(5, 0))
+	ch := make(chan *gen.Metrics, 10)
+	if _, err := b.Register("sub", ch); err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := client.SendMetrics(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 5 {
+		if err := stream.Send(hostMetrics(fmt.Sprintf("node-%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range 5 {
+		if got, want := receive(t, ch).GetNodeMetrics().GetHostname(), fmt.Sprintf("node-%d", i); got != want {
+			t.Fatalf("message %d: got host %q, want %q", i, got, want)
+		}
+	}
+	if n, sent := broadcasts.Load(), delivered.Load(); n != 1 || sent != 5 {
+		t.Fatalf("fan-outs: got %d delivering %d messages, want one batch of 5", n, sent)
+	}
+	if _, err := stream.CloseAndRecv(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubscribeMetricsBatchGroupsMessages(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	client, _ := startTestServer(t, b)
+
+	stream, err := client.SubscribeMetricsBatch(withMetadata(t, subscriberBatchSizeKey, "5", subscriberBatchFlushKey, "20"), &emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Header(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range 7 {
+		b.Broadcast(hostMetrics(fmt.Sprintf("node-%d", i)))
+	}
+	for _, want := range []int{5, 2} {
+		batch, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := len(batch.GetMessages()); n != want {
+			t.Fatalf("batch size: got %d, want %d", n, want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package grpc
+
+import (
+	"slices"
+
+	"github.com/kubensage/relay/proto/gen"
+	"go.uber.org/zap"
+)
+
+// inGroup reports whether the subscriber is tagged with group.
+func (s *subscriber) inGroup(group string) bool {
+	return slices.Contains(s.groups, group)
+}
+
+// BroadcastToGroup delivers msg only to the subscribers tagged with groupID at
+// registration (see WithGroups), e.g. a "debug" group, as Broadcast does for
+// every subscriber. Every subscriber of the group receives the message, unlike
+// the members of a GroupBroadcaster consumer group.
+//
+// Behavior:
+//   - The filter, transformer and deduplication apply as in Broadcast.
+//   - The message is not recorded in the replay buffer, so that subscribers
+//     outside the group never receive it, and is not forwarded to the webhook.
+//   - While paused by PauseAll, the message is discarded: the pause buffer is
+//     replayed to every subscriber.
+//   - An empty groupID matches no subscriber.
+//
+// Parameters:
+//   - groupID: the group ID of the receiving subscribers.
+//   - msg: Metrics message to broadcast.
+//
+// Returns:
+//   - sent, dropped: as in Broadcast, over the subscribers of the group.
+func (b *Broadcaster) BroadcastToGroup(groupID string, msg *gen.Metrics) (sent int, dropped int) {
+	if groupID == "" {
+		return 0, 0
+	}
+	if b.paused.Load() {
+		b.logger.Debug("discarding group metrics: broadcaster paused", zap.String("group", groupID))
+		return 0, 0
+	}
+	inGroup := func(_ string, sub *subscriber) bool {
+		return sub.inGroup(groupID)
+	}
+	_, sent, dropped = b.broadcastNow(b.ctx, []*gen.Metrics{msg}, false, inGroup)
+	return sent, dropped
+}
+
+// BroadcastIf delivers msg only to the subscribers whose ID pred accepts, as
+// Broadcast does for every subscriber, for decisions that depend on the state
+// at broadcast time rather than at registration (see WithGroups).
+//
+// Behavior:
+//   - pred is evaluated once per registered subscriber, before the send
+//     attempt, on the calling goroutine and while the fan-out holds its lock:
+//     it must be fast and must not call back into the Broadcaster.
+//   - Subscribers pred rejects are skipped: the message is neither sent to
+//     them nor counted as dropped.
+//   - As with BroadcastToGroup, the message is not recorded in the replay
+//     buffer nor forwarded to the webhook, and is discarded while paused.
+//
+// Parameters:
+//   - msg: Metrics message to broadcast.
+//   - pred: reports whether the subscriber with the given ID receives msg.
+//
+// Returns:
+//   - sent, dropped: as in Broadcast, over the subscribers pred accepted.
+func (b *Broadcaster) BroadcastIf(msg *gen.Metrics, pred func(id string) bool) (sent int, dropped int) {
+	if b.paused.Load() {
+		b.logger.Debug("discarding conditional metrics: broadcaster paused")
+		return 0, 0
+	}
+	accepted := func(id string, _ *subscriber) bool {
+		return pred(id)
+	}
+	_, sent, dropped = b.broadcastNow(b.ctx, []*gen.Metrics{msg}, false, accepted)
+	return sent, dropped
+}
@@ -1,10 +1,49 @@
 package grpc
 
 import (
+	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/kubensage/common/datastructure"
+	"github.com/kubensage/relay/pkg/metrics"
+	"github.com/kubensage/relay/pkg/ringbuf"
 	"github.com/kubensage/relay/proto/gen"
+	"github.com/kubensage/relay/proto/gen/admin"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// onDropConcurrency is the maximum number of WithOnDrop hooks running at once.
+const onDropConcurrency = 100
+
+// closedChan is a closed channel, returned by leavingChan for subscribers already leaving.
+var closedChan = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// defaultSubscriberChannelSize is the channel capacity of subscribers created
+// by Subscribe without WithChannelSize.
+const defaultSubscriberChannelSize = 100
+
+// ErrSubscriberCapReached is returned by Register when the subscriber cap set
+// with WithSubscriberCap is reached.
+var ErrSubscriberCapReached = errors.New("subscriber cap reached")
+
+var (
+	// ErrSubscriberNotFound is returned by Rename when the subscriber to rename is not
+	// registered, and by MetricsServer.DisconnectSubscriber when no subscriber stream has the ID.
+	ErrSubscriberNotFound = errors.New("subscriber not found")
+	// ErrSubscriberAlreadyExists is returned by Rename when the new ID is already
+	// registered, and by exclusive registrations of a registered ID.
+	ErrSubscriberAlreadyExists = errors.New("subscriber already exists")
 )
 
 // Broadcaster manages a set of subscribers and allows broadcasting
@@ -12,78 +51,1708 @@ import (
 //
 // Each subscriber is identified by an ID and associated with a channel.
 // Broadcasts are non-blocking: if a subscriber's channel is full, the
-// message is dropped to avoid stalling other subscribers.
+// message is handled according to the configured SlowSubscriberPolicy
+// (dropped by default) to avoid stalling other subscribers. BroadcastLossless
+// and WithLosslessSend opt into blocking sends instead.
+//
+// The subscriber map is copy-on-write: writers copy it, modify the copy and
+// publish it atomically, so broadcasts iterate a snapshot without blocking
+// Register and Unregister.
 type Broadcaster struct {
-	subscribersMu sync.RWMutex                 // Protects concurrent access to subscribers
-	subscribers   map[string]chan *gen.Metrics // Map of subscriber ID to metrics channel
-	logger        *zap.Logger                  // Logger for observability
+	subscribersMu  sync.Mutex      // Serializes subscriber map updates and protects countNotifiers and countChanged
+	subscribers    atomic.Value    // Immutable map[string]*subscriber snapshot, replaced on every change
+	closeMu        sync.RWMutex    // Held for reading by fan-outs, for writing while closing subscriber channels
+	countNotifiers []countNotifier // Registered through NotifyOnSubscriberCount
+	countChanged   chan struct{}   // Closed and replaced on every subscriber map update (WaitForSubscribers)
+	logger         *zap.Logger     // Logger for observability
+
+	ctx  context.Context   // Bounds the lifetime of background workers
+	cfg  broadcasterConfig // Optional behavior set through BroadcasterOption
+	jobs chan workItem     // Fan-out work queue (nil when no worker pool is configured)
+
+	metrics *metrics.BroadcasterMetrics // Prometheus collectors (WithMetrics)
+	topic   string                      // topic label of the per-subscriber series, shared with sibling Broadcasters
+	webhook *webhookForwarder           // Posts broadcast messages to a webhook (nil when disabled)
+
+	leavingMu sync.Mutex               // Protects leaving; never held while acquiring another lock
+	leaving   map[string]chan struct{} // Closed when a subscriber starts unregistering (unblocks lossless sends)
+
+	replayMu sync.Mutex    // Protects replay
+	replay   []replayEntry // Most recent messages, oldest first
+
+	dedupMu   sync.Mutex             // Protects dedupSeen
+	dedupSeen map[dedupKey]time.Time // Last broadcast time per message key
+
+	deadLetters *datastructure.RingBuffer[DeadLetter] // Dropped messages (nil when disabled)
+
+	subscriberCount   atomic.Int64  // Mirrors len(subscribers), readable without the lock
+	totalBroadcasts   atomic.Uint64 // Number of messages passed to the broadcaster
+	totalDropped      atomic.Uint64 // Number of messages dropped for a subscriber
+	totalDeduplicated atomic.Uint64 // Number of messages dropped as duplicates
+	totalFiltered     atomic.Uint64 // Number of messages dropped by the filter or transformer
+	sequence          atomic.Uint64 // Sequence number of the last message fanned out
+	lastBroadcastAt   atomic.Int64  // Unix nanoseconds of the last fan-out (0 = none)
+
+	paused      atomic.Bool    // Set by PauseAll, cleared by ResumeAll
+	pauseMu     sync.Mutex     // Protects pauseBuffer; held by ResumeAll while it drains it
+	pauseBuffer []*gen.Metrics // Messages broadcast while paused, oldest first
+
+	memUsed atomic.Int64 // Approximate memory held by queued messages (WithMemoryLimit)
+
+	onDropSem chan struct{} // Bounds the running WithOnDrop hooks (nil when disabled)
+}
+
+// subscriber is a registered subscriber. Entries are shared between subscriber
+// map snapshots and never modified once published, except for the atomic
+// back-pressure state.
+type subscriber struct {
+	ch           chan *gen.Metrics                 // Channel where metrics are delivered (nil for ring subscribers)
+	ring         *ringbuf.RingBuffer[*gen.Metrics] // Ring buffer where metrics are delivered (RegisterRing)
+	registeredAt time.Time                         // Registration time
+	backpressure atomic.Bool                       // Back-pressure state (WithWatermark)
+	valid        atomic.Bool                       // Set while registered; cleared once removed or replaced
+	mem          *memTracker                       // Memory held by the queued messages (WithMemoryLimit, nil = untracked)
+	groups       []string                          // Groups the subscriber is tagged with (WithGroups)
+	fullSince    atomic.Int64                      // Unix nanoseconds since the channel was found full (0 = not full, WithSubscriberIdleTimeout)
+	series       atomic.Pointer[subscriberSeries]  // Per-subscriber series, replaced by Rename
+}
+
+// subscriberSeries holds the children of the per-subscriber metric vectors for
+// one subscriber, looked up once at registration instead of on every message.
+// Once the series are deleted, writes to the children are no longer collected,
+// so in-flight fan-outs cannot re-create them.
+type subscriberSeries struct {
+	dropped prometheus.Counter // relay_subscriber_dropped_messages_total
+	depth   prometheus.Gauge   // relay_subscriber_channel_depth
+}
+
+// close closes the channel or ring buffer of the subscriber. The caller must
+// hold closeMu for writing.
+func (s *subscriber) close() {
+	if s.ring != nil {
+		s.ring.Close()
+		return
+	}
+	close(s.ch)
+}
+
+// sameQueue reports whether s and other deliver to the same channel or ring buffer.
+func (s *subscriber) sameQueue(other *subscriber) bool {
+	return s.ch == other.ch && s.ring == other.ring
+}
+
+// SubscriberHandle refers to a single registration returned by Register,
+// RegisterAfter or RegisterRing. It stays safe to use after the subscriber is
+// unregistered, even once its channel is closed: it then becomes invalid and
+// sends through it are no-ops.
+type SubscriberHandle struct {
+	b   *Broadcaster
+	id  string
+	sub *subscriber
+}
+
+// ID returns the subscriber ID the registration was made under (see Rename).
+func (h *SubscriberHandle) ID() string {
+	return h.id
+}
+
+// IsValid reports whether the registration is still current: false once the
+// subscriber was unregistered or its ID registered again (including with the
+// same channel, which returns a new handle).
+func (h *SubscriberHandle) IsValid() bool {
+	return h.sub.valid.Load()
+}
+
+// Send queues msg on the subscriber channel or ring buffer without blocking,
+// bypassing the broadcast pipeline (no replay, deduplication or policy).
+//
+// Parameters:
+//   - msg: the message to queue.
+//
+// Returns:
+//   - bool: false if the handle is invalid or the subscriber channel is full.
+func (h *SubscriberHandle) Send(msg *gen.Metrics) bool {
+	// Channels are only closed under the write lock, after being invalidated
+	h.b.closeMu.RLock()
+	defer h.b.closeMu.RUnlock()
+	if !h.IsValid() {
+		return false
+	}
+	if h.sub.ring != nil {
+		h.sub.ring.Send(msg)
+		return true
+	}
+	select {
+	case h.sub.ch <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// countNotifier is a subscriber count threshold registered through NotifyOnSubscriberCount.
+type countNotifier struct {
+	threshold int
+	ch        chan<- int
+}
+
+// BroadcasterStats is a point-in-time snapshot of Broadcaster telemetry.
+//
+// Fields:
+//   - SubscriberCount: number of registered subscribers.
+//   - TotalBroadcasts: number of messages passed to the broadcaster.
+//   - TotalDropped: number of per-subscriber deliveries that were dropped.
+//   - TotalDeduplicated: number of messages dropped as duplicates.
+//   - TotalFiltered: number of messages dropped by the message filter or transformer.
+//   - SequenceNumber: sequence number of the last message fanned out to subscribers.
+type BroadcasterStats struct {
+	SubscriberCount   int
+	TotalBroadcasts   uint64
+	TotalDropped      uint64
+	TotalDeduplicated uint64
+	TotalFiltered     uint64
+	SequenceNumber    uint64
+}
+
+// DeadLetter is a message that could not be delivered to a subscriber.
+type DeadLetter struct {
+	SubscriberID string       // Subscriber the message was dropped for
+	Message      *gen.Metrics // The dropped message
+	DroppedAt    time.Time    // When the message was dropped
+}
+
+// replayEntry is a message retained in the replay buffer with its sequence number.
+type replayEntry struct {
+	seq uint64
+	msg *gen.Metrics
+}
+
+// dedupKey identifies a message for deduplication purposes.
+type dedupKey struct {
+	hostname  string
+	timestamp int64
+}
+
+// workItem is the delivery of the messages of a fanout to a single subscriber,
+// dispatched to the worker pool.
+type workItem struct {
+	f   *fanout
+	id  string
+	sub *subscriber
+}
+
+// fanoutPool recycles fanout values, which are otherwise allocated, along with
+// their message slice, on every broadcast call.
+var fanoutPool = sync.Pool{New: func() any { return new(fanout) }}
+
+// recycleFanouts returns released fanout values to fanoutPool; benchmarks clear
+// it to measure the allocations the pool saves.
+var recycleFanouts = true
+
+// fanout is the state shared by the deliveries of a single broadcast call.
+// Instances come from fanoutPool and must not be used after release.
+type fanout struct {
+	ctx      context.Context // Bounds waiting sends (WithBroadcastTimeout, lossless)
+	msgs     []*gen.Metrics  // Messages to deliver, in order
+	lossless bool            // Block until delivered instead of applying the policy
+	wg       sync.WaitGroup  // Pending worker pool deliveries
+	slow     slowSet         // Subscribers to evict afterwards
+
+	missedMu sync.Mutex     // Protects missed
+	missed   []*gen.Metrics // Lossless sends abandoned because ctx was done
+
+	sent atomic.Int64 // Number of successful sends
+
+	sizes []int64 // Encoded size of each message of msgs (WithMemoryLimit)
+}
+
+// release resets f and returns it to fanoutPool. Message references are
+// cleared so that pooled values do not keep messages alive.
+func (f *fanout) release() {
+	clear(f.msgs)
+	f.msgs = f.msgs[:0]
+	f.ctx = nil
+	f.lossless = false
+	f.slow.ids = f.slow.ids[:0]
+	f.slow.reasons = f.slow.reasons[:0]
+	f.sent.Store(0)
+	f.sizes = f.sizes[:0]
+	// The missed slice is handed to the caller of BroadcastLossless
+	f.missed = nil
+	if recycleFanouts {
+		fanoutPool.Put(f)
+	}
+}
+
+// addMissed records a lossless send abandoned because the context was done.
+func (f *fanout) addMissed(msg *gen.Metrics) {
+	f.missedMu.Lock()
+	f.missed = append(f.missed, msg)
+	f.missedMu.Unlock()
+}
+
+// slowSet collects subscribers to evict under PolicyDisconnect or
+// WithSubscriberIdleTimeout, along with the reason of each eviction.
+type slowSet struct {
+	mu      sync.Mutex
+	ids     []string
+	reasons []EvictionReason
+}
+
+func (s *slowSet) add(id string, reason EvictionReason) {
+	s.mu.Lock()
+	s.ids = append(s.ids, id)
+	s.reasons = append(s.reasons, reason)
+	s.mu.Unlock()
 }
 
 // NewBroadcaster creates and returns a new Broadcaster.
 //
 // Parameters:
-//   - logger: zap.Logger for observability (can be nil).
+//   - ctx: context bounding background workers started by the options.
+//   - opts: optional BroadcasterOption values, including WithLogger.
 //
 // Returns:
 //   - *Broadcaster: a new Broadcaster instance.
-func NewBroadcaster(logger *zap.Logger) *Broadcaster {
-	return &Broadcaster{
-		subscribers: make(map[string]chan *gen.Metrics),
-		logger:      logger,
+func NewBroadcaster(ctx context.Context, opts ...BroadcasterOption) *Broadcaster {
+	var cfg broadcasterConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.logger == nil {
+		cfg.logger = zap.NewNop()
+	}
+	if cfg.clock == nil {
+		cfg.clock = realClock{}
+	}
+	logger := cfg.logger
+	if cfg.onRegister == nil {
+		cfg.onRegister = func(id string) {
+			logger.Info("subscriber registered", zap.String("id", id))
+		}
+	}
+	if cfg.onUnregister == nil {
+		cfg.onUnregister = func(id string) {
+			logger.Info("subscriber unregistered", zap.String("id", id))
+		}
+	}
+	return newBroadcaster(ctx, cfg)
+}
+
+// sibling creates a new, empty Broadcaster for the given topic, with the same
+// context, logger and options as b, except the webhook: b already forwards
+// every message a sibling receives.
+func (b *Broadcaster) sibling(topic string) *Broadcaster {
+	cfg := b.cfg
+	cfg.webhookURL = ""
+	s := newBroadcaster(b.ctx, cfg)
+	s.topic = topic
+	return s
+}
+
+// newBroadcaster creates a Broadcaster from an already built configuration,
+// whose logger is set.
+func newBroadcaster(ctx context.Context, cfg broadcasterConfig) *Broadcaster {
+	b := &Broadcaster{
+		leaving:      make(map[string]chan struct{}),
+		countChanged: make(chan struct{}),
+		logger:       cfg.logger,
+		ctx:          ctx,
+		dedupSeen:    make(map[dedupKey]time.Time),
+		cfg:          cfg,
+		topic:        defaultTopic,
+	}
+	b.subscribers.Store(map[string]*subscriber{})
+
+	reg := b.cfg.registerer
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	b.metrics = metrics.NewBroadcasterMetrics(reg)
+
+	if b.cfg.onDrop != nil {
+		b.onDropSem = make(chan struct{}, onDropConcurrency)
+	}
+	if b.cfg.deadLetterCapacity > 0 {
+		b.deadLetters = datastructure.NewRingBuffer[DeadLetter](b.cfg.deadLetterCapacity)
+	}
+	if b.cfg.webhookURL != "" {
+		b.webhook = newWebhookForwarder(ctx, b.logger, b.cfg.webhookURL, b.cfg.webhookClient, b.cfg.webhookRetries)
+	}
+	if b.cfg.workerPoolSize > 0 {
+		b.jobs = make(chan workItem)
+		for i := 0; i < b.cfg.workerPoolSize; i++ {
+			go b.worker()
+		}
 	}
+
+	return b
 }
 
 // Register adds a new subscriber with the given ID and metrics channel.
 //
+// When a replay buffer is configured, the buffered messages are queued on the
+// channel (as far as its capacity allows) before any message broadcast after
+// registration. A message broadcast concurrently with Register may be
+// delivered in addition to its replayed copy.
+//
+// Parameters:
+//   - id: Unique subscriber identifier.
+//   - ch: Channel where metrics will be delivered.
+//
+// Registering an ID that is already registered replaces the previous
+// registration, invalidating its handle, and closes its channel, unless it is
+// the same channel.
+//
+// Returns:
+//   - *SubscriberHandle: the handle of the registration (nil on error).
+//   - error: ErrSubscriberCapReached if the cap set with WithSubscriberCap is
+//     reached; re-registering an existing ID never hits the cap.
+func (b *Broadcaster) Register(id string, ch chan *gen.Metrics) (*SubscriberHandle, error) {
+	return b.RegisterAfter(id, ch, 0)
+}
+
+// RegisterAfter is Register for a resuming subscriber: only buffered messages
+// with a sequence number greater than afterSeq are replayed (see SequenceOf).
+//
 // Parameters:
 //   - id: Unique subscriber identifier.
 //   - ch: Channel where metrics will be delivered.
-func (b *Broadcaster) Register(id string, ch chan *gen.Metrics) {
+//   - afterSeq: sequence number of the last message the subscriber received (0 = replay all).
+//
+// Returns:
+//   - *SubscriberHandle: the handle of the registration (nil on error).
+//   - error: ErrSubscriberCapReached as in Register.
+func (b *Broadcaster) RegisterAfter(id string, ch chan *gen.Metrics, afterSeq uint64) (*SubscriberHandle, error) {
+	return b.register(id, &subscriber{ch: ch}, afterSeq, false)
+}
+
+// RegisterRing is RegisterAfter for a subscriber receiving through a ring
+// buffer instead of a channel (see WithRingBuffer). Sends to a ring never
+// block: once it is full, each message overwrites the oldest queued one, which
+// counts as dropped but is not recorded as a dead letter. Back-pressure,
+// broadcast timeouts, lossless sends and the SlowSubscriberPolicy do not apply.
+// UnregisterAll closes the ring (ringbuf.RingBuffer.Close).
+//
+// Parameters:
+//   - id: Unique subscriber identifier.
+//   - ring: Ring buffer where metrics will be delivered.
+//   - afterSeq: sequence number of the last message the subscriber received (0 = replay all).
+//
+// Returns:
+//   - *SubscriberHandle: the handle of the registration (nil on error).
+//   - error: ErrSubscriberCapReached as in Register.
+func (b *Broadcaster) RegisterRing(id string, ring *ringbuf.RingBuffer[*gen.Metrics], afterSeq uint64) (*SubscriberHandle, error) {
+	return b.register(id, &subscriber{ring: ring}, afterSeq, false)
+}
+
+// register adds sub under id, replacing and closing any previous registration
+// of id unless exclusive is set, and replays the buffered messages newer than
+// afterSeq to it.
+//
+// Returns:
+//   - *SubscriberHandle: see Register.
+//   - error: ErrSubscriberCapReached as in Register, or ErrSubscriberAlreadyExists
+//     if exclusive is set and id is registered.
+func (b *Broadcaster) register(id string, sub *subscriber, afterSeq uint64, exclusive bool) (*SubscriberHandle, error) {
+	for {
+		replacing := !exclusive && b.Has(id)
+		if replacing {
+			// The replaced channel is closed, which must not race with a fan-out
+			// sending to it; release lossless sends blocked on it first
+			b.signalLeaving(id)
+			b.closeMu.Lock()
+		}
+		retry, err := b.tryRegister(id, sub, afterSeq, replacing)
+		if replacing {
+			b.closeMu.Unlock()
+		}
+		if retry && exclusive {
+			return nil, ErrSubscriberAlreadyExists
+		}
+		if !retry {
+			if err != nil {
+				return nil, err
+			}
+			return &SubscriberHandle{b: b, id: id, sub: sub}, nil
+		}
+	}
+}
+
+// tryRegister performs register under the subscriber lock. canReplace reports
+// whether the caller holds closeMu for writing, which replacing a registration
+// requires.
+//
+// Returns:
+//   - bool: true if id is registered while canReplace is false; the caller
+//     must retry holding closeMu, or fail an exclusive registration.
+//   - error: ErrSubscriberCapReached as in Register.
+func (b *Broadcaster) tryRegister(id string, sub *subscriber, afterSeq uint64, canReplace bool) (bool, error) {
 	b.subscribersMu.Lock()
 	defer b.subscribersMu.Unlock()
-	b.subscribers[id] = ch
 
-	if b.logger != nil {
-		b.logger.Info("subscriber registered", zap.String("id", id))
+	current := b.load()
+	old, exists := current[id]
+	if exists && !canReplace {
+		return true, nil
+	}
+	if !exists && b.cfg.subscriberCap > 0 && len(current) >= b.cfg.subscriberCap {
+		b.logger.Warn("rejected subscriber: cap reached", zap.String("id", id), zap.Int("subscriber_cap", b.cfg.subscriberCap))
+		return false, ErrSubscriberCapReached
+	}
+
+	b.leavingMu.Lock()
+	b.leaving[id] = make(chan struct{})
+	b.leavingMu.Unlock()
+
+	// Publish and replay under the replay lock: messages recorded before are
+	// replayed, and messages recorded after are fanned out from the new snapshot
+	b.replayMu.Lock()
+	sub.registeredAt = time.Now()
+	sub.valid.Store(true)
+	sub.series.Store(b.newSubscriberSeries(id))
+	if b.cfg.memoryLimit > 0 {
+		sub.mem = &memTracker{}
+	}
+	b.updateLocked(func(next map[string]*subscriber) {
+		next[id] = sub
+	})
+	replayed := b.replayToLocked(sub, afterSeq)
+	b.replayMu.Unlock()
+	b.cfg.onRegister(id)
+
+	if exists && !old.sameQueue(sub) {
+		old.close()
+		b.logger.Info("closed replaced subscriber channel", zap.String("id", id))
+	}
+
+	if replayed > 0 {
+		b.logger.Info("replayed buffered messages to subscriber", zap.String("id", id), zap.Int("replayed", replayed))
+	}
+	return false, nil
+}
+
+// Subscribe registers an in-process subscriber under a random ID and returns its
+// channel, as a simpler alternative to Register and Unregister.
+//
+// Behavior:
+//   - The subscriber is unregistered and its channel closed when the returned
+//     cancel function is called or ctx is done, whichever comes first, so the
+//     channel can be consumed with range or select.
+//   - If the subscriber cannot be registered (ErrSubscriberCapReached), the
+//     returned channel is already closed.
+//   - Calling cancel more than once is safe.
+//
+// Parameters:
+//   - ctx: bounds the lifetime of the subscription.
+//   - opts: optional subscriber settings.
+//
+// Returns:
+//   - <-chan *gen.Metrics: the channel receiving broadcast metrics.
+//   - func(): cancels the subscription.
+func (b *Broadcaster) Subscribe(ctx context.Context, opts ...SubscriberOption) (<-chan *gen.Metrics, func()) {
+	cfg := subscriberConfig{channelSize: defaultSubscriberChannelSize}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	id := uuid.New().String()
+	ch := make(chan *gen.Metrics, cfg.channelSize)
+	if _, err := b.register(id, &subscriber{ch: ch, groups: cfg.groups}, cfg.afterSeq, false); err != nil {
+		close(ch)
+		return ch, func() {}
+	}
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.closeSubscribers([]string{id})
+		})
+	}
+	stop := context.AfterFunc(ctx, unsubscribe)
+	return ch, func() {
+		stop()
+		unsubscribe()
 	}
 }
 
-// Unregister removes the subscriber associated with the given ID.
+// Unregister removes the subscriber associated with the given ID. Its channel
+// is not closed. Unregistering an unknown ID is a no-op.
+//
+// Unregister does not wait for in-flight fan-outs, which may still hold the
+// channel and send to it once after Unregister returns. Closing the channel
+// here, or right after Unregister in the caller, could therefore panic a
+// concurrent Broadcast; a channel that must be closed should be removed with
+// UnregisterAll or a slow-subscriber disconnect, which close it safely.
 //
 // Parameters:
 //   - id: Identifier of the subscriber to remove.
 func (b *Broadcaster) Unregister(id string) {
+	b.unregister(id, nil)
+}
+
+// unregisterOwned is Unregister for the owner of a registration: id is only
+// removed while it is still registered with ch (or ring), so that a stream whose
+// registration was replaced does not unregister its successor.
+func (b *Broadcaster) unregisterOwned(id string, ch chan *gen.Metrics, ring *ringbuf.RingBuffer[*gen.Metrics]) {
+	b.unregister(id, &subscriber{ch: ch, ring: ring})
+}
+
+// unregister removes id, if owner is nil or id is registered with the queue of owner.
+func (b *Broadcaster) unregister(id string, owner *subscriber) {
+	owned := func() bool {
+		sub, ok := b.load()[id]
+		return ok && (owner == nil || sub.sameQueue(owner))
+	}
+	if owner != nil && !owned() {
+		return
+	}
+
+	// Release lossless sends blocked on this subscriber
+	b.signalLeaving(id)
+
 	b.subscribersMu.Lock()
 	defer b.subscribersMu.Unlock()
-	delete(b.subscribers, id)
-
-	if b.logger != nil {
-		b.logger.Info("subscriber unregistered", zap.String("id", id))
+	if owned() {
+		b.updateLocked(func(next map[string]*subscriber) {
+			delete(next, id)
+		})
+		b.cfg.onUnregister(id)
+		// Under subscribersMu, so that a concurrent registration of id keeps its series
+		b.deleteSubscriberSeries(id)
 	}
 }
 
-// Broadcast delivers a metrics message to all active subscribers.
+// UnregisterAll closes the channel of every registered subscriber and clears
+// the subscriber map. Subscribers observe the closed channel and terminate
+// their stream, which is what allows a graceful shutdown to complete.
 //
 // Behavior:
-//   - If the subscriber's channel has capacity, the message is sent.
-//   - If the channel is full, the message is dropped and a warning is logged.
+//   - Channels already closed by a previous call are never closed again.
+//   - Calling UnregisterAll multiple times is safe.
+func (b *Broadcaster) UnregisterAll() {
+	b.signalLeaving()
+
+	b.closeMu.Lock()
+	defer b.closeMu.Unlock()
+	b.subscribersMu.Lock()
+	defer b.subscribersMu.Unlock()
+
+	current := b.load()
+	ids := make([]string, 0, len(current))
+	for id := range current {
+		ids = append(ids, id)
+	}
+	b.closeLocked(ids)
+
+	b.logger.Info("all subscribers unregistered")
+}
+
+// PauseAll pauses fan-out without disconnecting any subscriber: until
+// ResumeAll, broadcast messages are held in a pause buffer of the size set
+// with WithPauseBuffer instead of being delivered. Once the buffer is full,
+// each new message evicts the oldest held one; without WithPauseBuffer,
+// messages broadcast while paused are discarded. Held messages are not yet
+// deduplicated, transformed or recorded for replay. Calling PauseAll while
+// paused has no effect.
+//
+// Only this broadcaster is paused, not the per-cluster topics of a
+// MetricsServer. While it is paused, a MetricsServer rejects new agent streams
+// with codes.Unavailable and a retry-after header, whose delay is set with
+// WithPausedRetryAfter (10s by default, as PauseAll has no planned resume time).
+func (b *Broadcaster) PauseAll() {
+	if b.paused.Swap(true) {
+		return
+	}
+	b.logger.Info("broadcaster paused", zap.Int("pause_buffer_size", b.cfg.pauseBufferSize))
+}
+
+// ResumeAll broadcasts the messages held since PauseAll, in order, to the
+// current subscribers, then resumes live fan-out. Broadcasts made while
+// ResumeAll runs are delivered after the held messages. Calling ResumeAll
+// while not paused has no effect.
+func (b *Broadcaster) ResumeAll() {
+	b.pauseMu.Lock()
+	defer b.pauseMu.Unlock()
+	if !b.paused.Load() {
+		return
+	}
+
+	held := b.pauseBuffer
+	b.pauseBuffer = nil
+	if len(held) > 0 {
+		b.broadcastNow(b.ctx, held, false, nil)
+	}
+	b.paused.Store(false)
+
+	b.logger.Info("broadcaster resumed", zap.Int("delivered", len(held)))
+}
+
+// IsPaused reports whether fan-out is paused by PauseAll.
+func (b *Broadcaster) IsPaused() bool {
+	return b.paused.Load()
+}
+
+// IsGloballyPaused is an alias of IsPaused, reporting whether fan-out of this
+// broadcaster is paused by PauseAll.
+func (b *Broadcaster) IsGloballyPaused() bool {
+	return b.IsPaused()
+}
+
+// hold appends msgs to the pause buffer, evicting the oldest held messages
+// beyond its capacity.
+//
+// Returns:
+//   - bool: false if the broadcaster was resumed in the meantime; msgs must
+//     then be broadcast normally.
+func (b *Broadcaster) hold(msgs []*gen.Metrics) bool {
+	b.pauseMu.Lock()
+	defer b.pauseMu.Unlock()
+	if !b.paused.Load() {
+		return false
+	}
+
+	b.pauseBuffer = append(b.pauseBuffer, msgs...)
+	if over := len(b.pauseBuffer) - b.cfg.pauseBufferSize; over > 0 {
+		clear(b.pauseBuffer[:over])
+		b.pauseBuffer = b.pauseBuffer[over:]
+		b.logger.Warn("discarding oldest paused metrics: pause buffer full", zap.Int("discarded", over))
+	}
+	return true
+}
+
+// Rename moves the registration of oldID to newID in a single step: the
+// subscriber keeps its channel, registration time, back-pressure state and
+// queued messages, and keeps receiving broadcasts without a gap. Its handles
+// stay valid, but SubscriberHandle.ID keeps reporting oldID; the subscriber
+// must be unregistered under newID. Its relay_subscriber_dropped_messages_total
+// series restarts under newID.
 //
 // Parameters:
-//   - msg: Metrics message to broadcast.
-func (b *Broadcaster) Broadcast(msg *gen.Metrics) {
-	b.subscribersMu.RLock()
-	defer b.subscribersMu.RUnlock()
+//   - oldID: the registered subscriber ID.
+//   - newID: the new subscriber ID.
+//
+// Returns:
+//   - error: ErrSubscriberNotFound if oldID is not registered,
+//     ErrSubscriberAlreadyExists if newID is.
+func (b *Broadcaster) Rename(oldID, newID string) error {
+	b.subscribersMu.Lock()
+	defer b.subscribersMu.Unlock()
+
+	current := b.load()
+	sub, ok := current[oldID]
+	if !ok {
+		return ErrSubscriberNotFound
+	}
+	if _, exists := current[newID]; exists {
+		return ErrSubscriberAlreadyExists
+	}
+
+	// Not updateLocked: the entry moves, so its handles must stay valid and the
+	// subscriber count does not change
+	next := make(map[string]*subscriber, len(current))
+	for id, s := range current {
+		next[id] = s
+	}
+	delete(next, oldID)
+	next[newID] = sub
+	sub.series.Store(b.newSubscriberSeries(newID))
+
+	// Move the leaving channel first, so that a lossless send to newID blocks
+	// on it as soon as the new snapshot is published
+	b.leavingMu.Lock()
+	if ch, ok := b.leaving[oldID]; ok {
+		delete(b.leaving, oldID)
+		b.leaving[newID] = ch
+	}
+	b.leavingMu.Unlock()
+	b.subscribers.Store(next)
+
+	b.deleteSubscriberSeries(oldID)
+	b.logger.Info("subscriber renamed", zap.String("old_id", oldID), zap.String("id", newID))
+	return nil
+}
+
+// Has reports whether a subscriber with the given ID is registered.
+//
+// Parameters:
+//   - id: Subscriber identifier.
+//
+// Returns:
+//   - bool: true if the subscriber is registered.
+func (b *Broadcaster) Has(id string) bool {
+	_, ok := b.load()[id]
+	return ok
+}
+
+// RegisteredSince returns the time at which the subscriber with the given ID registered.
+//
+// Parameters:
+//   - id: Subscriber identifier.
+//
+// Returns:
+//   - time.Time: registration time (zero if the ID is unknown).
+//   - bool: true if the subscriber is registered.
+func (b *Broadcaster) RegisteredSince(id string) (time.Time, bool) {
+	sub, ok := b.load()[id]
+	if !ok {
+		return time.Time{}, false
+	}
+	return sub.registeredAt, true
+}
+
+// QueueLen returns the number of messages queued on the subscriber with the
+// given ID, in its channel or ring buffer. It may include messages the
+// subscriber is receiving concurrently.
+//
+// Parameters:
+//   - id: Subscriber identifier.
+//
+// Returns:
+//   - int: number of queued messages (0 if the ID is unknown).
+//   - bool: true if the subscriber is registered.
+func (b *Broadcaster) QueueLen(id string) (int, bool) {
+	sub, ok := b.load()[id]
+	if !ok {
+		return 0, false
+	}
+	return sub.queueLen(), true
+}
+
+// IsBackpressured reports whether the subscriber with the given ID is currently
+// skipped by Broadcast because its channel reached the high watermark. It always
+// returns false when WithWatermark is not configured or the ID is unknown.
+//
+// Parameters:
+//   - id: Subscriber identifier.
+//
+// Returns:
+//   - bool: true if the subscriber is back-pressured.
+func (b *Broadcaster) IsBackpressured(id string) bool {
+	sub, ok := b.load()[id]
+	if !ok {
+		return false
+	}
+	return b.backpressured(sub)
+}
+
+// ForEach calls fn once for every subscriber registered when ForEach was
+// called. It iterates a snapshot without holding any lock, so fn may call
+// other Broadcaster methods, including Register and Unregister. The channel
+// is nil for subscribers registered with RegisterRing.
+//
+// Parameters:
+//   - fn: function invoked with each subscriber ID and channel.
+func (b *Broadcaster) ForEach(fn func(id string, ch chan *gen.Metrics)) {
+	for id, sub := range b.load() {
+		fn(id, sub.ch)
+	}
+}
+
+// SubscriberCount returns the number of currently registered subscribers.
+//
+// Returns:
+//   - int: number of active subscribers.
+func (b *Broadcaster) SubscriberCount() int {
+	return len(b.load())
+}
+
+// NotifyOnSubscriberCount sends the subscriber count to ch every time it crosses
+// threshold in either direction: from at most threshold to above it, or back.
+//
+// Sends are non-blocking: a notification is dropped if ch is not ready, so ch
+// should be buffered. Notifications are sent while subscriber map updates are serialized.
+//
+// Parameters:
+//   - threshold: subscriber count to watch.
+//   - ch: channel receiving the new subscriber count.
+func (b *Broadcaster) NotifyOnSubscriberCount(threshold int, ch chan<- int) {
+	b.subscribersMu.Lock()
+	defer b.subscribersMu.Unlock()
+	b.countNotifiers = append(b.countNotifiers, countNotifier{threshold: threshold, ch: ch})
+}
+
+// WaitForSubscribers blocks until at least minCount subscribers are registered
+// or ctx is done, without polling.
+//
+// Parameters:
+//   - ctx: bounds the wait.
+//   - minCount: number of subscribers to wait for.
+//
+// Returns:
+//   - error: nil once minCount subscribers are registered, ctx.Err() otherwise.
+func (b *Broadcaster) WaitForSubscribers(ctx context.Context, minCount int) error {
+	for {
+		b.subscribersMu.Lock()
+		if len(b.load()) >= minCount {
+			b.subscribersMu.Unlock()
+			return nil
+		}
+		changed := b.countChanged
+		b.subscribersMu.Unlock()
 
-	for id, ch := range b.subscribers {
 		select {
-		case ch <- msg:
-			if b.logger != nil {
-				b.logger.Debug("broadcasted message", zap.String("subscriber_id", id))
-			}
-		default:
-			if b.logger != nil {
-				b.logger.Warn("dropping metrics: subscriber channel full", zap.String("subscriber_id", id))
-			}
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// SequenceOf returns the sequence number assigned to a broadcast message. Only
+// messages still held in the replay buffer can be looked up.
+//
+// Parameters:
+//   - msg: a message received from a subscriber channel.
+//
+// With WithMessageCloning, subscribers receive copies, which are matched by
+// content: a copy that was modified is not found, and a copy of a message
+// broadcast several times yields the latest sequence number.
+//
+// Returns:
+//   - uint64: the message sequence number.
+//   - bool: false if the message is not in the replay buffer.
+func (b *Broadcaster) SequenceOf(msg *gen.Metrics) (uint64, bool) {
+	b.replayMu.Lock()
+	defer b.replayMu.Unlock()
+
+	// Messages are usually looked up right after being broadcast: search newest first
+	for i := len(b.replay) - 1; i >= 0; i-- {
+		if b.replay[i].msg == msg || (b.cfg.cloneMessages && proto.Equal(b.replay[i].msg, msg)) {
+			return b.replay[i].seq, true
+		}
+	}
+	return 0, false
+}
+
+// Stats returns a snapshot of the broadcaster telemetry. Values are read
+// atomically without taking any lock, so they may be slightly
+// inconsistent with each other under concurrent broadcasts.
+//
+// Returns:
+//   - BroadcasterStats: the telemetry snapshot.
+func (b *Broadcaster) Stats() BroadcasterStats {
+	return BroadcasterStats{
+		SubscriberCount:   int(b.subscriberCount.Load()),
+		TotalBroadcasts:   b.totalBroadcasts.Load(),
+		TotalDropped:      b.totalDropped.Load(),
+		TotalDeduplicated: b.totalDeduplicated.Load(),
+		TotalFiltered:     b.totalFiltered.Load(),
+		SequenceNumber:    b.sequence.Load(),
+	}
+}
+
+// Metrics returns a snapshot of the broadcaster counters as an admin proto,
+// for admin RPCs. As in Stats, each counter is read atomically, but not all of
+// them at once: under concurrent broadcasts, they may be slightly
+// inconsistent with each other.
+//
+// Returns:
+//   - *admin.BroadcasterMetrics: the counter snapshot.
+func (b *Broadcaster) Metrics() *admin.BroadcasterMetrics {
+	stats := b.Stats()
+	m := &admin.BroadcasterMetrics{
+		TotalBroadcasts:   stats.TotalBroadcasts,
+		TotalDropped:      stats.TotalDropped,
+		TotalFiltered:     stats.TotalFiltered,
+		TotalDeduplicated: stats.TotalDeduplicated,
+		SubscriberCount:   uint32(stats.SubscriberCount),
+		SequenceNumber:    stats.SequenceNumber,
+	}
+	if at := b.lastBroadcastAt.Load(); at != 0 {
+		m.LastBroadcastAt = timestamppb.New(time.Unix(0, at))
+	}
+	return m
+}
+
+// DeadLetters removes and returns all retained dead letters, oldest first.
+//
+// Returns:
+//   - []DeadLetter: the retained dead letters (nil if the queue is disabled or empty).
+func (b *Broadcaster) DeadLetters() []DeadLetter {
+	if b.deadLetters == nil {
+		return nil
+	}
+
+	var out []DeadLetter
+	for {
+		_, dl, ok := b.deadLetters.Pop()
+		if !ok {
+			return out
+		}
+		out = append(out, dl)
+	}
+}
+
+// Broadcast delivers a metrics message to all active subscribers.
+//
+// Behavior:
+//   - While paused by PauseAll, the message is held until ResumeAll instead.
+//   - The message transformer, if configured, is applied first (without holding
+//     any lock); a nil result drops the message.
+//   - Duplicate messages within the deduplication window are dropped.
+//   - The message is recorded in the replay buffer, if configured.
+//   - If the subscriber's channel has capacity, the message is sent.
+//   - With WithBroadcastTimeout, a full channel is retried until the timeout
+//     expires or the broadcaster context is done.
+//   - If the channel is still full, the SlowSubscriberPolicy is applied and a warning is logged.
+//   - With a worker pool, sends are spread across the workers; Broadcast
+//     returns once every subscriber has been attempted.
+//   - With WithWebhookForwarder, the message is then queued for posting to the
+//     webhook, without waiting for the request.
+//   - With no registered subscribers, including after every subscriber has
+//     unregistered, Broadcast never blocks; the message is still counted and
+//     recorded in the replay buffer.
+//   - Successful sends are counted in relay_messages_sent_total.
+//
+// Parameters:
+//   - msg: Metrics message to broadcast.
+//
+// Returns:
+//   - sent: number of subscribers the message was sent to.
+//   - dropped: number of subscribers it could not be sent to, whether dropped
+//     by the SlowSubscriberPolicy, back-pressure or the memory limit, or because
+//     the subscriber unregistered during a lossless send. sent + dropped is the
+//     number of subscribers at broadcast time. Both are 0 if the message was
+//     filtered, deduplicated or held while paused.
+func (b *Broadcaster) Broadcast(msg *gen.Metrics) (sent int, dropped int) {
+	return b.BroadcastWithContext(b.ctx, msg)
+}
+
+// BroadcastWithContext is Broadcast with a caller-provided context. With
+// WithBroadcastTimeout, a send to a full subscriber channel gives up as soon as
+// ctx is done, even before the timeout expires.
+//
+// Parameters:
+//   - ctx: bounds the time spent waiting on full subscriber channels.
+//   - msg: Metrics message to broadcast.
+//
+// Returns:
+//   - sent, dropped: as in Broadcast.
+func (b *Broadcaster) BroadcastWithContext(ctx context.Context, msg *gen.Metrics) (sent int, dropped int) {
+	_, sent, dropped = b.broadcast(ctx, []*gen.Metrics{msg}, false)
+	return sent, dropped
+}
+
+// BroadcastLossless broadcasts msg without ever dropping it for a slow
+// subscriber: each send blocks until the subscriber has room, the subscriber
+// unregisters, or ctx is done. Back-pressure and the SlowSubscriberPolicy do
+// not apply.
+//
+// Subscriber channels are not closed while waiting, and inline fan-out
+// waits on subscribers one after the other; use WithWorkerPool to wait on them
+// in parallel.
+//
+// Parameters:
+//   - ctx: the only bound on the time spent waiting on full subscriber channels.
+//   - msg: Metrics message to broadcast.
+//
+// Returns:
+//   - []*gen.Metrics: msg once per subscriber it could not be delivered to before
+//     ctx was done (nil if it reached every subscriber).
+//   - error: ctx.Err() if some deliveries were abandoned.
+func (b *Broadcaster) BroadcastLossless(ctx context.Context, msg *gen.Metrics) ([]*gen.Metrics, error) {
+	missed, _, _ := b.broadcast(ctx, []*gen.Metrics{msg}, true)
+	if len(missed) == 0 {
+		return nil, nil
+	}
+	return missed, ctx.Err()
+}
+
+// BroadcastAcked broadcasts msg as BroadcastWithContext does, and reports
+// whether at least one subscriber received it, i.e. whether a send to a
+// subscriber channel or ring buffer succeeded.
+//
+// Behavior:
+//   - While no subscriber is registered, it first waits for one until ctx is
+//     done; the message is then broadcast anyway, so that it is still counted and
+//     recorded in the replay buffer.
+//   - ctx also bounds the waits on full subscriber channels (WithBroadcastTimeout,
+//     WithLosslessSend).
+//   - While the broadcaster is paused, the message is held and not reported as received.
+//
+// Parameters:
+//   - ctx: bounds the wait for a subscriber.
+//   - msg: Metrics message to broadcast.
+//
+// Returns:
+//   - bool: true if at least one subscriber received msg.
+func (b *Broadcaster) BroadcastAcked(ctx context.Context, msg *gen.Metrics) bool {
+	// On timeout, the broadcast below still records the message
+	_ = b.WaitForSubscribers(ctx, 1)
+	_, sent, _ := b.broadcast(ctx, []*gen.Metrics{msg}, false)
+	return sent > 0
+}
+
+// BroadcastBatch broadcasts several messages over a single subscriber snapshot.
+// Each message is processed as in Broadcast, and every
+// subscriber receives the delivered messages in order.
+//
+// Parameters:
+//   - msgs: Metrics messages to broadcast, in order.
+func (b *Broadcaster) BroadcastBatch(msgs []*gen.Metrics) {
+	b.broadcast(b.ctx, msgs, false)
+}
+
+// broadcast holds msgs in the pause buffer while the broadcaster is paused, and
+// otherwise broadcasts them with broadcastNow.
+//
+// Returns:
+//   - []*gen.Metrics: see broadcastNow (nil while paused).
+//   - int, int: see broadcastNow (0 while paused).
+func (b *Broadcaster) broadcast(ctx context.Context, msgs []*gen.Metrics, lossless bool) ([]*gen.Metrics, int, int) {
+	if b.paused.Load() && b.hold(msgs) {
+		return nil, 0, 0
+	}
+	return b.broadcastNow(ctx, msgs, lossless, nil)
+}
+
+// broadcastNow prepares msgs and fans the accepted ones out to every subscriber,
+// or only to the subscribers accepted by target (BroadcastToGroup, BroadcastIf).
+// Targeted messages are neither recorded for replay nor forwarded to the webhook.
+//
+// Returns:
+//   - []*gen.Metrics: the lossless sends abandoned because ctx was done, once per
+//     subscriber (nil if none).
+//   - int: number of successful sends to subscribers, over all accepted messages.
+//   - int: number of sends that did not succeed, i.e. the accepted messages
+//     times the targeted subscribers, minus the successful sends.
+func (b *Broadcaster) broadcastNow(ctx context.Context, msgs []*gen.Metrics, lossless bool, target func(id string, sub *subscriber) bool) ([]*gen.Metrics, int, int) {
+	start := time.Now()
+	f := fanoutPool.Get().(*fanout)
+	defer f.release()
+	for _, msg := range msgs {
+		if msg = b.prepare(msg, target == nil); msg != nil {
+			f.msgs = append(f.msgs, msg)
+		}
+	}
+	if len(f.msgs) == 0 {
+		return nil, 0, 0
+	}
+	b.lastBroadcastAt.Store(start.UnixNano())
+	if b.cfg.memoryLimit > 0 {
+		for _, msg := range f.msgs {
+			f.sizes = append(f.sizes, int64(proto.Size(msg)))
+		}
+	}
+	f.ctx = ctx
+	f.lossless = lossless || b.cfg.lossless
+
+	// The read lock only keeps channels from being closed during the fan-out;
+	// Register and Unregister do not wait for it
+	b.closeMu.RLock()
+	var lockAcquiredAt time.Time
+	if b.cfg.lockProfileThreshold > 0 {
+		lockAcquiredAt = time.Now()
+	}
+	subscribers := b.load()
+	targets := 0
+	if b.jobs == nil {
+		for id, sub := range subscribers {
+			if target != nil && !target(id, sub) {
+				continue
+			}
+			targets++
+			if reason, evict := b.deliverAll(f, id, sub); evict {
+				f.slow.add(id, reason)
+			}
+		}
+	} else {
+		for id, sub := range subscribers {
+			if target != nil && !target(id, sub) {
+				continue
+			}
+			targets++
+			f.wg.Add(1)
+			item := workItem{f: f, id: id, sub: sub}
+			select {
+			case b.jobs <- item:
+			case <-b.ctx.Done():
+				// Workers are gone: fall back to an inline send
+				b.process(item)
+			}
+		}
+		f.wg.Wait()
+	}
+	b.closeMu.RUnlock()
+	if b.cfg.lockProfileThreshold > 0 {
+		b.profileLock(time.Since(lockAcquiredAt), len(subscribers))
+	}
+	b.metrics.FanoutDuration.Observe(time.Since(start).Seconds())
+	sent := int(f.sent.Load())
+	dropped := targets*len(f.msgs) - sent
+	b.metrics.SentMessages.Add(float64(sent))
+	if b.cfg.onBroadcast != nil {
+		b.cfg.onBroadcast(sent, dropped)
+	}
+
+	if len(f.slow.ids) > 0 {
+		b.disconnect(f.slow.ids, f.slow.reasons)
+	}
+	if b.webhook != nil && target == nil {
+		for _, msg := range f.msgs {
+			b.webhook.enqueue(msg)
+		}
+	}
+	return f.missed, sent, dropped
+}
+
+// profileLock records the time a fan-out held closeMu (WithLockProfiling),
+// warning if it exceeds the threshold.
+func (b *Broadcaster) profileLock(held time.Duration, subscribers int) {
+	b.metrics.LockHeld.Observe(held.Seconds())
+	if held > b.cfg.lockProfileThreshold {
+		b.logger.Warn("broadcast held the broadcaster lock above threshold",
+			zap.Duration("lock_held", held),
+			zap.Duration("threshold", b.cfg.lockProfileThreshold),
+			zap.Int("subscriber_count", subscribers),
+		)
+	}
+}
+
+// prepare applies the filter, transformer, deduplication and, if record is set,
+// replay recording to a message about to be fanned out.
+//
+// Returns:
+//   - *gen.Metrics: the message to deliver, or nil if it was dropped.
+func (b *Broadcaster) prepare(msg *gen.Metrics, record bool) *gen.Metrics {
+	b.totalBroadcasts.Add(1)
+	b.metrics.BroadcastMessages.Inc()
+
+	if b.cfg.filter != nil && !b.cfg.filter(msg) {
+		b.totalFiltered.Add(1)
+		b.metrics.FilteredMessages.Inc()
+		b.logger.Debug("dropping metrics: rejected by the message filter", zap.String("host", msg.GetNodeMetrics().GetHostname()))
+		return nil
+	}
+	if b.cfg.transformer != nil {
+		orig := msg
+		if msg = b.cfg.transformer(msg); msg == nil {
+			b.totalFiltered.Add(1)
+			b.metrics.FilteredMessages.Inc()
+			b.logger.Debug("dropping metrics: transformer returned nil", requestIDField(orig))
+			return nil
+		}
+		copyRequestID(orig, msg)
+	}
+
+	if b.isDuplicate(msg) {
+		b.totalDeduplicated.Add(1)
+		b.logger.Debug("dropping duplicate metrics", zap.String("host", msg.GetNodeMetrics().GetHostname()))
+		return nil
+	}
+	if record {
+		b.record(msg)
+	}
+	if ce := b.logger.Check(zap.DebugLevel, "broadcasting metrics"); ce != nil {
+		ce.Write(requestIDField(msg))
+	}
+	return msg
+}
+
+// worker processes fan-out work items until the broadcaster context is done.
+func (b *Broadcaster) worker() {
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case item := <-b.jobs:
+			b.process(item)
+		}
+	}
+}
+
+// process performs the send described by a work item and signals completion.
+func (b *Broadcaster) process(item workItem) {
+	defer item.f.wg.Done()
+	if reason, evict := b.deliverAll(item.f, item.id, item.sub); evict {
+		item.f.slow.add(item.id, reason)
+	}
+}
+
+// deliverAll delivers msgs in order to a single subscriber, stopping early if
+// the subscriber must be evicted, then samples its queue length in
+// relay_subscriber_channel_depth.
+//
+// Returns:
+//   - EvictionReason: why the subscriber must be evicted, if it must.
+//   - bool: true if the subscriber must be evicted (see deliver).
+func (b *Broadcaster) deliverAll(f *fanout, id string, sub *subscriber) (EvictionReason, bool) {
+	defer b.sampleDepth(sub)
+	for i, msg := range f.msgs {
+		msg = b.copyFor(msg)
+		var size int64
+		if sub.mem != nil {
+			size = f.sizes[i]
+			if !b.reserveMemory(sub, size) {
+				b.logger.Warn("dropping metrics: larger than the memory limit", zap.String("subscriber_id", id), zap.Int64("size_bytes", size))
+				b.drop(id, sub, msg)
+				continue
+			}
+		}
+		if sub.ring != nil {
+			// The ring buffer accepts every message, overwriting the oldest if needed
+			b.deliverRing(id, sub, msg)
+			b.sent(f, sub, size)
+			continue
+		}
+		if f.lossless {
+			b.deliverLossless(f, id, sub, msg, size)
+			continue
+		}
+		if reason, evict := b.deliver(f, id, sub, msg, size); evict {
+			return reason, true
+		}
+	}
+	return 0, false
+}
+
+// sampleDepth records the queue length of sub in relay_subscriber_channel_depth,
+// unless it is no longer registered.
+func (b *Broadcaster) sampleDepth(sub *subscriber) {
+	if !sub.valid.Load() {
+		return
+	}
+	sub.series.Load().depth.Set(float64(sub.queueLen()))
+}
+
+// newSubscriberSeries returns the per-subscriber series of subscriber id.
+func (b *Broadcaster) newSubscriberSeries(id string) *subscriberSeries {
+	return &subscriberSeries{
+		dropped: b.metrics.SubscriberDroppedMessages.WithLabelValues(b.topic, id),
+		depth:   b.metrics.SubscriberChannelDepth.WithLabelValues(b.topic, id),
+	}
+}
+
+// deleteSubscriberSeries deletes the per-subscriber series of a subscriber that
+// unregistered or was renamed. The caller must hold subscribersMu, which also
+// serializes the series lookups of newSubscriberSeries.
+func (b *Broadcaster) deleteSubscriberSeries(id string) {
+	b.metrics.SubscriberDroppedMessages.DeleteLabelValues(b.topic, id)
+	b.metrics.SubscriberChannelDepth.DeleteLabelValues(b.topic, id)
+}
+
+// deliverRing sends msg to a ring buffer subscriber, accounting for the
+// message it overwrites, if any.
+func (b *Broadcaster) deliverRing(id string, sub *subscriber, msg *gen.Metrics) {
+	if sub.ring.Send(msg) {
+		b.debugDelivery("broadcasted message", id, msg)
+		return
+	}
+	b.debugDelivery("overwrote oldest metrics: subscriber ring buffer full", id, msg)
+	b.totalDropped.Add(1)
+	sub.series.Load().dropped.Inc()
+}
+
+// deliverLossless sends msg to a single subscriber, blocking until it is
+// delivered, the subscriber starts unregistering, or the fanout context is done.
+// Only the latter counts as a drop and is reported as missed.
+func (b *Broadcaster) deliverLossless(f *fanout, id string, sub *subscriber, msg *gen.Metrics, size int64) {
+	ch := sub.ch
+	select {
+	case ch <- msg:
+		b.sent(f, sub, size)
+		b.debugDelivery("broadcasted message", id, msg)
+		return
+	default:
+	}
+
+	select {
+	case ch <- msg:
+		b.sent(f, sub, size)
+		b.debugDelivery("broadcasted message after waiting", id, msg)
+	case <-b.leavingChan(id):
+	case <-f.ctx.Done():
+		b.drop(id, sub, msg)
+		f.addMissed(msg)
+	}
+}
+
+// sent records a successful send of a message of size bytes to sub: it is
+// counted on f and, with WithMemoryLimit, the message is accounted to sub.
+func (b *Broadcaster) sent(f *fanout, sub *subscriber, size int64) {
+	f.sent.Add(1)
+	if sub.mem != nil {
+		sub.mem.push(size)
+		b.memUsed.Add(size)
+	}
+}
+
+// debugDelivery logs the outcome of a send of msg to subscriber id at DEBUG
+// level. The fields are only built when DEBUG is enabled, which keeps the
+// fan-out free of logging allocations otherwise.
+func (b *Broadcaster) debugDelivery(message, id string, msg *gen.Metrics) {
+	if ce := b.logger.Check(zap.DebugLevel, message); ce != nil {
+		ce.Write(zap.String("subscriber_id", id), requestIDField(msg))
+	}
+}
+
+// deliver attempts a non-blocking send of msg to a single subscriber, and counts
+// it as sent on f if it succeeds.
+//
+// Returns:
+//   - EvictionReason: ReasonIdleTimeout if the subscriber channel stayed full
+//     for the idle timeout, ReasonCapacityExceeded otherwise.
+//   - bool: true if the subscriber must be evicted (PolicyDisconnect or
+//     WithSubscriberIdleTimeout).
+func (b *Broadcaster) deliver(f *fanout, id string, sub *subscriber, msg *gen.Metrics, size int64) (EvictionReason, bool) {
+	ch := sub.ch
+	if b.backpressured(sub) {
+		b.debugDelivery("skipping back-pressured subscriber", id, msg)
+		b.drop(id, sub, msg)
+		return 0, false
+	}
+
+	select {
+	case ch <- msg:
+		b.sent(f, sub, size)
+		b.consumed(sub)
+		b.debugDelivery("broadcasted message", id, msg)
+		return 0, false
+	default:
+	}
+
+	if b.idleExpired(sub) {
+		b.logger.Warn("dropping metrics: subscriber idle", zap.String("subscriber_id", id), requestIDField(msg))
+		b.drop(id, sub, msg)
+		return ReasonIdleTimeout, true
+	}
+
+	if b.cfg.broadcastTimeout > 0 && b.sendWithTimeout(f.ctx, ch, msg) {
+		b.sent(f, sub, size)
+		b.consumed(sub)
+		b.debugDelivery("broadcasted message after waiting", id, msg)
+		return 0, false
+	}
+
+	if b.cfg.slowSubscriberPolicy == PolicyDropOldest {
+		select {
+		case old := <-ch:
+			b.drop(id, sub, old)
+		default:
+		}
+		select {
+		case ch <- msg:
+			b.sent(f, sub, size)
+			b.logger.Warn("dropping oldest metrics: subscriber channel full", zap.String("subscriber_id", id), requestIDField(msg))
+			return 0, false
+		default:
+		}
+	}
+
+	b.logger.Warn("dropping metrics: subscriber channel full", zap.String("subscriber_id", id), requestIDField(msg))
+	b.drop(id, sub, msg)
+
+	return ReasonCapacityExceeded, b.cfg.slowSubscriberPolicy == PolicyDisconnect
+}
+
+// sendWithTimeout sends msg to ch, waiting at most the configured broadcast
+// timeout or until ctx is done.
+//
+// Returns:
+//   - bool: true if the message was sent.
+func (b *Broadcaster) sendWithTimeout(ctx context.Context, ch chan *gen.Metrics, msg *gen.Metrics) bool {
+	timer := time.NewTimer(b.cfg.broadcastTimeout)
+	defer timer.Stop()
+
+	select {
+	case ch <- msg:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// backpressured updates and returns the back-pressure state of a subscriber from
+// its current channel fill: it enters back-pressure at the high watermark and
+// leaves it once the fill drops to the low watermark.
+func (b *Broadcaster) backpressured(sub *subscriber) bool {
+	if b.cfg.watermarkHigh <= 0 {
+		return false
+	}
+
+	state := &sub.backpressure
+	fill := len(sub.ch)
+	if state.Load() {
+		if fill <= b.cfg.watermarkLow {
+			state.Store(false)
+			return false
+		}
+		return true
+	}
+	if fill >= b.cfg.watermarkHigh {
+		state.Store(true)
+		return true
+	}
+	return false
+}
+
+// disconnect unregisters the given slow subscribers and closes their channels,
+// then reports each eviction with the reason at the same index of reasons.
+func (b *Broadcaster) disconnect(ids []string, reasons []EvictionReason) {
+	closed := b.closeSubscribers(ids)
+	i := 0
+	for _, id := range closed {
+		// closed preserves the order of ids
+		for ids[i] != id {
+			i++
+		}
+		b.logger.Warn("disconnected slow subscriber", zap.String("subscriber_id", id), zap.Stringer("reason", reasons[i]))
+		b.evicted(id, reasons[i])
+	}
+}
+
+// closeSubscribers unregisters the given subscribers and closes their channels,
+// waiting for in-flight fan-outs to complete first.
+//
+// Returns:
+//   - []string: the IDs that were registered and closed.
+func (b *Broadcaster) closeSubscribers(ids []string) []string {
+	b.signalLeaving(ids...)
+
+	b.closeMu.Lock()
+	defer b.closeMu.Unlock()
+	b.subscribersMu.Lock()
+	defer b.subscribersMu.Unlock()
+
+	return b.closeLocked(ids)
+}
+
+// load returns the current subscriber map snapshot, which must not be modified.
+func (b *Broadcaster) load() map[string]*subscriber {
+	return b.subscribers.Load().(map[string]*subscriber)
+}
+
+// updateLocked copies the subscriber map, applies fn to the copy and publishes
+// it, invalidating the handles of the removed or replaced entries. The caller
+// must hold subscribersMu.
+func (b *Broadcaster) updateLocked(fn func(next map[string]*subscriber)) {
+	current := b.load()
+	next := make(map[string]*subscriber, len(current)+1)
+	for id, sub := range current {
+		next[id] = sub
+	}
+	fn(next)
+	for id, sub := range current {
+		if next[id] != sub {
+			sub.valid.Store(false)
+			if sub.mem != nil {
+				b.memUsed.Add(-sub.mem.reset())
+			}
+		}
+	}
+	b.subscribers.Store(next)
+	b.subscribersChangedLocked(len(next))
+}
+
+// subscribersChangedLocked updates the subscriber count after the subscriber
+// map changed, wakes up WaitForSubscribers and notifies the thresholds it
+// crossed. Transitions between no subscribers and some subscribers are logged;
+// they are the crossings of threshold 0. The caller must hold subscribersMu.
+func (b *Broadcaster) subscribersChangedLocked(count int) {
+	close(b.countChanged)
+	b.countChanged = make(chan struct{})
+
+	prev := int(b.subscriberCount.Swap(int64(count)))
+	b.metrics.Subscribers.Add(float64(count - prev))
+	switch {
+	case prev == 0 && count > 0:
+		b.logger.Info("first subscriber registered", zap.Int("subscriber_count", count))
+	case prev > 0 && count == 0:
+		b.logger.Info("last subscriber unregistered")
+	}
+	for _, n := range b.countNotifiers {
+		if (prev > n.threshold) == (count > n.threshold) {
+			continue
+		}
+		select {
+		case n.ch <- count:
+		default:
+		}
+	}
+}
+
+// closeLocked closes the channels of the given registered subscribers and
+// removes them from the subscriber map with a single update. The caller must
+// hold closeMu for writing, so no fan-out is sending, and subscribersMu. Since
+// a channel is closed and removed in the same critical section, it is closed
+// at most once; unknown IDs are ignored.
+//
+// Returns:
+//   - []string: the IDs that were registered and closed.
+func (b *Broadcaster) closeLocked(ids []string) []string {
+	current := b.load()
+	closed := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if sub, ok := current[id]; ok {
+			sub.close()
+			closed = append(closed, id)
+		}
+	}
+	if len(closed) == 0 {
+		return nil
+	}
+
+	b.updateLocked(func(next map[string]*subscriber) {
+		for _, id := range closed {
+			delete(next, id)
+		}
+	})
+	for _, id := range closed {
+		b.cfg.onUnregister(id)
+		b.deleteSubscriberSeries(id)
+	}
+	b.signalLeaving(closed...)
+	return closed
+}
+
+// signalLeaving closes the leaving channel of the given subscribers, or of all
+// subscribers if no ID is given. It must be called without holding closeMu
+// when used to unblock lossless sends, which hold it for reading.
+func (b *Broadcaster) signalLeaving(ids ...string) {
+	b.leavingMu.Lock()
+	defer b.leavingMu.Unlock()
+
+	if len(ids) == 0 {
+		for id := range b.leaving {
+			ids = append(ids, id)
+		}
+	}
+	for _, id := range ids {
+		if ch, ok := b.leaving[id]; ok {
+			close(ch)
+			delete(b.leaving, id)
+		}
+	}
+}
+
+// leavingChan returns the channel closed when the subscriber starts
+// unregistering, or an already closed channel if it is already leaving.
+func (b *Broadcaster) leavingChan(id string) <-chan struct{} {
+	b.leavingMu.Lock()
+	defer b.leavingMu.Unlock()
+	if ch, ok := b.leaving[id]; ok {
+		return ch
+	}
+	return closedChan
+}
+
+// drop accounts for a message dropped for subscriber sub, registered as id: it
+// updates the drop counters, records the message in the dead-letter queue and
+// calls the WithOnDrop hook.
+func (b *Broadcaster) drop(id string, sub *subscriber, msg *gen.Metrics) {
+	b.totalDropped.Add(1)
+	sub.series.Load().dropped.Inc()
+	b.deadLetter(id, msg)
+	b.notifyDrop(id, msg)
+}
+
+// notifyDrop calls the WithOnDrop hook, if set, from its own goroutine. While
+// onDropConcurrency hooks are running, it waits for one of them to return.
+func (b *Broadcaster) notifyDrop(id string, msg *gen.Metrics) {
+	if b.onDropSem == nil {
+		return
+	}
+	b.onDropSem <- struct{}{}
+	go func() {
+		defer func() { <-b.onDropSem }()
+		b.cfg.onDrop(id, msg)
+	}()
+}
+
+// deadLetter records a dropped message, if the dead-letter queue is enabled.
+func (b *Broadcaster) deadLetter(id string, msg *gen.Metrics) {
+	if b.deadLetters == nil {
+		return
+	}
+	b.deadLetters.Add(DeadLetter{SubscriberID: id, Message: msg, DroppedAt: time.Now()})
+}
+
+// isDuplicate reports whether msg was already broadcast within the
+// deduplication window, and records it otherwise.
+func (b *Broadcaster) isDuplicate(msg *gen.Metrics) bool {
+	if b.cfg.dedupWindow <= 0 {
+		return false
+	}
+
+	key := dedupKey{hostname: msg.GetNodeMetrics().GetHostname(), timestamp: msg.GetTimestamp()}
+	now := time.Now()
+
+	b.dedupMu.Lock()
+	defer b.dedupMu.Unlock()
+
+	for k, seen := range b.dedupSeen {
+		if now.Sub(seen) > b.cfg.dedupWindow {
+			delete(b.dedupSeen, k)
+		}
+	}
+
+	if _, ok := b.dedupSeen[key]; ok {
+		return true
+	}
+	b.dedupSeen[key] = now
+	return false
+}
+
+// record assigns the next sequence number to msg and appends it to the replay
+// buffer, if enabled. The sequence number is taken under the replay lock so that
+// the buffer is ordered by sequence.
+func (b *Broadcaster) record(msg *gen.Metrics) {
+	if b.cfg.replayBufferSize <= 0 {
+		b.sequence.Add(1)
+		return
+	}
+
+	b.replayMu.Lock()
+	defer b.replayMu.Unlock()
+
+	entry := replayEntry{seq: b.sequence.Add(1), msg: msg}
+	if len(b.replay) == b.cfg.replayBufferSize {
+		copy(b.replay, b.replay[1:])
+		b.replay[len(b.replay)-1] = entry
+		return
+	}
+	b.replay = append(b.replay, entry)
+}
+
+// copyFor returns the message to deliver to a single subscriber: a deep copy
+// of msg with WithMessageCloning, msg itself otherwise.
+func (b *Broadcaster) copyFor(msg *gen.Metrics) *gen.Metrics {
+	if !b.cfg.cloneMessages {
+		return msg
+	}
+	clone := proto.Clone(msg).(*gen.Metrics)
+	copyRequestID(msg, clone)
+	return clone
+}
+
+// replayToLocked queues the buffered messages newer than afterSeq on the
+// subscriber without blocking. The caller must hold replayMu.
+//
+// Returns:
+//   - int: number of messages queued.
+func (b *Broadcaster) replayToLocked(sub *subscriber, afterSeq uint64) int {
+	queued := 0
+	for _, entry := range b.replay {
+		if entry.seq <= afterSeq {
+			continue
+		}
+		if sub.ring != nil {
+			// Older entries are overwritten if the ring is smaller than the replay buffer
+			sub.ring.Send(b.copyFor(entry.msg))
+			b.trackReplayed(sub, entry.msg)
+			queued++
+			continue
+		}
+		select {
+		case sub.ch <- b.copyFor(entry.msg):
+			b.trackReplayed(sub, entry.msg)
+			queued++
+		default:
+			return queued
 		}
 	}
+	return queued
 }
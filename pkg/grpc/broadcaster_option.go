@@ -0,0 +1,482 @@
+package grpc
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/kubensage/relay/proto/gen"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// SlowSubscriberPolicy defines what the Broadcaster does when a subscriber's
+// channel is full at broadcast time.
+type SlowSubscriberPolicy int
+
+const (
+	// PolicyDropNewest drops the message being broadcast (default).
+	PolicyDropNewest SlowSubscriberPolicy = iota
+	// PolicyDropOldest discards the oldest queued message to make room for the new one.
+	PolicyDropOldest
+	// PolicyDisconnect unregisters the subscriber and closes its channel.
+	PolicyDisconnect
+)
+
+// String implements fmt.Stringer.
+func (p SlowSubscriberPolicy) String() string {
+	switch p {
+	case PolicyDropNewest:
+		return "drop-newest"
+	case PolicyDropOldest:
+		return "drop-oldest"
+	case PolicyDisconnect:
+		return "disconnect"
+	default:
+		return "unknown"
+	}
+}
+
+// BroadcasterOption configures optional Broadcaster behavior.
+type BroadcasterOption func(*broadcasterConfig)
+
+// broadcasterConfig holds the tunables set through BroadcasterOption values.
+// The zero value keeps the default behavior: no logging, no replay, no
+// deduplication, no dead-letter queue, inline fan-out and PolicyDropNewest.
+type broadcasterConfig struct {
+	logger               *zap.Logger                     // Logger for observability (nil = zap.NewNop())
+	replayBufferSize     int                             // Number of recent messages replayed to new subscribers (0 = disabled)
+	dedupWindow          time.Duration                   // Window in which repeated messages are dropped (0 = disabled)
+	deadLetterCapacity   int                             // Number of dropped messages retained for inspection (0 = disabled)
+	workerPoolSize       int                             // Number of fan-out workers (0 = fan-out inline)
+	slowSubscriberPolicy SlowSubscriberPolicy            // Behavior when a subscriber channel is full
+	filter               func(*gen.Metrics) bool         // Messages it rejects are discarded before fan-out (nil = disabled)
+	transformer          func(*gen.Metrics) *gen.Metrics // Applied to every message before fan-out (nil = disabled)
+	watermarkLow         int                             // Channel fill at which a back-pressured subscriber resumes
+	watermarkHigh        int                             // Channel fill at which a subscriber is back-pressured (0 = disabled)
+	broadcastTimeout     time.Duration                   // Maximum wait on a full subscriber channel (0 = drop immediately)
+	subscriberCap        int                             // Maximum number of registered subscribers (0 = unlimited)
+	lossless             bool                            // Block on full subscriber channels instead of dropping
+	ringBufferSize       int                             // Capacity of SubscribeMetrics ring buffers (0 = use channels)
+	registerer           prometheus.Registerer           // Registerer of the broadcaster metrics (nil = prometheus.DefaultRegisterer)
+	cloneMessages        bool                            // Deliver a deep copy of every message to each subscriber
+	webhookURL           string                          // Endpoint receiving every broadcast message ("" = disabled)
+	webhookClient        *http.Client                    // HTTP client of the webhook requests
+	webhookRetries       int                             // Retries of a failed webhook post
+	pauseBufferSize      int                             // Messages held while paused (0 = discard them)
+	memoryLimit          int64                           // Approximate bytes queued on all subscribers (0 = unlimited)
+	onDrop               func(string, *gen.Metrics)      // Called for every message dropped for a subscriber (nil = disabled)
+	onRegister           func(string)                    // Called for every registered subscriber (nil = log it)
+	onUnregister         func(string)                    // Called for every removed subscriber (nil = log it)
+	onBroadcast          func(sent, dropped int)         // Called with the delivery counts of every fan-out (nil = disabled)
+	lockProfileThreshold time.Duration                   // Fan-out lock hold time above which a warning is logged (0 = no lock profiling)
+
+	onEvict               func(string, EvictionReason) // Called for every evicted subscriber (nil = disabled)
+	subscriberIdleTimeout time.Duration                // Time a subscriber channel may stay full before eviction (0 = never)
+	clock                 clock                        // Time source of the idle eviction (nil = realClock)
+}
+
+// WithLogger sets the logger of the Broadcaster, also used by the webhook
+// forwarder. Without it, nothing is logged.
+//
+// Parameters:
+//   - logger: zap.Logger for observability.
+func WithLogger(logger *zap.Logger) BroadcasterOption {
+	return func(c *broadcasterConfig) {
+		c.logger = logger
+	}
+}
+
+// WithReplayBuffer keeps the last size broadcast messages and replays them to
+// every newly registered subscriber.
+//
+// Parameters:
+//   - size: number of messages to retain (0 = disabled).
+func WithReplayBuffer(size int) BroadcasterOption {
+	return func(c *broadcasterConfig) {
+		c.replayBufferSize = size
+	}
+}
+
+// WithDeduplication drops messages with the same hostname and collection
+// timestamp as a message already broadcast within the given window.
+//
+// Parameters:
+//   - window: deduplication window (0 = disabled).
+func WithDeduplication(window time.Duration) BroadcasterOption {
+	return func(c *broadcasterConfig) {
+		c.dedupWindow = window
+	}
+}
+
+// WithDeadLetterCapacity retains up to n dropped messages, retrievable through
+// Broadcaster.DeadLetters. When full, the oldest dead letter is overwritten.
+//
+// Parameters:
+//   - n: dead-letter queue capacity (0 = disabled).
+func WithDeadLetterCapacity(n int) BroadcasterOption {
+	return func(c *broadcasterConfig) {
+		c.deadLetterCapacity = n
+	}
+}
+
+// WithWorkerPool fans out each broadcast across a fixed pool of worker
+// goroutines instead of sending to subscribers inline. The workers stop when
+// the context passed to NewBroadcaster is done.
+//
+// Parameters:
+//   - size: number of workers (0 = inline fan-out).
+func WithWorkerPool(size int) BroadcasterOption {
+	return func(c *broadcasterConfig) {
+		c.workerPoolSize = size
+	}
+}
+
+// WithSlowSubscriberPolicy sets the behavior applied when a subscriber channel is full.
+//
+// Parameters:
+//   - p: the policy to apply.
+func WithSlowSubscriberPolicy(p SlowSubscriberPolicy) BroadcasterOption {
+	return func(c *broadcasterConfig) {
+		c.slowSubscriberPolicy = p
+	}
+}
+
+// WithMessageFilter discards every broadcast message for which fn returns
+// false, for all subscribers at once, before the transformer and the fan-out.
+// Discarded messages are counted in relay_messages_filtered_total and in
+// BroadcasterStats.TotalFiltered.
+//
+// Like the transformer, fn runs without any Broadcaster lock held and must be
+// safe for concurrent use.
+//
+// Parameters:
+//   - fn: the filter function; true keeps the message.
+func WithMessageFilter(fn func(*gen.Metrics) bool) BroadcasterOption {
+	return func(c *broadcasterConfig) {
+		c.filter = fn
+	}
+}
+
+// WithMessageTransformer applies fn to every broadcast message before fan-out,
+// e.g. to enrich it with relay-specific data. The returned message is the one
+// delivered to subscribers; if fn returns nil, the message is dropped.
+//
+// fn runs without any Broadcaster lock held, so it may be expensive, but it must
+// be safe for concurrent use when several goroutines broadcast at once.
+//
+// Parameters:
+//   - fn: the transformation function.
+func WithMessageTransformer(fn func(*gen.Metrics) *gen.Metrics) BroadcasterOption {
+	return func(c *broadcasterConfig) {
+		c.transformer = fn
+	}
+}
+
+// WithWatermark enables watermark-based back-pressure. Once a subscriber's
+// channel holds high messages, Broadcast skips it entirely (counting each skipped
+// message as dropped) until the channel drains to low messages.
+//
+// Parameters:
+//   - low: fill level at which delivery resumes; must be lower than high.
+//   - high: fill level at which delivery stops (0 = disabled).
+func WithWatermark(low, high int) BroadcasterOption {
+	return func(c *broadcasterConfig) {
+		c.watermarkLow = low
+		c.watermarkHigh = high
+	}
+}
+
+// WithBroadcastTimeout makes Broadcast wait up to d for room in a full
+// subscriber channel before applying the SlowSubscriberPolicy.
+//
+// The wait delays subscriber disconnects and UnregisterAll, which wait for
+// in-flight fan-outs before closing channels. With inline
+// fan-out, slow subscribers are waited on one after the other, so a broadcast
+// can take up to d per slow subscriber; combine with WithWorkerPool to wait on
+// them in parallel.
+//
+// Parameters:
+//   - d: maximum wait per subscriber (0 = drop immediately).
+func WithBroadcastTimeout(d time.Duration) BroadcasterOption {
+	return func(c *broadcasterConfig) {
+		c.broadcastTimeout = d
+	}
+}
+
+// WithSubscriberCap limits the number of registered subscribers. Register
+// returns ErrSubscriberCapReached once n subscribers are registered.
+//
+// Parameters:
+//   - n: maximum number of subscribers (0 = unlimited).
+func WithSubscriberCap(n int) BroadcasterOption {
+	return func(c *broadcasterConfig) {
+		c.subscriberCap = n
+	}
+}
+
+// WithLosslessSend makes every broadcast behave like BroadcastLossless: sends to
+// a full subscriber channel block until the subscriber has room or leaves, and
+// only the broadcast context (the one passed to NewBroadcaster for Broadcast and
+// BroadcastBatch) bounds the wait. A single stalled subscriber therefore stalls
+// the producers.
+func WithLosslessSend() BroadcasterOption {
+	return func(c *broadcasterConfig) {
+		c.lossless = true
+	}
+}
+
+// WithRingBuffer makes SubscribeMetrics deliver through a ring buffer of the
+// given size (see Broadcaster.RegisterRing) instead of a channel: when a
+// subscriber falls behind, the oldest queued message is overwritten so the
+// newest data is always delivered. Consumer group members keep using channels.
+//
+// Parameters:
+//   - size: ring buffer capacity per subscriber (0 = use channels).
+func WithRingBuffer(size int) BroadcasterOption {
+	return func(c *broadcasterConfig) {
+		c.ringBufferSize = size
+	}
+}
+
+// WithMessageCloning delivers a deep copy (proto.Clone) of every message,
+// broadcast or replayed, to each subscriber instead of sharing a single
+// instance, so that a subscriber modifying a received message cannot race with
+// the others. It costs one copy per message and subscriber.
+func WithMessageCloning() BroadcasterOption {
+	return func(c *broadcasterConfig) {
+		c.cloneMessages = true
+	}
+}
+
+// WithMetrics registers the broadcaster metrics (dropped messages per
+// subscriber, broadcast and sent messages, registered subscribers and fan-out
+// duration) on reg instead of prometheus.DefaultRegisterer, e.g. a
+// prometheus.NewRegistry() to isolate broadcaster instances from each other. Broadcasters using the same registerer,
+// including the per-cluster topics of a MetricsServer, share the same metrics.
+//
+// Parameters:
+//   - reg: the registerer to register the metrics on.
+func WithMetrics(reg prometheus.Registerer) BroadcasterOption {
+	return func(c *broadcasterConfig) {
+		c.registerer = reg
+	}
+}
+
+// WithWebhookForwarder posts every broadcast message, JSON-encoded with
+// protojson, to url after the local fan-out. Requests are made by a separate
+// goroutine, stopped when the context passed to NewBroadcaster is done, so they
+// never block a broadcast; up to 100 messages wait to be posted, and further
+// ones are dropped with a warning. A failed post (transport error or non-2xx
+// status) is retried up to retries times with exponential backoff starting at
+// 100ms, then dropped with a warning.
+//
+// Parameters:
+//   - url: endpoint receiving the messages.
+//   - client: HTTP client used for the requests (nil = http.DefaultClient).
+//   - retries: number of retries of a failed post.
+func WithWebhookForwarder(url string, client *http.Client, retries int) BroadcasterOption {
+	return func(c *broadcasterConfig) {
+		c.webhookURL = url
+		c.webhookClient = client
+		c.webhookRetries = retries
+	}
+}
+
+// WithPauseBuffer sets how many messages broadcast while the broadcaster is
+// paused (see Broadcaster.PauseAll) are held for delivery on ResumeAll. Only
+// agent streams already open are held: new ones are rejected, and told when to
+// retry with WithPausedRetryAfter.
+//
+// Parameters:
+//   - size: pause buffer capacity (0 = discard messages broadcast while paused).
+func WithPauseBuffer(size int) BroadcasterOption {
+	return func(c *broadcasterConfig) {
+		c.pauseBufferSize = size
+	}
+}
+
+// WithMemoryLimit bounds the approximate memory held by the messages queued on
+// all subscribers, measured as their encoded size (proto.Size). When queuing a
+// message would exceed the limit, the queue of the oldest-registered subscriber
+// holding messages is flushed: its queued messages are drained and counted as
+// dropped, and the next oldest follows until the message fits. A message larger
+// than the limit on its own is dropped.
+//
+// Only the messages queued by broadcasts and replays are accounted; messages
+// queued through SubscriberHandle.Send are not. See Broadcaster.QueuedBytes.
+//
+// Parameters:
+//   - bytes: memory limit in bytes (0 = unlimited).
+func WithMemoryLimit(bytes int64) BroadcasterOption {
+	return func(c *broadcasterConfig) {
+		c.memoryLimit = bytes
+	}
+}
+
+// WithOnDrop calls fn with the subscriber ID and the message every time a
+// message is dropped for a subscriber, in addition to the drop counters and the
+// warning log, e.g. to route dropped messages to secondary storage. Messages
+// overwritten in a ring buffer (WithRingBuffer) are only counted, as the
+// overwritten message is not known.
+//
+// Each call runs in its own goroutine so that fn does not delay the fan-out. At
+// most 100 calls run at once; beyond that, the dropping broadcast waits for one
+// of them to return, so a slow fn eventually slows down broadcasts instead of
+// piling up goroutines.
+//
+// Parameters:
+//   - fn: the hook; it must be safe for concurrent use.
+func WithOnDrop(fn func(subscriberID string, msg *gen.Metrics)) BroadcasterOption {
+	return func(c *broadcasterConfig) {
+		c.onDrop = fn
+	}
+}
+
+// WithOnRegister calls fn with the subscriber ID every time a subscriber is
+// registered, including when it replaces a registration of the same ID. It
+// replaces the default hook, which logs the registration.
+//
+// fn is called synchronously right after the subscriber map is updated, while
+// the subscriber lock is held: it must be fast and must not call back into the
+// Broadcaster.
+//
+// Parameters:
+//   - fn: the hook.
+func WithOnRegister(fn func(id string)) BroadcasterOption {
+	return func(c *broadcasterConfig) {
+		c.onRegister = fn
+	}
+}
+
+// WithOnUnregister calls fn with the subscriber ID every time a subscriber is
+// removed: by Unregister, UnregisterAll, a slow-subscriber disconnect or the end
+// of a Subscribe subscription. Unregistering an unknown ID does not call fn. It
+// replaces the default hook, which logs the removal.
+//
+// fn is called synchronously as WithOnRegister hooks are, under the same
+// constraints.
+//
+// Parameters:
+//   - fn: the hook.
+func WithOnUnregister(fn func(id string)) BroadcasterOption {
+	return func(c *broadcasterConfig) {
+		c.onUnregister = fn
+	}
+}
+
+// WithBroadcastCallback calls fn with the sent and dropped counts (see
+// Broadcaster.Broadcast) at the end of every broadcast that reaches the
+// fan-out, e.g. to feed monitoring or a circuit breaker. A batch
+// (BroadcastBatch, ResumeAll) reports its counts over all of its messages in a
+// single call; broadcasts whose messages are all filtered, deduplicated or held
+// while paused do not call fn.
+//
+// fn runs synchronously on the broadcasting goroutine, after the fan-out
+// released its lock: it must be fast, well under a microsecond, as it delays
+// the caller of Broadcast. It must be safe for concurrent use.
+//
+// Parameters:
+//   - fn: the callback.
+func WithBroadcastCallback(fn func(sent, dropped int)) BroadcasterOption {
+	return func(c *broadcasterConfig) {
+		c.onBroadcast = fn
+	}
+}
+
+// WithLockProfiling measures how long every fan-out holds the read lock that
+// keeps subscriber channels from being closed, which delays UnregisterAll,
+// slow-subscriber disconnects and replaced registrations. Each hold time is
+// observed in relay_broadcast_lock_held_seconds, and a warning with the
+// subscriber count is logged when it exceeds threshold.
+//
+// Parameters:
+//   - threshold: hold time above which a warning is logged (0 = disabled).
+func WithLockProfiling(threshold time.Duration) BroadcasterOption {
+	return func(c *broadcasterConfig) {
+		c.lockProfileThreshold = threshold
+	}
+}
+
+// WithSubscriberEvictionHook calls fn with the ID of every subscriber the
+// Broadcaster evicts and the reason of the eviction: a channel full under
+// PolicyDisconnect (ReasonCapacityExceeded), a channel full for longer than
+// WithSubscriberIdleTimeout (ReasonIdleTimeout) or Broadcaster.Evict
+// (ReasonManualEviction). Subscribers that unregister themselves, and those
+// closed by UnregisterAll, are not evictions.
+//
+// fn runs synchronously on the evicting goroutine, once the subscriber is
+// unregistered and its channel closed, and after the onUnregister hook (see
+// WithOnUnregister). No Broadcaster lock is held, but evictions during a
+// broadcast delay its caller until fn returns. It must be safe for concurrent
+// use.
+//
+// Parameters:
+//   - fn: the hook.
+func WithSubscriberEvictionHook(fn func(id string, reason EvictionReason)) BroadcasterOption {
+	return func(c *broadcasterConfig) {
+		c.onEvict = fn
+	}
+}
+
+// WithSubscriberIdleTimeout evicts subscribers that stop receiving: a
+// subscriber whose channel is found full by a broadcast, and has not been
+// found with room since at least d, is unregistered and its channel closed,
+// whatever the SlowSubscriberPolicy. The message being broadcast is dropped.
+//
+// Idleness is only detected by broadcasts, and never applies to lossless
+// broadcasts or ring buffer subscribers, which never find a queue full.
+//
+// Parameters:
+//   - d: time a subscriber channel may stay full (0 = never evict idle subscribers).
+func WithSubscriberIdleTimeout(d time.Duration) BroadcasterOption {
+	return func(c *broadcasterConfig) {
+		c.subscriberIdleTimeout = d
+	}
+}
+
+// SubscriberOption configures a subscriber created with Broadcaster.Subscribe.
+type SubscriberOption func(*subscriberConfig)
+
+// subscriberConfig holds the settings set through SubscriberOption values.
+type subscriberConfig struct {
+	channelSize int      // Capacity of the subscriber channel
+	afterSeq    uint64   // Only replay buffered messages after this sequence number (0 = replay all)
+	groups      []string // Groups the subscriber is tagged with
+}
+
+// WithChannelSize sets the capacity of the subscriber channel (default 100).
+//
+// Parameters:
+//   - n: channel capacity.
+func WithChannelSize(n int) SubscriberOption {
+	return func(c *subscriberConfig) {
+		c.channelSize = n
+	}
+}
+
+// WithGroups tags the subscriber with the given group IDs, so that it also
+// receives the messages broadcast to those groups with
+// Broadcaster.BroadcastToGroup. Empty group IDs are ignored.
+//
+// Parameters:
+//   - groups: group IDs of the subscriber.
+func WithGroups(groups ...string) SubscriberOption {
+	return func(c *subscriberConfig) {
+		for _, g := range groups {
+			if g != "" {
+				c.groups = append(c.groups, g)
+			}
+		}
+	}
+}
+
+// WithReplayAfter only replays the buffered messages with a sequence number
+// greater than seq, as in Broadcaster.RegisterAfter.
+//
+// Parameters:
+//   - seq: sequence number of the last message already received.
+func WithReplayAfter(seq uint64) SubscriberOption {
+	return func(c *subscriberConfig) {
+		c.afterSeq = seq
+	}
+}
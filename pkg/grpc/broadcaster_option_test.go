@@ -0,0 +1,526 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kubensage/relay/proto/gen"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestBroadcasterOptionsDefaultToDisabled(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	cfg := b.cfg
+	if cfg.replayBufferSize != 0 || cfg.dedupWindow != 0 || cfg.deadLetterCapacity != 0 ||
+		cfg.workerPoolSize != 0 || cfg.slowSubscriberPolicy != PolicyDropNewest {
+		t.Fatalf("default config: got %+v, want every tunable disabled", cfg)
+	}
+}
+
+func TestReplayBufferReplaysToNewSubscribers(t *testing.T) {
+	b := newTestBroadcaster(t, nil, WithReplayBuffer(2))
+	for _, host := range []string{"a", "b", "c"} {
+		b.Broadcast(hostMetrics(host))
+	}
+
+	ch := make(chan *gen.Metrics, 4)
+	if _, err := b.Register("late", ch); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"b", "c"} {
+		if got := receive(t, ch).GetNodeMetrics().GetHostname(); got != want {
+			t.Fatalf("replayed message: got %q, want %q", got, want)
+		}
+	}
+	if len(ch) != 0 {
+		t.Fatalf("replayed %d messages beyond the buffer size", len(ch))
+	}
+}
+
+func TestDeduplicationDropsRepeatedMessages(t *testing.T) {
+	b := newTestBroadcaster(t, nil, WithDeduplication(time.Minute))
+	ch := make(chan *gen.Metrics, 4)
+	if _, err := b.Register("sub", ch); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := hostMetrics("node")
+	msg.Timestamp = 42
+	b.Broadcast(msg)
+	b.Broadcast(msg)
+	if len(ch) != 1 {
+		t.Fatalf("queued messages: got %d, want the duplicate dropped", len(ch))
+	}
+	if got := b.Stats().TotalDeduplicated; got != 1 {
+		t.Fatalf("deduplicated count: got %d, want 1", got)
+	}
+}
+
+func TestDeadLetterCapacityRetainsDroppedMessages(t *testing.T) {
+	b := newTestBroadcaster(t, nil, WithDeadLetterCapacity(2))
+	if _, err := b.Register("full", make(chan *gen.Metrics)); err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range []string{"a", "b", "c"} {
+		b.Broadcast(hostMetrics(host))
+	}
+
+	letters := b.DeadLetters()
+	if len(letters) != 2 {
+		t.Fatalf("dead letters: got %d, want the capacity of 2", len(letters))
+	}
+	for i, want := range []string{"b", "c"} {
+		if got := letters[i]; got.SubscriberID != "full" || got.Message.GetNodeMetrics().GetHostname() != want {
+			t.Fatalf("dead letter %d: got %s/%q, want full/%q", i, got.SubscriberID, got.Message.GetNodeMetrics().GetHostname(), want)
+		}
+	}
+}
+
+func TestWorkerPoolDeliversToEverySubscriber(t *testing.T) {
+	b := newTestBroadcaster(t, nil, WithWorkerPool(4))
+	chs := make([]chan *gen.Metrics, 8)
+	for i := range chs {
+		chs[i] = make(chan *gen.Metrics, 1)
+		if _, err := b.Register(fmt.Sprintf("sub-%d", i), chs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b.Broadcast(hostMetrics("node"))
+	for _, ch := range chs {
+		receive(t, ch)
+	}
+}
+
+func TestSlowSubscriberPolicyDropOldest(t *testing.T) {
+	b := newTestBroadcaster(t, nil, WithSlowSubscriberPolicy(PolicyDropOldest))
+	ch := make(chan *gen.Metrics, 1)
+	if _, err := b.Register("slow", ch); err != nil {
+		t.Fatal(err)
+	}
+
+	b.Broadcast(hostMetrics("old"))
+	b.Broadcast(hostMetrics("new"))
+	if got := receive(t, ch).GetNodeMetrics().GetHostname(); got != "new" {
+		t.Fatalf("queued message: got %q, want the newest", got)
+	}
+}
+
+func TestMessageTransformerEnrichesOrDropsMessages(t *testing.T) {
+	b := newTestBroadcaster(t, nil, WithMessageTransformer(func(msg *gen.Metrics) *gen.Metrics {
+		if msg.GetNodeMetrics().GetHostname() == "drop" {
+			return nil
+		}
+		return hostMetrics("relay/" + msg.GetNodeMetrics().GetHostname())
+	}))
+	ch := make(chan *gen.Metrics, 2)
+	if _, err := b.Register("sub", ch); err != nil {
+		t.Fatal(err)
+	}
+
+	b.Broadcast(hostMetrics("drop"))
+	b.Broadcast(hostMetrics("node"))
+	if got := receive(t, ch).GetNodeMetrics().GetHostname(); got != "relay/node" {
+		t.Fatalf("delivered message: got host %q, want the transformed relay/node", got)
+	}
+	if len(ch) != 0 {
+		t.Fatal("message the transformer dropped was delivered")
+	}
+}
+
+func TestWatermarkSkipsBackpressuredSubscriber(t *testing.T) {
+	b := newTestBroadcaster(t, nil, WithWatermark(1, 3))
+	ch := make(chan *gen.Metrics, 10)
+	if _, err := b.Register("sub", ch); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 4 {
+		b.Broadcast(hostMetrics("node"))
+	}
+	if len(ch) != 3 || !b.IsBackpressured("sub") {
+		t.Fatalf("above the high watermark: %d queued, back-pressured %v; want 3 queued and back-pressured", len(ch), b.IsBackpressured("sub"))
+	}
+
+	<-ch
+	b.Broadcast(hostMetrics("node"))
+	if len(ch) != 2 {
+		t.Fatalf("above the low watermark: got %d queued, want the broadcast skipped", len(ch))
+	}
+
+	<-ch
+	b.Broadcast(hostMetrics("node"))
+	if len(ch) != 2 || b.IsBackpressured("sub") {
+		t.Fatalf("at the low watermark: %d queued, back-pressured %v; want the broadcast delivered", len(ch), b.IsBackpressured("sub"))
+	}
+}
+
+func TestBroadcastTimeoutBoundsSendsToFullChannels(t *testing.T) {
+	const timeout = 10 * time.Millisecond
+	b := newTestBroadcaster(t, nil, WithBroadcastTimeout(timeout))
+	if _, err := b.Register("full", make(chan *gen.Metrics)); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	sent, dropped := b.BroadcastWithContext(t.Context(), hostMetrics("node"))
+	if d := time.Since(start); d < timeout || d > 50*timeout {
+		t.Fatalf("broadcast took %v, want about %v", d, timeout)
+	}
+	if sent != 0 || dropped != 1 {
+		t.Fatalf("sent %d, dropped %d; want the message dropped after the timeout", sent, dropped)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	start = time.Now()
+	if _, dropped := b.BroadcastWithContext(ctx, hostMetrics("node")); dropped != 1 || time.Since(start) >= timeout {
+		t.Fatalf("canceled broadcast: dropped %d after %v, want an immediate drop", dropped, time.Since(start))
+	}
+}
+
+func TestSubscriberCapRejectsRegistrationsBeyondIt(t *testing.T) {
+	b := newTestBroadcaster(t, nil, WithSubscriberCap(2))
+	for _, id := range []string{"a", "b"} {
+		if _, err := b.Register(id, make(chan *gen.Metrics, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := b.Register("c", make(chan *gen.Metrics, 1)); !errors.Is(err, ErrSubscriberCapReached) {
+		t.Fatalf("registration beyond the cap: got %v, want ErrSubscriberCapReached", err)
+	}
+	if n := b.SubscriberCount(); n != 2 {
+		t.Fatalf("subscriber count: got %d, want the cap of 2", n)
+	}
+	if _, err := b.Register("a", make(chan *gen.Metrics, 1)); err != nil {
+		t.Fatalf("re-registering an existing ID at the cap: %v", err)
+	}
+}
+
+func TestLosslessSendBlocksUntilChannelDrains(t *testing.T) {
+	b := newTestBroadcaster(t, nil, WithLosslessSend())
+	ch := make(chan *gen.Metrics, 1)
+	if _, err := b.Register("slow", ch); err != nil {
+		t.Fatal(err)
+	}
+	b.Broadcast(hostMetrics("first"))
+
+	done := make(chan int, 1)
+	go func() {
+		_, dropped := b.Broadcast(hostMetrics("second"))
+		done <- dropped
+	}()
+	select {
+	case <-done:
+		t.Fatal("broadcast to a full channel returned instead of blocking")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	for _, want := range []string{"first", "second"} {
+		if got := receive(t, ch).GetNodeMetrics().GetHostname(); got != want {
+			t.Fatalf("received %q, want %q", got, want)
+		}
+	}
+	if dropped := <-done; dropped != 0 {
+		t.Fatalf("lossless broadcast dropped %d messages", dropped)
+	}
+}
+
+func TestBroadcastLosslessReturnsUndeliveredMessages(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	if _, err := b.Register("full", make(chan *gen.Metrics)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+	msg := hostMetrics("node")
+	undelivered, err := b.BroadcastLossless(ctx, msg)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error: got %v, want context.DeadlineExceeded", err)
+	}
+	if len(undelivered) != 1 || undelivered[0].GetNodeMetrics().GetHostname() != "node" {
+		t.Fatalf("undelivered: got %v, want the message once", undelivered)
+	}
+}
+
+func TestWithMetricsRegistersOnTheGivenRegistry(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	b := NewBroadcaster(t.Context(), WithMetrics(reg))
+	// A second broadcaster reuses the collectors instead of panicking
+	other := NewBroadcaster(t.Context(), WithMetrics(reg))
+
+	if _, err := b.Register("sub", make(chan *gen.Metrics)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Register("other", make(chan *gen.Metrics, 1)); err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		b.Broadcast(&gen.Metrics{})
+	}
+
+	for name, want := range map[string]int{
+		"relay_broadcast_messages_total":          1,
+		"relay_broadcaster_subscribers":           1,
+		"relay_subscriber_dropped_messages_total": 2,
+	} {
+		n, err := testutil.GatherAndCount(reg, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Fatalf("%s: got %d series, want %d", name, n, want)
+		}
+	}
+	if got := testutil.ToFloat64(b.metrics.BroadcastMessages); got != 3 {
+		t.Fatalf("broadcast messages: got %v, want 3", got)
+	}
+	if got := testutil.ToFloat64(b.metrics.Subscribers); got != 2 {
+		t.Fatalf("subscribers: got %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(b.metrics.SubscriberDroppedMessages.WithLabelValues(defaultTopic, "sub")); got != 3 {
+		t.Fatalf("dropped messages: got %v, want 3", got)
+	}
+}
+
+func TestMessageCloningIsolatesSubscribers(t *testing.T) {
+	b := newTestBroadcaster(t, nil, WithMessageCloning())
+	first, second := make(chan *gen.Metrics, 1), make(chan *gen.Metrics, 1)
+	for id, ch := range map[string]chan *gen.Metrics{"first": first, "second": second} {
+		if _, err := b.Register(id, ch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msg := hostMetrics("node")
+	b.Broadcast(msg)
+
+	// Both subscribers modify their copy concurrently: the race detector
+	// reports shared instances
+	var wg sync.WaitGroup
+	for i, ch := range []chan *gen.Metrics{first, second} {
+		got := receive(t, ch)
+		if got == msg {
+			t.Fatal("a subscriber received the broadcast instance")
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got.NodeMetrics.Hostname = fmt.Sprintf("modified-%d", i)
+		}()
+	}
+	wg.Wait()
+	if host := msg.GetNodeMetrics().GetHostname(); host != "node" {
+		t.Fatalf("broadcast message hostname: got %s, want node", host)
+	}
+}
+
+func TestPausedMessagesAreDeliveredInOrderOnResume(t *testing.T) {
+	b := newTestBroadcaster(t, nil, WithPauseBuffer(3))
+	ch := make(chan *gen.Metrics, 10)
+	if _, err := b.Register("sub", ch); err != nil {
+		t.Fatal(err)
+	}
+
+	b.PauseAll()
+	if !b.IsPaused() {
+		t.Fatal("not paused after PauseAll")
+	}
+	// The buffer holds the last 3 messages
+	for _, host := range []string{"a", "b", "c", "d"} {
+		b.Broadcast(hostMetrics(host))
+	}
+	if len(ch) != 0 {
+		t.Fatalf("queued while paused: got %d, want 0", len(ch))
+	}
+
+	b.ResumeAll()
+	if b.IsPaused() {
+		t.Fatal("still paused after ResumeAll")
+	}
+	b.Broadcast(hostMetrics("e"))
+	for _, want := range []string{"b", "c", "d", "e"} {
+		if host := receive(t, ch).GetNodeMetrics().GetHostname(); host != want {
+			t.Fatalf("received %s, want %s", host, want)
+		}
+	}
+}
+
+func TestMessageFilterDiscardsMessagesForAllSubscribers(t *testing.T) {
+	b := newTestBroadcaster(t, nil, WithMessageFilter(func(m *gen.Metrics) bool {
+		return m.GetNodeMetrics().GetHostname() != "test"
+	}))
+	chans := []chan *gen.Metrics{make(chan *gen.Metrics, 2), make(chan *gen.Metrics, 2)}
+	for i, ch := range chans {
+		if _, err := b.Register(fmt.Sprintf("sub-%d", i), ch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b.Broadcast(hostMetrics("test"))
+	b.Broadcast(hostMetrics("node"))
+	for i, ch := range chans {
+		if host := receive(t, ch).GetNodeMetrics().GetHostname(); host != "node" || len(ch) != 0 {
+			t.Fatalf("subscriber %d: received %s with %d more queued, want node only", i, host, len(ch))
+		}
+	}
+	if got := testutil.ToFloat64(b.metrics.FilteredMessages); got != 1 {
+		t.Fatalf("filtered messages counter: got %v, want 1", got)
+	}
+	if got := b.Stats().TotalFiltered; got != 1 {
+		t.Fatalf("filtered messages stat: got %d, want 1", got)
+	}
+}
+
+func TestWithLoggerReceivesBroadcasterLogs(t *testing.T) {
+	// exercise registers a subscriber that drops every message and unregisters it
+	exercise := func(b *Broadcaster) {
+		if _, err := b.Register("sub", make(chan *gen.Metrics)); err != nil {
+			t.Fatal(err)
+		}
+		b.Broadcast(hostMetrics("node"))
+		b.Unregister("sub")
+	}
+
+	// Without WithLogger, the no-op logger is used
+	exercise(newTestBroadcaster(t, nil))
+
+	core, logs := observer.New(zap.DebugLevel)
+	exercise(newTestBroadcaster(t, nil, WithLogger(zap.New(core))))
+	if logs.FilterMessage("dropping metrics: subscriber channel full").Len() != 1 {
+		t.Fatalf("logged %v, want the dropped message", logs.All())
+	}
+}
+
+func TestOnDropIsCalledOncePerDrop(t *testing.T) {
+	const drops = 150
+
+	var mu sync.Mutex
+	calls := map[*gen.Metrics]int{}
+	b := newTestBroadcaster(t, nil, WithOnDrop(func(id string, msg *gen.Metrics) {
+		if id != "full" {
+			t.Errorf("drop hook called for %s, want full", id)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		calls[msg]++
+	}))
+	if _, err := b.Register("full", make(chan *gen.Metrics)); err != nil {
+		t.Fatal(err)
+	}
+	// More drops than concurrent hook calls
+	msgs := make([]*gen.Metrics, drops)
+	for i := range msgs {
+		msgs[i] = hostMetrics(fmt.Sprintf("node-%d", i))
+		b.Broadcast(msgs[i])
+	}
+
+	waitFor(t, "every drop to reach the hook", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(calls) == drops
+	})
+	time.Sleep(10 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	for _, msg := range msgs {
+		if n := calls[msg]; n != 1 {
+			t.Fatalf("drop hook calls for %s: got %d, want 1", msg.GetNodeMetrics().GetHostname(), n)
+		}
+	}
+}
+
+func TestLifecycleHooksAreCalledWithSubscriberID(t *testing.T) {
+	var registered, unregistered []string
+	b := newTestBroadcaster(t, nil,
+		WithOnRegister(func(id string) { registered = append(registered, id) }),
+		WithOnUnregister(func(id string) { unregistered = append(unregistered, id) }),
+	)
+
+	for _, id := range []string{"a", "b"} {
+		if _, err := b.Register(id, make(chan *gen.Metrics, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.Unregister("a")
+	b.Unregister("unknown")
+	b.UnregisterAll()
+
+	if fmt.Sprint(registered) != "[a b]" {
+		t.Fatalf("register hook calls: got %v, want [a b]", registered)
+	}
+	if fmt.Sprint(unregistered) != "[a b]" {
+		t.Fatalf("unregister hook calls: got %v, want [a b]", unregistered)
+	}
+}
+
+func TestBroadcastCallbackReportsEachBroadcast(t *testing.T) {
+	type counts struct{ sent, dropped int }
+	var calls []counts
+	b := newTestBroadcaster(t, nil, WithBroadcastCallback(func(sent, dropped int) {
+		calls = append(calls, counts{sent, dropped})
+	}))
+	open := make(chan *gen.Metrics, 10)
+	if _, err := b.Register("open", open); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Register("full", make(chan *gen.Metrics)); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 10 {
+		b.Broadcast(hostMetrics("node"))
+	}
+	if len(calls) != 10 {
+		t.Fatalf("callback calls: got %d, want 10", len(calls))
+	}
+	for i, c := range calls {
+		if c != (counts{1, 1}) {
+			t.Fatalf("call %d: got %+v, want 1 sent and 1 dropped", i, c)
+		}
+	}
+}
+
+func TestLockProfilingWarnsAboveThreshold(t *testing.T) {
+	const threshold = 5 * time.Millisecond
+
+	core, logs := observer.New(zap.WarnLevel)
+	// Waiting on a full channel slows the fan-out down while it holds the lock
+	b := newTestBroadcaster(t, nil, WithLogger(zap.New(core)), WithLockProfiling(threshold), WithBroadcastTimeout(4*threshold))
+	if _, err := b.Register("sub", make(chan *gen.Metrics, 1)); err != nil {
+		t.Fatal(err)
+	}
+	// The channel has room for the first message only
+	b.Broadcast(hostMetrics("node"))
+	if n := logs.FilterMessage("broadcast held the broadcaster lock above threshold").Len(); n != 0 {
+		t.Fatalf("warnings for a fast fan-out: got %d, want 0", n)
+	}
+
+	b.Broadcast(hostMetrics("node"))
+	warnings := logs.FilterMessage("broadcast held the broadcaster lock above threshold").All()
+	if len(warnings) != 1 {
+		t.Fatalf("warnings for a slow fan-out: got %d, want 1", len(warnings))
+	}
+	fields := warnings[0].ContextMap()
+	if held, _ := fields["lock_held"].(time.Duration); held <= threshold || fields["subscriber_count"] != int64(1) {
+		t.Fatalf("warning fields: got %v, want lock_held above %v and 1 subscriber", fields, threshold)
+	}
+
+	var m dto.Metric
+	if err := b.metrics.LockHeld.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	if n := m.GetHistogram().GetSampleCount(); n != 2 {
+		t.Fatalf("lock hold observations: got %d, want 2", n)
+	}
+}
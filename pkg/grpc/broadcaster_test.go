@@ -0,0 +1,911 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kubensage/relay/proto/gen"
+	"github.com/kubensage/relay/proto/gen/admin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestExclusiveRegisterAdmitsOneOfConcurrentRegistrations(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+
+	const n = 16
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := b.register("restored", &subscriber{ch: make(chan *gen.Metrics, 1)}, 0, true)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	registered := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			registered++
+		case !errors.Is(err, ErrSubscriberAlreadyExists):
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if registered != 1 {
+		t.Fatalf("got %d successful registrations, want 1", registered)
+	}
+}
+
+func TestChannelDepthGaugeMatchesQueueLength(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	ch := make(chan *gen.Metrics, 5)
+	if _, err := b.Register("a", ch); err != nil {
+		t.Fatal(err)
+	}
+
+	b.Broadcast(&gen.Metrics{})
+	b.BroadcastBatch([]*gen.Metrics{{}, {}})
+	if got := testutil.ToFloat64(b.metrics.SubscriberChannelDepth.WithLabelValues(defaultTopic, "a")); got != float64(len(ch)) || got != 3 {
+		t.Fatalf("depth: got %v, want len(ch) = %d", got, len(ch))
+	}
+
+	<-ch
+	b.Broadcast(&gen.Metrics{})
+	if got := testutil.ToFloat64(b.metrics.SubscriberChannelDepth.WithLabelValues(defaultTopic, "a")); got != float64(len(ch)) {
+		t.Fatalf("depth after a receive: got %v, want %d", got, len(ch))
+	}
+}
+
+func TestInFlightFanoutDoesNotRecreateRemovedSeries(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	if _, err := b.Register("a", make(chan *gen.Metrics)); err != nil {
+		t.Fatal(err)
+	}
+	sub := b.load()["a"]
+	b.Broadcast(&gen.Metrics{})
+
+	b.Unregister("a")
+	// A fan-out that loaded the snapshot before Unregister finishes afterwards
+	b.drop("a", sub, &gen.Metrics{})
+	b.sampleDepth(sub)
+
+	if n := testutil.CollectAndCount(b.metrics.SubscriberDroppedMessages); n != 0 {
+		t.Fatalf("dropped series: got %d, want 0", n)
+	}
+	if n := testutil.CollectAndCount(b.metrics.SubscriberChannelDepth); n != 0 {
+		t.Fatalf("depth series: got %d, want 0", n)
+	}
+}
+
+func TestUnregisterUnknownIDIsNoOp(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	ch := make(chan *gen.Metrics, 1)
+	if _, err := b.Register("known", ch); err != nil {
+		t.Fatal(err)
+	}
+
+	b.Unregister("never-registered")
+
+	if !b.Has("known") || b.SubscriberCount() != 1 {
+		t.Fatal("unregistering an unknown ID affected the registered subscriber")
+	}
+}
+
+func TestReRegisterClosesReplacedChannel(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	old := make(chan *gen.Metrics, 1)
+	if _, err := b.Register("sub", old); err != nil {
+		t.Fatal(err)
+	}
+	replacement := make(chan *gen.Metrics, 1)
+	if _, err := b.Register("sub", replacement); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case _, ok := <-old:
+		if ok {
+			t.Fatal("replaced channel received a message instead of being closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("replaced channel was not closed")
+	}
+
+	b.Broadcast(&gen.Metrics{})
+	receive(t, replacement)
+	if b.SubscriberCount() != 1 {
+		t.Fatalf("subscriber count: got %d, want 1", b.SubscriberCount())
+	}
+}
+
+// maxHeapGrowthPerSubscriber bounds the heap a subscriber may leave behind once
+// unregistered (TestMemoryIsReleasedAfterUnregistering).
+const maxHeapGrowthPerSubscriber = 10 << 10
+
+func TestMemoryIsReleasedAfterUnregistering(t *testing.T) {
+	if testing.Short() {
+		t.Skip("resource consumption guard, skipped in short mode")
+	}
+	const subscribers, messages = 1000, 10_000
+
+	b := newTestBroadcaster(t, nil)
+	var before runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	ids := make([]string, subscribers)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("sub-%d", i)
+		if _, err := b.Register(ids[i], make(chan *gen.Metrics, 8)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for range messages {
+		b.Broadcast(hostMetrics("node"))
+	}
+	for _, id := range ids {
+		b.Unregister(id)
+	}
+
+	var after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	growth := int64(after.HeapAlloc) - int64(before.HeapAlloc)
+	if perSub := growth / subscribers; perSub > maxHeapGrowthPerSubscriber {
+		t.Fatalf("heap growth per subscriber: got %d bytes, want at most %d", perSub, maxHeapGrowthPerSubscriber)
+	}
+}
+
+func TestUnregisterAllClosesEverySubscriber(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	chs := make([]chan *gen.Metrics, 3)
+	for i := range chs {
+		chs[i] = make(chan *gen.Metrics, 1)
+		if _, err := b.Register(fmt.Sprintf("sub-%d", i), chs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b.UnregisterAll()
+	if n := b.SubscriberCount(); n != 0 {
+		t.Fatalf("subscriber count: got %d, want 0", n)
+	}
+	for i, ch := range chs {
+		if _, ok := <-ch; ok {
+			t.Fatalf("channel %d was not closed", i)
+		}
+	}
+
+	b.UnregisterAll()
+}
+
+func TestRegisteredSinceReportsRegistrationTime(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	if _, ok := b.RegisteredSince("sub"); ok {
+		t.Fatal("unknown subscriber reported as registered")
+	}
+	if _, err := b.Register("sub", make(chan *gen.Metrics, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	at, ok := b.RegisteredSince("sub")
+	if !ok {
+		t.Fatal("registered subscriber not found")
+	}
+	if d := time.Since(at); d < 0 || d > time.Second {
+		t.Fatalf("registration time: %v ago, want within a second", d)
+	}
+}
+
+func TestForEachVisitsEverySubscriberOnce(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	want := map[string]chan *gen.Metrics{}
+	for i := range 3 {
+		id := fmt.Sprintf("sub-%d", i)
+		want[id] = make(chan *gen.Metrics, 1)
+		if _, err := b.Register(id, want[id]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	visits := map[string]int{}
+	b.ForEach(func(id string, ch chan *gen.Metrics) {
+		visits[id]++
+		if ch != want[id] {
+			t.Errorf("subscriber %s: ForEach passed another channel", id)
+		}
+	})
+	if len(visits) != len(want) {
+		t.Fatalf("visited subscribers: got %v, want %d", visits, len(want))
+	}
+	for id, n := range visits {
+		if n != 1 {
+			t.Fatalf("subscriber %s visited %d times, want once", id, n)
+		}
+	}
+}
+
+func TestStatsCountBroadcastsAndDrops(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	for i, size := range []int{10, 10, 0} {
+		if _, err := b.Register(fmt.Sprintf("sub-%d", i), make(chan *gen.Metrics, size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for range 10 {
+		b.Broadcast(hostMetrics("node"))
+	}
+	st := b.Stats()
+	if st.SubscriberCount != 3 || st.TotalBroadcasts != 10 || st.TotalDropped != 10 || st.SequenceNumber != 10 {
+		t.Fatalf("stats: got %+v, want 3 subscribers, 10 broadcasts, 10 drops, sequence 10", st)
+	}
+}
+
+func TestDroppedMessagesCounterIsDeletedOnUnregister(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	if _, err := b.Register("full", make(chan *gen.Metrics)); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 3 {
+		b.Broadcast(hostMetrics("node"))
+	}
+	if got := testutil.ToFloat64(b.metrics.SubscriberDroppedMessages.WithLabelValues(defaultTopic, "full")); got != 3 {
+		t.Fatalf("dropped messages: got %v, want 3", got)
+	}
+
+	b.Unregister("full")
+	if n := testutil.CollectAndCount(b.metrics.SubscriberDroppedMessages); n != 0 {
+		t.Fatalf("dropped series after unregistering: got %d, want 0", n)
+	}
+}
+
+func TestNotifyOnSubscriberCountReportsCrossings(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	notify := make(chan int, 4)
+	b.NotifyOnSubscriberCount(1, notify)
+
+	for _, id := range []string{"a", "b"} {
+		if _, err := b.Register(id, make(chan *gen.Metrics, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.Unregister("b")
+
+	var got []int
+	for len(notify) > 0 {
+		got = append(got, <-notify)
+	}
+	if len(got) != 2 || got[0] != 2 || got[1] != 1 {
+		t.Fatalf("notifications: got %v, want [2 1]", got)
+	}
+}
+
+// rwMutexFanout is the fan-out the Broadcaster used before its copy-on-write
+// subscriber map: the map lock is held for the whole fan-out.
+type rwMutexFanout struct {
+	mu   sync.RWMutex
+	subs map[string]chan *gen.Metrics
+}
+
+func (f *rwMutexFanout) Register(id string, ch chan *gen.Metrics) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subs[id] = ch
+}
+
+func (f *rwMutexFanout) Unregister(id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.subs, id)
+}
+
+func (f *rwMutexFanout) Broadcast(msg *gen.Metrics) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for _, ch := range f.subs {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+// BenchmarkBroadcast compares the copy-on-write Broadcaster with the RWMutex
+// fan-out, broadcasting to 1000 subscribers while 10 goroutines register and
+// unregister subscribers.
+func BenchmarkBroadcast(b *testing.B) {
+	const subscribers, registrars = 1000, 10
+
+	type fanout interface {
+		Register(id string, ch chan *gen.Metrics)
+		Unregister(id string)
+		Broadcast(msg *gen.Metrics)
+	}
+	run := func(b *testing.B, f fanout) {
+		for i := range subscribers {
+			f.Register(fmt.Sprintf("sub-%d", i), make(chan *gen.Metrics, 1))
+		}
+		stop := make(chan struct{})
+		var wg sync.WaitGroup
+		for r := range registrars {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				id := fmt.Sprintf("registrar-%d", r)
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					f.Register(id, make(chan *gen.Metrics, 1))
+					f.Unregister(id)
+				}
+			}()
+		}
+
+		msg := hostMetrics("node")
+		b.ResetTimer()
+		for range b.N {
+			f.Broadcast(msg)
+		}
+		b.StopTimer()
+		close(stop)
+		wg.Wait()
+	}
+
+	b.Run("copy-on-write", func(b *testing.B) {
+		run(b, cowFanout{newTestBroadcaster(b, nil)})
+	})
+	b.Run("rwmutex", func(b *testing.B) {
+		run(b, &rwMutexFanout{subs: make(map[string]chan *gen.Metrics)})
+	})
+}
+
+// cowFanout adapts Broadcaster to BenchmarkBroadcast.
+type cowFanout struct{ *Broadcaster }
+
+func (f cowFanout) Register(id string, ch chan *gen.Metrics) {
+	_, _ = f.Broadcaster.Register(id, ch)
+}
+
+func (f cowFanout) Broadcast(msg *gen.Metrics) {
+	f.Broadcaster.Broadcast(msg)
+}
+
+// benchmarkBroadcastAllocs broadcasts to 16 subscribers with the given options,
+// reporting allocations. Subscribers are drained after each broadcast, so that
+// the drop path is not measured.
+func benchmarkBroadcastAllocs(b *testing.B, opts ...BroadcasterOption) {
+	bc := newTestBroadcaster(b, nil, opts...)
+	chans := make([]chan *gen.Metrics, 16)
+	for i := range chans {
+		chans[i] = make(chan *gen.Metrics, 1)
+		if _, err := bc.Register(fmt.Sprintf("sub-%d", i), chans[i]); err != nil {
+			b.Fatal(err)
+		}
+	}
+	msg := hostMetrics("node")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		bc.Broadcast(msg)
+		for _, ch := range chans {
+			<-ch
+		}
+	}
+}
+
+// BenchmarkBroadcastWithPool measures the inline fan-out with its state
+// recycled through fanoutPool: it should not allocate per broadcast.
+func BenchmarkBroadcastWithPool(b *testing.B) {
+	benchmarkBroadcastAllocs(b)
+}
+
+// BenchmarkBroadcastWithoutPool measures the inline fan-out with its state
+// allocated on every broadcast, as before fanoutPool.
+func BenchmarkBroadcastWithoutPool(b *testing.B) {
+	recycleFanouts = false
+	b.Cleanup(func() { recycleFanouts = true })
+	benchmarkBroadcastAllocs(b)
+}
+
+// BenchmarkBroadcastWorkerPool measures the worker pool fan-out, whose pooled
+// state should not allocate per broadcast either.
+func BenchmarkBroadcastWorkerPool(b *testing.B) {
+	benchmarkBroadcastAllocs(b, WithWorkerPool(4))
+}
+
+func TestWaitForSubscribers(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+
+	errs := make(chan error, 1)
+	go func() { errs <- b.WaitForSubscribers(t.Context(), 2) }()
+	for _, id := range []string{"a", "b"} {
+		if _, err := b.Register(id, make(chan *gen.Metrics, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatalf("count reached: got %v, want nil", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WaitForSubscribers did not return once the count was reached")
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+	if err := b.WaitForSubscribers(ctx, 3); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("count not reached: got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestSubscriberTransitionsAreLogged(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	b := newTestBroadcaster(t, nil, WithLogger(zap.New(core)))
+	// count returns the number of log lines with the given message
+	count := func(message string) int { return logs.FilterMessage(message).Len() }
+
+	if _, err := b.Register("a", make(chan *gen.Metrics, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Register("b", make(chan *gen.Metrics, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if count("first subscriber registered") != 1 {
+		t.Fatal("first registration not logged once")
+	}
+
+	b.Unregister("a")
+	if count("last subscriber unregistered") != 0 {
+		t.Fatal("last unregistration logged while a subscriber remains")
+	}
+	b.Unregister("b")
+	if count("last subscriber unregistered") != 1 {
+		t.Fatal("last unregistration not logged")
+	}
+}
+
+func TestSubscribeDeliversUntilCanceled(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+
+	ch, cancel := b.Subscribe(t.Context())
+	received := make(chan string, 3)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for msg := range ch {
+			received <- msg.GetNodeMetrics().GetHostname()
+		}
+	}()
+
+	for _, host := range []string{"a", "b", "c"} {
+		b.Broadcast(hostMetrics(host))
+	}
+	for _, want := range []string{"a", "b", "c"} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Fatalf("received %s, want %s", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %s", want)
+		}
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the channel was not closed on cancel")
+	}
+	if n := b.SubscriberCount(); n != 0 {
+		t.Fatalf("subscribers after cancel: got %d, want 0", n)
+	}
+	cancel()
+}
+
+func TestSubscribeEndsWithItsContext(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	ch, _ := b.Subscribe(ctx, WithChannelSize(1))
+	if n := b.SubscriberCount(); n != 1 {
+		t.Fatalf("subscribers: got %d, want 1", n)
+	}
+	cancel()
+	waitFor(t, "the subscriber to be unregistered", func() bool { return b.SubscriberCount() == 0 })
+	if _, ok := <-ch; ok {
+		t.Fatal("the channel is still open after the context was canceled")
+	}
+}
+
+// broadcastReturns fails the test unless b.Broadcast(msg) returns within a
+// second.
+func broadcastReturns(t *testing.T, b *Broadcaster, msg *gen.Metrics) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.Broadcast(msg)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Broadcast blocked")
+	}
+}
+
+func TestBroadcastWithoutSubscribersReturns(t *testing.T) {
+	fanouts := map[string][]BroadcasterOption{
+		"inline":      nil,
+		"worker pool": {WithWorkerPool(2)},
+		"lossless":    {WithLosslessSend()},
+	}
+	for name, opts := range fanouts {
+		t.Run(name, func(t *testing.T) {
+			t.Run("never registered", func(t *testing.T) {
+				b := newTestBroadcaster(t, nil, opts...)
+				broadcastReturns(t, b, hostMetrics("node"))
+			})
+
+			t.Run("all unregistered", func(t *testing.T) {
+				b := newTestBroadcaster(t, nil, opts...)
+				for _, id := range []string{"a", "b"} {
+					if _, err := b.Register(id, make(chan *gen.Metrics, 1)); err != nil {
+						t.Fatal(err)
+					}
+				}
+				broadcastReturns(t, b, hostMetrics("node"))
+				b.Unregister("a")
+				b.Unregister("b")
+				broadcastReturns(t, b, hostMetrics("node"))
+			})
+		})
+	}
+}
+
+func TestSubscriberHandleIsInvalidAfterUnregister(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	ch := make(chan *gen.Metrics, 2)
+	h, err := b.Register("sub", ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.IsValid() || h.ID() != "sub" {
+		t.Fatalf("new handle: valid %v, ID %s", h.IsValid(), h.ID())
+	}
+	if !h.Send(hostMetrics("node")) {
+		t.Fatal("Send on a valid handle failed")
+	}
+	receive(t, ch)
+
+	b.Unregister("sub")
+	if h.IsValid() {
+		t.Fatal("handle still valid after Unregister")
+	}
+	if h.Send(hostMetrics("node")) || len(ch) != 0 {
+		t.Fatal("Send on an invalid handle queued the message")
+	}
+
+	// Once the channel is closed, Send must not panic either
+	h, err = b.Register("sub", ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.UnregisterAll()
+	if h.Send(hostMetrics("node")) {
+		t.Fatal("Send after the channel was closed succeeded")
+	}
+}
+
+func TestReRegisterInvalidatesPreviousHandle(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	ch := make(chan *gen.Metrics, 1)
+	first, err := b.Register("sub", ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := b.Register("sub", ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.IsValid() || !second.IsValid() {
+		t.Fatalf("after re-registration: first valid %v, second valid %v, want false and true", first.IsValid(), second.IsValid())
+	}
+}
+
+func TestRenameKeepsDelivering(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	ch := make(chan *gen.Metrics, 2)
+	h, err := b.Register("old", ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Register("taken", make(chan *gen.Metrics, 1)); err != nil {
+		t.Fatal(err)
+	}
+	since, _ := b.RegisteredSince("old")
+
+	if err := b.Rename("missing", "new"); !errors.Is(err, ErrSubscriberNotFound) {
+		t.Fatalf("unknown old ID: got %v, want ErrSubscriberNotFound", err)
+	}
+	if err := b.Rename("old", "taken"); !errors.Is(err, ErrSubscriberAlreadyExists) {
+		t.Fatalf("existing new ID: got %v, want ErrSubscriberAlreadyExists", err)
+	}
+	if err := b.Rename("old", "new"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := b.RegisteredSince("old"); ok {
+		t.Fatal("old ID still registered")
+	}
+	if got, ok := b.RegisteredSince("new"); !ok || !got.Equal(since) {
+		t.Fatalf("registration time under the new ID: got %v, want %v", got, since)
+	}
+	if !h.IsValid() {
+		t.Fatal("the handle was invalidated by the rename")
+	}
+	b.Broadcast(hostMetrics("after"))
+	if host := receive(t, ch).GetNodeMetrics().GetHostname(); host != "after" {
+		t.Fatalf("received %s, want the broadcast after the rename", host)
+	}
+}
+
+func TestBroadcastObservesFanoutDuration(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	if _, err := b.Register("sub", make(chan *gen.Metrics, 1)); err != nil {
+		t.Fatal(err)
+	}
+	b.Broadcast(hostMetrics("node"))
+
+	var m dto.Metric
+	if err := b.metrics.FanoutDuration.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	if n := m.GetHistogram().GetSampleCount(); n != 1 {
+		t.Fatalf("fan-out duration observations: got %d, want 1", n)
+	}
+}
+
+// BenchmarkFanoutDurationOverhead measures the cost of recording the fan-out
+// duration of a broadcast, which should stay well under 1µs.
+func BenchmarkFanoutDurationOverhead(b *testing.B) {
+	h := newTestBroadcaster(b, nil).metrics.FanoutDuration
+	start := time.Now()
+	b.ReportAllocs()
+	for range b.N {
+		h.Observe(time.Since(start).Seconds())
+	}
+}
+
+func TestUnregisterDuringConcurrentBroadcastsKeepsChannelOpen(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	ch := make(chan *gen.Metrics, 100)
+	if _, err := b.Register("sub", ch); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			b.Broadcast(hostMetrics("node"))
+		}()
+	}
+	close(start)
+	b.Unregister("sub")
+	wg.Wait()
+
+	// Messages sent before the unregistration may be queued, but the channel
+	// must not be closed
+	for range len(ch) {
+		<-ch
+	}
+	select {
+	case _, ok := <-ch:
+		if !ok {
+			t.Fatal("Unregister closed the subscriber channel")
+		}
+		t.Fatal("a message was queued after the channel was drained")
+	default:
+	}
+}
+
+func TestBroadcastAckedReportsDelivery(t *testing.T) {
+	const timeout = 20 * time.Millisecond
+
+	t.Run("no subscriber", func(t *testing.T) {
+		b := newTestBroadcaster(t, nil)
+		ctx, cancel := context.WithTimeout(t.Context(), timeout)
+		defer cancel()
+		start := time.Now()
+		if b.BroadcastAcked(ctx, hostMetrics("node")) {
+			t.Fatal("reported as received without subscribers")
+		}
+		if d := time.Since(start); d < timeout {
+			t.Fatalf("returned after %v, before the %v timeout", d, timeout)
+		}
+	})
+
+	t.Run("subscriber registering while waiting", func(t *testing.T) {
+		b := newTestBroadcaster(t, nil)
+		ch := make(chan *gen.Metrics, 1)
+		time.AfterFunc(timeout, func() {
+			if _, err := b.Register("late", ch); err != nil {
+				t.Error(err)
+			}
+		})
+		if !b.BroadcastAcked(t.Context(), hostMetrics("node")) {
+			t.Fatal("not reported as received by the late subscriber")
+		}
+		receive(t, ch)
+	})
+
+	t.Run("full subscriber", func(t *testing.T) {
+		b := newTestBroadcaster(t, nil)
+		if _, err := b.Register("full", make(chan *gen.Metrics)); err != nil {
+			t.Fatal(err)
+		}
+		if b.BroadcastAcked(t.Context(), hostMetrics("node")) {
+			t.Fatal("reported as received by a full subscriber")
+		}
+	})
+}
+
+func TestBroadcastReportsSentAndDropped(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	for i := range 3 {
+		if _, err := b.Register(fmt.Sprintf("open-%d", i), make(chan *gen.Metrics, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range 2 {
+		if _, err := b.Register(fmt.Sprintf("full-%d", i), make(chan *gen.Metrics)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sent, dropped := b.Broadcast(hostMetrics("node"))
+	if sent != 3 || dropped != 2 {
+		t.Fatalf("first broadcast: got %d sent and %d dropped, want 3 and 2", sent, dropped)
+	}
+	// The open channels are full now
+	sent, dropped = b.Broadcast(hostMetrics("node"))
+	if sent+dropped != b.SubscriberCount() || sent != 0 {
+		t.Fatalf("second broadcast: got %d sent and %d dropped, want 0 and %d", sent, dropped, b.SubscriberCount())
+	}
+	if got := testutil.ToFloat64(b.metrics.SentMessages); got != 3 {
+		t.Fatalf("sent messages counter: got %v, want 3", got)
+	}
+}
+
+func TestBroadcastToGroupReachesGroupMembersOnly(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	var members, others []<-chan *gen.Metrics
+	for i := range 5 {
+		var opts []SubscriberOption
+		if i < 3 {
+			opts = append(opts, WithGroups("debug"))
+		}
+		ch, cancel := b.Subscribe(t.Context(), opts...)
+		t.Cleanup(cancel)
+		if i < 3 {
+			members = append(members, ch)
+		} else {
+			others = append(others, ch)
+		}
+	}
+
+	if sent, dropped := b.BroadcastToGroup("debug", hostMetrics("debug")); sent != 3 || dropped != 0 {
+		t.Fatalf("group broadcast: got %d sent and %d dropped, want 3 and 0", sent, dropped)
+	}
+	// The next message of non-members is the one broadcast to everyone
+	b.Broadcast(hostMetrics("all"))
+	for i, ch := range members {
+		if host := receive(t, ch).GetNodeMetrics().GetHostname(); host != "debug" {
+			t.Fatalf("member %d received %s first, want debug", i, host)
+		}
+	}
+	for i, ch := range others {
+		if host := receive(t, ch).GetNodeMetrics().GetHostname(); host != "all" {
+			t.Fatalf("non-member %d received %s first, want all", i, host)
+		}
+	}
+}
+
+func TestBroadcastIfReachesAcceptedSubscribersOnly(t *testing.T) {
+	for name, opts := range map[string][]BroadcasterOption{
+		"inline":      nil,
+		"worker pool": {WithWorkerPool(2)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			b := newTestBroadcaster(t, nil, opts...)
+			chans := make(map[int]chan *gen.Metrics)
+			for i := 1; i <= 5; i++ {
+				chans[i] = make(chan *gen.Metrics, 1)
+				if _, err := b.Register(fmt.Sprintf("sub-%d", i), chans[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var evaluated []string
+			var mu sync.Mutex
+			odd := func(id string) bool {
+				mu.Lock()
+				evaluated = append(evaluated, id)
+				mu.Unlock()
+				var i int
+				_, _ = fmt.Sscanf(id, "sub-%d", &i)
+				return i%2 == 1
+			}
+			if sent, dropped := b.BroadcastIf(hostMetrics("odd"), odd); sent != 3 || dropped != 0 {
+				t.Fatalf("conditional broadcast: got %d sent and %d dropped, want 3 and 0", sent, dropped)
+			}
+			if len(evaluated) != 5 {
+				t.Fatalf("predicate evaluations: got %v, want one per subscriber", evaluated)
+			}
+			for i, ch := range chans {
+				if got, want := len(ch), i%2; got != want {
+					t.Fatalf("sub-%d: got %d queued messages, want %d", i, got, want)
+				}
+			}
+			if got := b.Stats().TotalDropped; got != 0 {
+				t.Fatalf("dropped after skipping subscribers: got %d, want 0", got)
+			}
+		})
+	}
+}
+
+func TestMetricsSnapshotMatchesOperations(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	if m := b.Metrics(); m.GetLastBroadcastAt() != nil {
+		t.Fatalf("last broadcast time before any broadcast: got %v, want unset", m.GetLastBroadcastAt())
+	}
+	// Room for 3 of the 5 messages: 2 are dropped
+	if _, err := b.Register("sub", make(chan *gen.Metrics, 3)); err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+	for range 5 {
+		b.Broadcast(hostMetrics("node"))
+	}
+	after := time.Now()
+
+	got := b.Metrics()
+	want := &admin.BroadcasterMetrics{
+		TotalBroadcasts: 5,
+		TotalDropped:    2,
+		SubscriberCount: 1,
+		SequenceNumber:  5,
+	}
+	at := got.GetLastBroadcastAt().AsTime()
+	got.LastBroadcastAt = nil
+	if !proto.Equal(got, want) {
+		t.Fatalf("metrics: got %v, want %v", got, want)
+	}
+	if at.Before(before) || at.After(after) {
+		t.Fatalf("last broadcast time %v outside of the broadcasts [%v, %v]", at, before, after)
+	}
+}
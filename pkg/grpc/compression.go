@@ -0,0 +1,50 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+
+	"github.com/kubensage/relay/pkg/codec"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+)
+
+// acceptEncodingKey is the metadata key a subscriber uses to request a
+// compressor for the messages sent to it (none, gzip or zstd).
+const acceptEncodingKey = "relay-accept-encoding"
+
+// negotiateCompression sets the send compressor of a subscriber stream from its
+// relay-accept-encoding metadata. It must be called before the response header
+// is sent.
+//
+// Behavior:
+//   - Streams without the metadata, or requesting "none", are not compressed.
+//   - A compressor that is not registered, or that the client did not advertise
+//     in grpc-accept-encoding, is logged as a warning and the stream falls back
+//     to no compression.
+//
+// Parameters:
+//   - ctx: stream context carrying the incoming metadata.
+//   - logger: the stream's child logger.
+func negotiateCompression(ctx context.Context, logger *zap.Logger) {
+	values := metadata.ValueFromIncomingContext(ctx, acceptEncodingKey)
+	if len(values) == 0 {
+		return
+	}
+	name := strings.ToLower(strings.TrimSpace(values[0]))
+	if name == "" || name == codec.CompressionNone {
+		return
+	}
+
+	if encoding.GetCompressor(name) == nil {
+		logger.Warn("unsupported subscriber compression, falling back to none", zap.String("encoding", name))
+		return
+	}
+	if err := grpc.SetSendCompressor(ctx, name); err != nil {
+		logger.Warn("failed to set subscriber compression, falling back to none", zap.String("encoding", name), zap.Error(err))
+		return
+	}
+	logger.Info("subscriber compression negotiated", zap.String("encoding", name))
+}
@@ -0,0 +1,90 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kubensage/relay/proto/gen"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// payloadRecorder is a server stats.Handler recording the sent payloads.
+type payloadRecorder struct {
+	mu   sync.Mutex
+	sent []*stats.OutPayload
+}
+
+func (r *payloadRecorder) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (r *payloadRecorder) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if out, ok := s.(*stats.OutPayload); ok {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.sent = append(r.sent, out)
+	}
+}
+
+func (r *payloadRecorder) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (r *payloadRecorder) HandleConn(context.Context, stats.ConnStats) {}
+
+// last returns the last recorded payload.
+func (r *payloadRecorder) last() *stats.OutPayload {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sent[len(r.sent)-1]
+}
+
+func TestSubscriberCompressionNegotiation(t *testing.T) {
+	tests := []struct {
+		encoding   string
+		compressed bool
+		warned     bool
+	}{
+		{encoding: "gzip", compressed: true},
+		{encoding: "zstd", compressed: true},
+		{encoding: "none"},
+		{encoding: "brotli", warned: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			core, logs := observer.New(zap.WarnLevel)
+			b := newTestBroadcaster(t, nil)
+			ms := NewMetricsServer(zap.New(core), b)
+			rec := &payloadRecorder{}
+			client := gen.NewMetricsServiceClient(serveTest(t, func(srv *grpc.Server) {
+				gen.RegisterMetricsServiceServer(srv, ms)
+			}, grpc.StatsHandler(rec)))
+
+			stream, err := client.SubscribeMetrics(withMetadata(t, acceptEncodingKey, tt.encoding), &emptypb.Empty{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := stream.Header(); err != nil {
+				t.Fatal(err)
+			}
+			b.Broadcast(hostMetrics(strings.Repeat("node", 256)))
+			if _, err := stream.Recv(); err != nil {
+				t.Fatal(err)
+			}
+
+			out := rec.last()
+			if compressed := out.CompressedLength < out.Length; compressed != tt.compressed {
+				t.Fatalf("sent %d bytes for a %d-byte message; compressed %v, want %v", out.CompressedLength, out.Length, compressed, tt.compressed)
+			}
+			if warned := logs.Len() > 0; warned != tt.warned {
+				t.Fatalf("warning logged: got %v, want %v", warned, tt.warned)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package grpc
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// clock tells the time to the idle subscriber eviction, so that tests can
+// control it.
+type clock interface {
+	Now() time.Time
+}
+
+// realClock is the clock of the system, used by default.
+type realClock struct{}
+
+// Now implements clock.
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// EvictionReason tells why the Broadcaster evicted a subscriber (see
+// WithSubscriberEvictionHook).
+type EvictionReason int
+
+const (
+	// ReasonIdleTimeout: the subscriber channel stayed full for longer than
+	// WithSubscriberIdleTimeout.
+	ReasonIdleTimeout EvictionReason = iota
+	// ReasonCapacityExceeded: the subscriber channel was full under
+	// PolicyDisconnect.
+	ReasonCapacityExceeded
+	// ReasonManualEviction: the subscriber was evicted with Broadcaster.Evict.
+	ReasonManualEviction
+)
+
+// String implements fmt.Stringer.
+func (r EvictionReason) String() string {
+	switch r {
+	case ReasonIdleTimeout:
+		return "idle-timeout"
+	case ReasonCapacityExceeded:
+		return "capacity-exceeded"
+	case ReasonManualEviction:
+		return "manual"
+	default:
+		return "unknown"
+	}
+}
+
+// Evict unregisters the subscriber associated with the given ID and closes its
+// channel or ring buffer, waiting for in-flight fan-outs to complete first. Its
+// stream observes the closed queue and ends. The eviction hook, if any, is
+// called with ReasonManualEviction.
+//
+// Evict must not be called from callbacks run during a fan-out, such as the
+// WithOnDrop callback, which would deadlock.
+//
+// Parameters:
+//   - id: Identifier of the subscriber to evict.
+//
+// Returns:
+//   - bool: false if no subscriber was registered with id.
+func (b *Broadcaster) Evict(id string) bool {
+	if len(b.closeSubscribers([]string{id})) == 0 {
+		return false
+	}
+	b.logger.Info("evicted subscriber", zap.String("subscriber_id", id))
+	b.evicted(id, ReasonManualEviction)
+	return true
+}
+
+// evicted reports the eviction of subscriber id to the eviction hook, if any.
+func (b *Broadcaster) evicted(id string, reason EvictionReason) {
+	if b.cfg.onEvict != nil {
+		b.cfg.onEvict(id, reason)
+	}
+}
+
+// idleExpired reports whether the channel of sub, just found full, has stayed
+// full for the idle timeout (WithSubscriberIdleTimeout). The first time it is
+// found full starts the timeout.
+func (b *Broadcaster) idleExpired(sub *subscriber) bool {
+	if b.cfg.subscriberIdleTimeout <= 0 {
+		return false
+	}
+	now := b.cfg.clock.Now().UnixNano()
+	since := sub.fullSince.Load()
+	if since == 0 {
+		sub.fullSince.CompareAndSwap(0, now)
+		return false
+	}
+	return time.Duration(now-since) >= b.cfg.subscriberIdleTimeout
+}
+
+// consumed records that the channel of sub had room, which resets its idle
+// timeout.
+func (b *Broadcaster) consumed(sub *subscriber) {
+	if b.cfg.subscriberIdleTimeout > 0 && sub.fullSince.Load() != 0 {
+		sub.fullSince.Store(0)
+	}
+}
@@ -0,0 +1,203 @@
+package grpc
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kubensage/relay/proto/gen"
+)
+
+// fakeClock is a clock advanced by tests.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// Now implements clock.
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// advance moves the clock forward by d.
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// withClock makes the idle eviction read the time from c.
+func withClock(c clock) BroadcasterOption {
+	return func(cfg *broadcasterConfig) {
+		cfg.clock = c
+	}
+}
+
+// evictionRecorder records the calls of an eviction hook.
+type evictionRecorder struct {
+	mu      sync.Mutex
+	ids     []string
+	reasons []EvictionReason
+}
+
+func (r *evictionRecorder) hook(id string, reason EvictionReason) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ids = append(r.ids, id)
+	r.reasons = append(r.reasons, reason)
+}
+
+// only fails the test unless the hook was called exactly once, for id and
+// reason.
+func (r *evictionRecorder) only(t *testing.T, id string, reason EvictionReason) {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.ids) != 1 || r.ids[0] != id || r.reasons[0] != reason {
+		t.Fatalf("evictions: got %v %v, want [%s] [%v]", r.ids, r.reasons, id, reason)
+	}
+}
+
+// closed fails the test unless ch is closed once its queued messages are
+// drained.
+func closed(t *testing.T, ch <-chan *gen.Metrics) {
+	t.Helper()
+	for range len(ch) {
+		<-ch
+	}
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Fatal("evicted subscriber channel is open")
+		}
+	default:
+		t.Fatal("evicted subscriber channel is open")
+	}
+}
+
+func TestEvictionHookReportsReason(t *testing.T) {
+	tests := []struct {
+		reason EvictionReason
+		opts   []BroadcasterOption
+		evict  func(t *testing.T, b *Broadcaster)
+	}{
+		{
+			reason: ReasonIdleTimeout,
+			opts:   []BroadcasterOption{WithSubscriberIdleTimeout(10 * time.Millisecond)},
+			evict: func(t *testing.T, b *Broadcaster) {
+				b.Broadcast(&gen.Metrics{}) // Fills the channel
+				b.Broadcast(&gen.Metrics{}) // Finds it full, starting the timeout
+				time.Sleep(20 * time.Millisecond)
+				b.Broadcast(&gen.Metrics{})
+			},
+		},
+		{
+			reason: ReasonCapacityExceeded,
+			opts:   []BroadcasterOption{WithSlowSubscriberPolicy(PolicyDisconnect)},
+			evict: func(t *testing.T, b *Broadcaster) {
+				b.Broadcast(&gen.Metrics{})
+				b.Broadcast(&gen.Metrics{})
+			},
+		},
+		{
+			reason: ReasonManualEviction,
+			evict: func(t *testing.T, b *Broadcaster) {
+				if !b.Evict("sub") {
+					t.Fatal("Evict: subscriber not found")
+				}
+				if b.Evict("sub") {
+					t.Fatal("Evict: evicted an unregistered subscriber")
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.reason.String(), func(t *testing.T) {
+			var rec evictionRecorder
+			b := newTestBroadcaster(t, nil, append(tt.opts, WithSubscriberEvictionHook(rec.hook))...)
+			ch := make(chan *gen.Metrics, 1)
+			if _, err := b.Register("sub", ch); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.evict(t, b)
+			rec.only(t, "sub", tt.reason)
+			closed(t, ch)
+			if n := b.SubscriberCount(); n != 0 {
+				t.Fatalf("subscribers after eviction: got %d, want 0", n)
+			}
+		})
+	}
+}
+
+func TestUnregisterIsNotAnEviction(t *testing.T) {
+	var rec evictionRecorder
+	b := newTestBroadcaster(t, nil, WithSubscriberEvictionHook(rec.hook))
+	if _, err := b.Register("sub", make(chan *gen.Metrics, 1)); err != nil {
+		t.Fatal(err)
+	}
+	b.Unregister("sub")
+	if len(rec.ids) != 0 {
+		t.Fatalf("evictions: got %v, want none", rec.ids)
+	}
+}
+
+func TestIdleSubscriberIsEvictedAfterTheTimeout(t *testing.T) {
+	const timeout = time.Minute
+	clk := &fakeClock{now: time.Unix(1, 0)} // Not the epoch, whose UnixNano means "not full"
+	var rec evictionRecorder
+	b := newTestBroadcaster(t, nil, withClock(clk), WithSubscriberIdleTimeout(timeout), WithSubscriberEvictionHook(rec.hook))
+	idle := make(chan *gen.Metrics, 1)
+	active := make(chan *gen.Metrics, 1)
+	for id, ch := range map[string]chan *gen.Metrics{"idle": idle, "active": active} {
+		if _, err := b.Register(id, ch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// broadcast broadcasts a message once the clock is advanced by d, the
+	// active subscriber receiving it
+	broadcast := func(d time.Duration) {
+		clk.advance(d)
+		b.Broadcast(&gen.Metrics{})
+		receive(t, active)
+	}
+
+	broadcast(0)           // Fills the idle channel
+	broadcast(0)           // Finds it full, starting the timeout
+	broadcast(timeout - 1) // Just before the timeout
+	if len(rec.ids) != 0 {
+		t.Fatalf("evicted before the timeout: %v", rec.ids)
+	}
+
+	broadcast(1)
+	rec.only(t, "idle", ReasonIdleTimeout)
+	closed(t, idle)
+	if n := b.SubscriberCount(); n != 1 {
+		t.Fatalf("subscribers after eviction: got %d, want 1", n)
+	}
+}
+
+func TestIdleTimeoutIsResetByReceiving(t *testing.T) {
+	const timeout = time.Minute
+	clk := &fakeClock{now: time.Unix(1, 0)} // Not the epoch, whose UnixNano means "not full"
+	var rec evictionRecorder
+	b := newTestBroadcaster(t, nil, withClock(clk), WithSubscriberIdleTimeout(timeout), WithSubscriberEvictionHook(rec.hook))
+	ch := make(chan *gen.Metrics, 1)
+	if _, err := b.Register("sub", ch); err != nil {
+		t.Fatal(err)
+	}
+
+	b.Broadcast(&gen.Metrics{}) // Fills the channel
+	b.Broadcast(&gen.Metrics{}) // Finds it full, starting the timeout
+	clk.advance(timeout - 1)
+	receive(t, ch)
+	b.Broadcast(&gen.Metrics{}) // Has room, resetting the timeout
+	b.Broadcast(&gen.Metrics{}) // Finds it full again
+	clk.advance(timeout - 1)
+	b.Broadcast(&gen.Metrics{})
+	if len(rec.ids) != 0 || b.SubscriberCount() != 1 {
+		t.Fatalf("subscriber evicted although it received: %v", rec.ids)
+	}
+}
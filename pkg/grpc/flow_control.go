@@ -0,0 +1,120 @@
+package grpc
+
+import (
+	"io"
+	"time"
+
+	"github.com/kubensage/relay/proto/gen"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// flowControlledStream adapts a SubscribeMetricsFlowControlled stream to
+// subscriberStream: Send blocks while maxUnacked messages are sent but not
+// acknowledged by the client. Acknowledgments are received from a separate
+// goroutine. Like batchSubscriberStream, it is not safe for concurrent use.
+type flowControlledStream struct {
+	gen.MetricsService_SubscribeMetricsFlowControlledServer
+	maxUnacked   uint64        // Maximum number of unacknowledged messages (0 = unlimited)
+	blockTimeout time.Duration // Maximum wait for an acknowledgment while the window is full
+	sent         uint64        // Messages sent so far
+	acked        uint64        // Messages acknowledged so far, at most sent
+	acks         chan uint64   // Acknowledged counts received from the client
+	ackErr       chan error    // The error that ended the acknowledgment stream
+}
+
+// newFlowControlledStream wraps stream and starts receiving its acknowledgments,
+// until the client closes its side, the stream fails or its context is done.
+func newFlowControlledStream(stream gen.MetricsService_SubscribeMetricsFlowControlledServer, maxUnacked int, blockTimeout time.Duration) *flowControlledStream {
+	s := &flowControlledStream{
+		MetricsService_SubscribeMetricsFlowControlledServer: stream,
+		maxUnacked:   uint64(maxUnacked),
+		blockTimeout: blockTimeout,
+		acks:         make(chan uint64),
+		ackErr:       make(chan error, 1),
+	}
+	go func() {
+		for {
+			ack, err := stream.Recv()
+			if err != nil {
+				s.ackErr <- err
+				return
+			}
+			select {
+			case s.acks <- ack.GetAcknowledgedCount():
+			case <-stream.Context().Done():
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// Send sends msg once the acknowledgment window has room.
+//
+// Behavior:
+//   - Acknowledgments received so far are applied first; an acknowledged count
+//     beyond the messages sent counts as all sent messages.
+//   - While sent - acked >= maxUnacked, it waits for an acknowledgment, at most
+//     blockTimeout.
+//
+// Returns:
+//   - error: codes.DeadlineExceeded if the window stayed full for blockTimeout,
+//     or the error of the acknowledgment stream if it failed or the client closed
+//     its side while the window is full; otherwise the error of the send.
+func (s *flowControlledStream) Send(msg *gen.Metrics) error {
+	s.applyAcks()
+	if s.maxUnacked > 0 && s.sent-s.acked >= s.maxUnacked {
+		if err := s.waitAck(); err != nil {
+			return err
+		}
+	}
+	if err := s.MetricsService_SubscribeMetricsFlowControlledServer.Send(msg); err != nil {
+		return err
+	}
+	s.sent++
+	return nil
+}
+
+// applyAcks applies the acknowledgments already received without blocking.
+func (s *flowControlledStream) applyAcks() {
+	for {
+		select {
+		case n := <-s.acks:
+			s.ack(n)
+		default:
+			return
+		}
+	}
+}
+
+// waitAck waits until an acknowledgment frees room in the window.
+//
+// Returns:
+//   - error: see Send.
+func (s *flowControlledStream) waitAck() error {
+	timer := time.NewTimer(s.blockTimeout)
+	defer timer.Stop()
+
+	for s.sent-s.acked >= s.maxUnacked {
+		select {
+		case n := <-s.acks:
+			s.ack(n)
+		case err := <-s.ackErr:
+			if err == io.EOF {
+				return status.Error(codes.FailedPrecondition, "subscriber stopped acknowledging with a full window")
+			}
+			return err
+		case <-timer.C:
+			return status.Errorf(codes.DeadlineExceeded, "no acknowledgment within %s with %d unacknowledged messages", s.blockTimeout, s.sent-s.acked)
+		case <-s.Context().Done():
+			return status.FromContextError(s.Context().Err()).Err()
+		}
+	}
+	return nil
+}
+
+// ack records an acknowledged count received from the client.
+func (s *flowControlledStream) ack(n uint64) {
+	s.acked = max(s.acked, min(n, s.sent))
+}
@@ -0,0 +1,195 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kubensage/relay/proto/gen"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// forwardQueueSize is the number of messages waiting to be forwarded to the
+// parent relay; further messages are dropped until the queue drains.
+const forwardQueueSize = 1000
+
+// forwardInitialBackoff is the wait before the first reconnection to the parent
+// relay; it doubles on every further failed attempt, up to forwardMaxBackoff.
+const (
+	forwardInitialBackoff = 100 * time.Millisecond
+	forwardMaxBackoff     = 30 * time.Second
+)
+
+// relayForwarder forwards the metrics received from local agents to a parent
+// relay over a persistent SendMetrics client stream, from its own goroutine, so
+// that a slow or unreachable parent never delays the local agents.
+type relayForwarder struct {
+	addr   string                   // Address of the parent relay
+	client gen.MetricsServiceClient // Client of the parent relay
+	queue  chan *gen.Metrics        // Messages waiting to be forwarded
+	logger *zap.Logger              // Logger for observability
+}
+
+// newRelayForwarder creates a relayForwarder and starts its goroutine, which
+// stops and closes the client connection when ctx is done.
+//
+// Parameters:
+//   - ctx: context bounding the forwarder goroutine and its stream.
+//   - logger: zap.Logger for observability.
+//   - addr: gRPC target of the parent relay.
+//   - dialOpts: dial options of the client connection (none = plaintext).
+//
+// Returns:
+//   - *relayForwarder: the running forwarder.
+//   - error: if the client connection cannot be created.
+func newRelayForwarder(ctx context.Context, logger *zap.Logger, addr string, dialOpts []grpc.DialOption) (*relayForwarder, error) {
+	if len(dialOpts) == 0 {
+		dialOpts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	conn, err := grpc.NewClient(addr, dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &relayForwarder{
+		addr:   addr,
+		client: gen.NewMetricsServiceClient(conn),
+		queue:  make(chan *gen.Metrics, forwardQueueSize),
+		logger: logger.With(zap.String("parent_relay", addr)),
+	}
+	go func() {
+		defer conn.Close()
+		f.run(ctx)
+	}()
+	return f, nil
+}
+
+// ForwardTLSCredentials builds the TLS transport credentials of the connection
+// to the parent relay (see WithForwardToRelay).
+//
+// Behavior:
+//   - With certFile and keyFile, the relay presents that client certificate
+//     (mutual TLS).
+//   - With caFile, the parent relay certificate is verified against the CA
+//     certificates of that PEM file instead of the system roots.
+//   - With caFile alone, only the parent relay is authenticated.
+//
+// Parameters:
+//   - certFile: PEM client certificate ("" = none).
+//   - keyFile: PEM private key of certFile ("" = none).
+//   - caFile: PEM CA certificates of the parent relay ("" = system roots).
+//
+// Returns:
+//   - credentials.TransportCredentials: credentials for grpc.WithTransportCredentials.
+//   - error: if a file cannot be read or parsed, or only one of certFile and
+//     keyFile is set.
+func ForwardTLSCredentials(certFile, keyFile, caFile string) (credentials.TransportCredentials, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("client certificate and key must be set together")
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no CA certificate found in %s", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	return credentials.NewTLS(cfg), nil
+}
+
+// enqueue queues msg for forwarding without blocking. Messages are dropped
+// while the queue is full.
+func (f *relayForwarder) enqueue(msg *gen.Metrics) {
+	select {
+	case f.queue <- msg:
+	default:
+		f.logger.Warn("dropping forwarded message: queue full")
+	}
+}
+
+// run keeps a SendMetrics stream open to the parent relay and forwards queued
+// messages in order until ctx is done. Whenever the stream cannot be opened or
+// fails, it is reopened after an exponential backoff; the message whose send
+// failed is forwarded again on the new stream.
+func (f *relayForwarder) run(ctx context.Context) {
+	var pending *gen.Metrics
+	backoff := forwardInitialBackoff
+	for {
+		sent, err := f.stream(ctx, &pending)
+		if ctx.Err() != nil {
+			return
+		}
+		if sent {
+			backoff = forwardInitialBackoff
+		}
+		f.logger.Warn("parent relay stream failed, reconnecting", zap.Duration("backoff", backoff), zap.Error(err))
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+		backoff = min(backoff*2, forwardMaxBackoff)
+	}
+}
+
+// stream opens a SendMetrics stream and forwards queued messages on it until a
+// send fails or ctx is done.
+//
+// Parameters:
+//   - ctx: context bounding the stream.
+//   - pending: message taken from the queue but not forwarded yet; sent first
+//     if set, and set to the message whose send failed.
+//
+// Returns:
+//   - bool: whether at least one message was forwarded.
+//   - error: the reason the stream ended.
+func (f *relayForwarder) stream(ctx context.Context, pending **gen.Metrics) (bool, error) {
+	stream, err := f.client.SendMetrics(ctx)
+	if err != nil {
+		return false, err
+	}
+	f.logger.Info("forwarding metrics to parent relay")
+
+	sent := false
+	for {
+		if *pending == nil {
+			select {
+			case <-ctx.Done():
+				return sent, ctx.Err()
+			case *pending = <-f.queue:
+			}
+		}
+		if err := stream.Send(*pending); err != nil {
+			// Send only reports io.EOF; the actual status comes from the receive side
+			_, err = stream.CloseAndRecv()
+			return sent, err
+		}
+		*pending = nil
+		sent = true
+	}
+}
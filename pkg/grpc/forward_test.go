@@ -0,0 +1,191 @@
+package grpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kubensage/relay/proto/gen"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestForwardToRelaySendsAgentMessagesToParent(t *testing.T) {
+	// The parent relay only starts serving once the child relayed a message
+	parentLis := bufconn.Listen(1 << 20)
+	parent := newTestBroadcaster(t, nil)
+	parentSrv := grpc.NewServer()
+	gen.RegisterMetricsServiceServer(parentSrv, NewMetricsServer(zap.NewNop(), parent))
+	t.Cleanup(parentSrv.Stop)
+	forwarded := make(chan *gen.Metrics, 2)
+	if _, err := parent.Register("parent-sub", forwarded); err != nil {
+		t.Fatal(err)
+	}
+
+	child := newTestBroadcaster(t, nil)
+	client, _ := startTestServer(t, child, WithForwardToRelay(t.Context(), "passthrough:///parent",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return parentLis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	))
+	local := make(chan *gen.Metrics, 2)
+	if _, err := child.Register("child-sub", local); err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := client.SendMetrics(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range []string{"a", "b"} {
+		if err := stream.Send(hostMetrics(host)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := stream.CloseAndRecv(); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, local)
+	receive(t, local)
+
+	go func() { _ = parentSrv.Serve(parentLis) }()
+	for _, want := range []string{"a", "b"} {
+		if host := receive(t, forwarded).GetNodeMetrics().GetHostname(); host != want {
+			t.Fatalf("parent received %s, want %s", host, want)
+		}
+	}
+}
+
+// writeTestCert writes a self-signed certificate for localhost, valid for both
+// server and client authentication, and its key as PEM files.
+//
+// Returns:
+//   - string: the certificate file, also usable as the CA file.
+//   - string: the key file.
+//   - tls.Certificate: the loaded key pair.
+func writeTestCert(t *testing.T) (string, string, tls.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, pair
+}
+
+func TestForwardToRelayOverTLS(t *testing.T) {
+	certFile, keyFile, pair := writeTestCert(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(pair.Leaf)
+
+	tests := []struct {
+		name              string
+		certFile, keyFile string
+		clientAuth        tls.ClientAuthType
+	}{
+		{name: "mutual", certFile: certFile, keyFile: keyFile, clientAuth: tls.RequireAndVerifyClientCert},
+		{name: "server only", clientAuth: tls.NoClientCert},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parentLis := bufconn.Listen(1 << 20)
+			parent := newTestBroadcaster(t, nil)
+			parentSrv := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{
+				Certificates: []tls.Certificate{pair},
+				ClientCAs:    pool,
+				ClientAuth:   tt.clientAuth,
+			})))
+			gen.RegisterMetricsServiceServer(parentSrv, NewMetricsServer(zap.NewNop(), parent))
+			go func() { _ = parentSrv.Serve(parentLis) }()
+			t.Cleanup(parentSrv.Stop)
+			forwarded := make(chan *gen.Metrics, 1)
+			if _, err := parent.Register("parent-sub", forwarded); err != nil {
+				t.Fatal(err)
+			}
+
+			creds, err := ForwardTLSCredentials(tt.certFile, tt.keyFile, certFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client, _ := startTestServer(t, newTestBroadcaster(t, nil), WithForwardToRelay(t.Context(), "passthrough:///localhost",
+				grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+					return parentLis.DialContext(ctx)
+				}),
+				grpc.WithTransportCredentials(creds),
+			))
+
+			stream, err := client.SendMetrics(t.Context())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := stream.Send(hostMetrics("node")); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := stream.CloseAndRecv(); err != nil {
+				t.Fatal(err)
+			}
+			receive(t, forwarded)
+		})
+	}
+}
+
+func TestForwardTLSCredentialsRejectsInvalidFiles(t *testing.T) {
+	certFile, keyFile, _ := writeTestCert(t)
+	if _, err := ForwardTLSCredentials(certFile, "", ""); err == nil {
+		t.Fatal("a certificate without its key was accepted")
+	}
+	if _, err := ForwardTLSCredentials("", keyFile, ""); err == nil {
+		t.Fatal("a key without its certificate was accepted")
+	}
+	if _, err := ForwardTLSCredentials("", "", keyFile); err == nil {
+		t.Fatal("a CA file without certificates was accepted")
+	}
+}
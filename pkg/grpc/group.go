@@ -0,0 +1,113 @@
+package grpc
+
+import (
+	"sync"
+
+	"github.com/kubensage/relay/proto/gen"
+)
+
+// groupChannelSize is the capacity of the channel shared by the members of a consumer group.
+const groupChannelSize = 100
+
+// groupIDPrefix prefixes the Broadcaster subscriber ID of every consumer group.
+const groupIDPrefix = "group:"
+
+// GroupBroadcaster extends Broadcaster with consumer groups (competing consumer
+// pattern).
+//
+// All members of a group receive from a single channel, registered with the
+// Broadcaster as one subscriber named "group:<name>", so every message is
+// delivered to exactly one member. Go serves blocked receivers in FIFO order,
+// so messages are distributed round-robin across the members waiting for one;
+// a member busy sending to its client simply takes fewer messages.
+//
+// Behavior:
+//   - The group channel is registered when its first member joins and
+//     unregistered when its last member leaves.
+//   - If the Broadcaster closes the group channel (e.g., PolicyDisconnect),
+//     every current member sees the channel closed; a later Join creates a new
+//     group channel.
+type GroupBroadcaster struct {
+	*Broadcaster
+	groupsMu sync.Mutex                // Protects groups
+	groups   map[string]*consumerGroup // Group name -> consumer group
+}
+
+// consumerGroup is the shared state of the members of one group.
+type consumerGroup struct {
+	ch      chan *gen.Metrics   // Channel shared by all members
+	members map[string]struct{} // Subscriber IDs of the members
+}
+
+// NewGroupBroadcaster wraps a Broadcaster with consumer group support.
+//
+// Parameters:
+//   - b: the Broadcaster that group channels are registered with.
+//
+// Returns:
+//   - *GroupBroadcaster: the wrapping broadcaster.
+func NewGroupBroadcaster(b *Broadcaster) *GroupBroadcaster {
+	return &GroupBroadcaster{
+		Broadcaster: b,
+		groups:      make(map[string]*consumerGroup),
+	}
+}
+
+// Join adds a subscriber to a consumer group and returns the group channel.
+//
+// Parameters:
+//   - group: Group name.
+//   - id: Unique subscriber identifier.
+//
+// Returns:
+//   - chan *gen.Metrics: the channel shared by the group members.
+//   - error: ErrSubscriberAlreadyExists if id is already a member of the group,
+//     or the Register error if a new group channel cannot be registered.
+func (g *GroupBroadcaster) Join(group, id string) (chan *gen.Metrics, error) {
+	g.groupsMu.Lock()
+	defer g.groupsMu.Unlock()
+
+	cg, ok := g.groups[group]
+	if ok {
+		if _, member := cg.members[id]; member {
+			return nil, ErrSubscriberAlreadyExists
+		}
+	}
+	if !ok || !g.Has(groupIDPrefix+group) {
+		// First member, or the previous group channel was closed by the broadcaster
+		cg = &consumerGroup{
+			ch:      make(chan *gen.Metrics, groupChannelSize),
+			members: make(map[string]struct{}),
+		}
+		if _, err := g.Register(groupIDPrefix+group, cg.ch); err != nil {
+			return nil, err
+		}
+		g.groups[group] = cg
+	}
+	cg.members[id] = struct{}{}
+	return cg.ch, nil
+}
+
+// Leave removes a subscriber from a consumer group. When the last member
+// leaves, the group channel is unregistered from the Broadcaster.
+//
+// Parameters:
+//   - group: Group name.
+//   - id: Subscriber identifier passed to Join.
+func (g *GroupBroadcaster) Leave(group, id string) {
+	g.groupsMu.Lock()
+	defer g.groupsMu.Unlock()
+
+	cg, ok := g.groups[group]
+	if !ok {
+		return
+	}
+	if _, member := cg.members[id]; !member {
+		return
+	}
+	delete(cg.members, id)
+	if len(cg.members) == 0 {
+		delete(g.groups, group)
+		g.Unregister(groupIDPrefix + group)
+	}
+}
@@ -0,0 +1,75 @@
+package grpc
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestConsumerGroupDeliversEachMessageOnce(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	client, _ := startTestServer(t, b)
+
+	type delivery struct {
+		member int
+		host   string
+	}
+	deliveries := make(chan delivery, 30)
+	for member := range 3 {
+		stream, err := client.SubscribeMetrics(withMetadata(t, consumerGroupKey, "workers"), &emptypb.Empty{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stream.Header(); err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			for {
+				msg, err := stream.Recv()
+				if err != nil {
+					return
+				}
+				deliveries <- delivery{member: member, host: msg.GetNodeMetrics().GetHostname()}
+			}
+		}()
+	}
+	if n := b.SubscriberCount(); n != 1 {
+		t.Fatalf("broadcaster subscribers: got %d, want the single group channel", n)
+	}
+
+	for i := range 30 {
+		b.Broadcast(hostMetrics(fmt.Sprintf("node-%d", i)))
+	}
+	seen := map[string]int{}
+	for range 30 {
+		select {
+		case d := <-deliveries:
+			if prev, ok := seen[d.host]; ok {
+				t.Fatalf("message %s delivered to members %d and %d", d.host, prev, d.member)
+			}
+			seen[d.host] = d.member
+		case <-time.After(time.Second):
+			t.Fatalf("received %d of 30 messages", len(seen))
+		}
+	}
+}
+
+func TestGroupChannelIsUnregisteredWithLastMember(t *testing.T) {
+	g := NewGroupBroadcaster(newTestBroadcaster(t, nil))
+	for _, id := range []string{"a", "b"} {
+		if _, err := g.Join("workers", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	g.Leave("workers", "a")
+	if !g.Has(groupIDPrefix + "workers") {
+		t.Fatal("group channel unregistered while a member remains")
+	}
+	g.Leave("workers", "b")
+	if g.Has(groupIDPrefix + "workers") {
+		t.Fatal("group channel still registered after its last member left")
+	}
+}
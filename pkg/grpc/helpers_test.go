@@ -0,0 +1,106 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kubensage/relay/proto/gen"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestBroadcaster creates a Broadcaster bounded by the test context, whose
+// metrics are registered on reg, or on a fresh registry if reg is nil.
+func newTestBroadcaster(t testing.TB, reg *prometheus.Registry, opts ...BroadcasterOption) *Broadcaster {
+	t.Helper()
+	if reg == nil {
+		reg = prometheus.NewRegistry()
+	}
+	return NewBroadcaster(t.Context(), append([]BroadcasterOption{WithMetrics(reg)}, opts...)...)
+}
+
+// startTestServer serves a MetricsServer for b over an in-memory connection
+// until the test ends.
+//
+// Returns:
+//   - gen.MetricsServiceClient: a client connected to the server.
+//   - *MetricsServer: the served server.
+func startTestServer(t testing.TB, b *Broadcaster, opts ...ServerOption) (gen.MetricsServiceClient, *MetricsServer) {
+	t.Helper()
+	return startLoggedTestServer(t, zap.NewNop(), b, opts...)
+}
+
+// startLoggedTestServer is startTestServer for a server logging to logger.
+func startLoggedTestServer(t testing.TB, logger *zap.Logger, b *Broadcaster, opts ...ServerOption) (gen.MetricsServiceClient, *MetricsServer) {
+	t.Helper()
+	ms := NewMetricsServer(logger, b, opts...)
+	return gen.NewMetricsServiceClient(serveTest(t, func(srv *grpc.Server) {
+		gen.RegisterMetricsServiceServer(srv, ms)
+	})), ms
+}
+
+// serveTest starts a gRPC server with the given options and the services
+// registered by register, and returns a client connection to it. Both are
+// closed when the test ends.
+func serveTest(t testing.TB, register func(*grpc.Server), opts ...grpc.ServerOption) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(opts...)
+	register(srv)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("grpc.NewClient: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+// withMetadata returns a copy of the test context carrying the given outgoing
+// metadata key-value pairs.
+func withMetadata(t testing.TB, kv ...string) context.Context {
+	return metadata.AppendToOutgoingContext(t.Context(), kv...)
+}
+
+// waitFor polls cond until it returns true, failing the test after a second.
+func waitFor(t testing.TB, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// receive returns the next message queued on ch, failing the test if none
+// arrives within a second.
+func receive(t testing.TB, ch <-chan *gen.Metrics) *gen.Metrics {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a message")
+		return nil
+	}
+}
+
+// hostMetrics returns a Metrics message from the node with the given hostname.
+func hostMetrics(host string) *gen.Metrics {
+	return &gen.Metrics{NodeMetrics: &gen.NodeMetrics{Hostname: host}}
+}
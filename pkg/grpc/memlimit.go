@@ -0,0 +1,198 @@
+package grpc
+
+import (
+	"sync"
+
+	"github.com/kubensage/relay/proto/gen"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+// memTracker approximates the memory held by the messages queued on a single
+// subscriber (WithMemoryLimit), as the encoded size of every message queued by
+// the Broadcaster.
+//
+// Subscribers receive from their queue without notifying the Broadcaster, so
+// the records are reconciled with the queue length before they are used: the
+// queue is FIFO, so the records beyond its length are the oldest ones, either
+// received or overwritten.
+type memTracker struct {
+	mu    sync.Mutex
+	sizes []int64 // Encoded sizes of the queued messages, oldest first
+	total int64   // Sum of sizes
+}
+
+// push records a queued message of size bytes.
+func (t *memTracker) push(size int64) {
+	t.mu.Lock()
+	t.sizes = append(t.sizes, size)
+	t.total += size
+	t.mu.Unlock()
+}
+
+// sync forgets the oldest records beyond queued, the current queue length.
+//
+// Returns:
+//   - int64: number of bytes forgotten.
+func (t *memTracker) sync(queued int) int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var freed int64
+	n := 0
+	for len(t.sizes)-n > queued {
+		freed += t.sizes[n]
+		n++
+	}
+	if n > 0 {
+		t.sizes = append(t.sizes[:0], t.sizes[n:]...)
+		t.total -= freed
+	}
+	return freed
+}
+
+// reset forgets every record.
+//
+// Returns:
+//   - int64: number of bytes forgotten.
+func (t *memTracker) reset() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	freed := t.total
+	t.sizes = t.sizes[:0]
+	t.total = 0
+	return freed
+}
+
+// bytes returns the recorded size of the queued messages.
+func (t *memTracker) bytes() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.total
+}
+
+// queueLen returns the number of messages queued on the subscriber.
+func (s *subscriber) queueLen() int {
+	if s.ring != nil {
+		return s.ring.Len()
+	}
+	return len(s.ch)
+}
+
+// QueuedBytes returns the approximate memory held by the messages queued on
+// all subscribers, as tracked with WithMemoryLimit (always 0 without it). It may
+// include messages received since the last broadcast.
+func (b *Broadcaster) QueuedBytes() int64 {
+	return b.memUsed.Load()
+}
+
+// trackReplayed accounts a replayed message queued on sub. Replays never flush
+// other subscribers: the limit is enforced again on the next broadcast.
+func (b *Broadcaster) trackReplayed(sub *subscriber, msg *gen.Metrics) {
+	if sub.mem == nil {
+		return
+	}
+	size := int64(proto.Size(msg))
+	sub.mem.push(size)
+	b.memUsed.Add(size)
+}
+
+// reserveMemory makes room under the memory limit for a message of size bytes
+// about to be queued on sub. While the limit would be exceeded, the queue of
+// the oldest-registered subscriber holding queued messages, possibly sub
+// itself, is flushed. The caller must hold closeMu for reading.
+//
+// Returns:
+//   - bool: false if the message alone exceeds the limit, in which case nothing
+//     is flushed and the message must be dropped.
+func (b *Broadcaster) reserveMemory(sub *subscriber, size int64) bool {
+	if size > b.cfg.memoryLimit {
+		return false
+	}
+	b.memUsed.Add(-sub.mem.sync(sub.queueLen()))
+
+	synced := false
+	for b.memUsed.Load()+size > b.cfg.memoryLimit {
+		if !synced {
+			// Forgetting the messages other subscribers already received may be enough
+			for _, other := range b.load() {
+				if other.mem != nil {
+					b.memUsed.Add(-other.mem.sync(other.queueLen()))
+				}
+			}
+			synced = true
+			continue
+		}
+
+		victimID, victim := b.oldestQueued()
+		if victim == nil {
+			return false
+		}
+		b.flushQueue(victimID, victim)
+	}
+	return true
+}
+
+// oldestQueued returns the oldest-registered subscriber holding queued
+// messages, or a nil subscriber if there is none.
+func (b *Broadcaster) oldestQueued() (string, *subscriber) {
+	var oldestID string
+	var oldest *subscriber
+	for id, sub := range b.load() {
+		if sub.mem == nil || sub.mem.bytes() == 0 {
+			continue
+		}
+		if oldest == nil || sub.registeredAt.Before(oldest.registeredAt) {
+			oldestID, oldest = id, sub
+		}
+	}
+	return oldestID, oldest
+}
+
+// flushQueue drains the queue of a subscriber, counting every drained message
+// as dropped, to free memory under the memory limit. The caller must hold
+// closeMu for reading.
+func (b *Broadcaster) flushQueue(id string, sub *subscriber) {
+	flushed := 0
+	if sub.ring != nil {
+		for {
+			msg, ok := sub.ring.Recv()
+			if !ok {
+				break
+			}
+			b.drop(id, sub, msg)
+			flushed++
+		}
+	} else {
+		flushed = b.drainChannel(id, sub)
+	}
+	freed := sub.mem.reset()
+	b.memUsed.Add(-freed)
+
+	b.logger.Warn("flushed subscriber queue: memory limit reached",
+		zap.String("subscriber_id", id),
+		zap.Int("flushed", flushed),
+		zap.Int64("freed_bytes", freed),
+		zap.Int64("memory_limit_bytes", b.cfg.memoryLimit),
+	)
+}
+
+// drainChannel receives every message queued on the channel of sub without
+// blocking, counting each one as dropped for subscriber id.
+//
+// Returns:
+//   - int: number of drained messages.
+func (b *Broadcaster) drainChannel(id string, sub *subscriber) int {
+	drained := 0
+	for {
+		select {
+		case msg, ok := <-sub.ch:
+			if !ok {
+				return drained
+			}
+			b.drop(id, sub, msg)
+			drained++
+		default:
+			return drained
+		}
+	}
+}
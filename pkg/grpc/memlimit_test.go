@@ -0,0 +1,55 @@
+package grpc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kubensage/relay/proto/gen"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestMemoryLimitBoundsQueuedBytes(t *testing.T) {
+	msg := hostMetrics("node")
+	size := int64(proto.Size(msg))
+	limit := 3 * size
+	b := newTestBroadcaster(t, nil, WithMemoryLimit(limit))
+	oldest, newest := make(chan *gen.Metrics, 10), make(chan *gen.Metrics, 10)
+	if _, err := b.Register("oldest", oldest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Register("newest", newest); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 5 {
+		b.Broadcast(msg)
+		if queued := b.QueuedBytes(); queued > limit {
+			t.Fatalf("queued bytes: got %d, want at most %d", queued, limit)
+		}
+	}
+	// The oldest subscriber is flushed first
+	if int64(len(oldest)+len(newest))*size > limit || len(oldest) >= len(newest) {
+		t.Fatalf("queued messages: oldest %d, newest %d, want at most 3 with the oldest flushed", len(oldest), len(newest))
+	}
+	if dropped := b.Stats().TotalDropped; dropped == 0 {
+		t.Fatal("flushed messages were not counted as dropped")
+	}
+
+	// Received messages release their share
+	for len(oldest) > 0 {
+		<-oldest
+	}
+	for len(newest) > 0 {
+		<-newest
+	}
+	b.Broadcast(msg)
+	if queued := b.QueuedBytes(); queued != 2*size {
+		t.Fatalf("queued bytes after receiving: got %d, want %d", queued, 2*size)
+	}
+
+	// A message larger than the limit is dropped without flushing anything
+	b.Broadcast(hostMetrics(strings.Repeat("n", int(limit))))
+	if len(oldest) != 1 || len(newest) != 1 {
+		t.Fatalf("after an oversized message: oldest %d, newest %d queued, want 1 each", len(oldest), len(newest))
+	}
+}
@@ -0,0 +1,116 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/kubensage/relay/proto/gen"
+)
+
+// mergerMaxBatch is the maximum number of queued messages the merger
+// broadcasts with a single BroadcastBatch call.
+const mergerMaxBatch = 256
+
+// mergedMessage is a message queued on the merger by an agent stream.
+type mergedMessage struct {
+	msg     *gen.Metrics
+	cluster *Broadcaster // Broadcaster of the stream's cluster topic (nil = none)
+}
+
+// merger broadcasts the messages of all agent streams from a single goroutine,
+// so that concurrent streams do not contend on the Broadcaster: the messages
+// queued while a broadcast runs are broadcast together, over one subscriber
+// snapshot, by the next one.
+type merger struct {
+	ctx         context.Context    // Bounds the merger goroutine
+	broadcaster *Broadcaster       // Default topic Broadcaster
+	queue       chan mergedMessage // Messages waiting to be broadcast
+}
+
+// newMerger creates a merger and starts its goroutine, which stops when ctx is
+// done.
+//
+// Parameters:
+//   - ctx: context bounding the merger goroutine.
+//   - broadcaster: Broadcaster of the default topic.
+//   - size: capacity of the merger queue.
+//
+// Returns:
+//   - *merger: the running merger.
+func newMerger(ctx context.Context, broadcaster *Broadcaster, size int) *merger {
+	m := &merger{
+		ctx:         ctx,
+		broadcaster: broadcaster,
+		queue:       make(chan mergedMessage, size),
+	}
+	go m.run()
+	return m
+}
+
+// enqueue queues msg for broadcasting, waiting while the queue is full. Once
+// the merger has stopped, msg is broadcast directly instead.
+//
+// Parameters:
+//   - ctx: the agent stream context, bounding the wait.
+//   - cluster: Broadcaster of the stream's cluster topic (nil = none).
+//   - msg: the message to broadcast.
+//
+// Returns:
+//   - error: ctx.Err() if ctx is done before msg could be queued.
+func (m *merger) enqueue(ctx context.Context, cluster *Broadcaster, msg *gen.Metrics) error {
+	select {
+	case m.queue <- mergedMessage{msg: msg, cluster: cluster}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-m.ctx.Done():
+		m.broadcaster.Broadcast(msg)
+		if cluster != nil {
+			cluster.Broadcast(msg)
+		}
+		return nil
+	}
+}
+
+// run broadcasts queued messages until ctx is done.
+func (m *merger) run() {
+	batch := make([]*gen.Metrics, 0, mergerMaxBatch)
+	clusters := make(map[*Broadcaster][]*gen.Metrics)
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case first := <-m.queue:
+			batch = m.collect(first, batch, clusters)
+			m.broadcaster.BroadcastBatch(batch)
+			for cluster, msgs := range clusters {
+				cluster.BroadcastBatch(msgs)
+				delete(clusters, cluster)
+			}
+			clear(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// collect appends first, then the messages already queued behind it, up to
+// mergerMaxBatch in total, to batch and to the batch of their cluster topic.
+//
+// Returns:
+//   - []*gen.Metrics: the extended batch.
+func (m *merger) collect(first mergedMessage, batch []*gen.Metrics, clusters map[*Broadcaster][]*gen.Metrics) []*gen.Metrics {
+	next := first
+	for {
+		batch = append(batch, next.msg)
+		if next.cluster != nil {
+			clusters[next.cluster] = append(clusters[next.cluster], next.msg)
+		}
+		if len(batch) >= mergerMaxBatch {
+			return batch
+		}
+		select {
+		case next = <-m.queue:
+		default:
+			return batch
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package grpc
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/kubensage/relay/proto/gen"
+)
+
+// sendFromAgents sends messages messages from each of agents concurrent
+// SendMetrics streams, whose hostnames are agent-<i>, and waits for the
+// streams to complete.
+func sendFromAgents(tb testing.TB, client gen.MetricsServiceClient, agents, messages int) {
+	tb.Helper()
+	var wg sync.WaitGroup
+	for i := range agents {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stream, err := client.SendMetrics(tb.Context())
+			if err != nil {
+				tb.Error(err)
+				return
+			}
+			msg := hostMetrics(fmt.Sprintf("agent-%d", i))
+			for range messages {
+				if err := stream.Send(msg); err != nil {
+					tb.Error(err)
+					return
+				}
+			}
+			if _, err := stream.CloseAndRecv(); err != nil {
+				tb.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMergerBroadcastsEveryAgentMessage(t *testing.T) {
+	const agents, messages = 10, 20
+
+	b := newTestBroadcaster(t, nil)
+	client, _ := startTestServer(t, b, WithMerger(t.Context(), 4))
+	ch := make(chan *gen.Metrics, agents*messages)
+	if _, err := b.Register("sub", ch); err != nil {
+		t.Fatal(err)
+	}
+
+	sendFromAgents(t, client, agents, messages)
+	got := map[string]int{}
+	for range agents * messages {
+		got[receive(t, ch).GetNodeMetrics().GetHostname()]++
+	}
+	for i := range agents {
+		if n := got[fmt.Sprintf("agent-%d", i)]; n != messages {
+			t.Fatalf("messages of agent-%d: got %d, want %d", i, n, messages)
+		}
+	}
+}
+
+// BenchmarkAgentBroadcast compares direct broadcasting by 100 concurrent agent
+// streams with the merger, for 10 subscribers.
+func BenchmarkAgentBroadcast(b *testing.B) {
+	const agents, subscribers = 100, 10
+
+	run := func(b *testing.B, opts ...ServerOption) {
+		br := newTestBroadcaster(b, nil)
+		client, _ := startTestServer(b, br, opts...)
+		var wg sync.WaitGroup
+		for i := range subscribers {
+			ch := make(chan *gen.Metrics, 1024)
+			if _, err := br.Register(fmt.Sprintf("sub-%d", i), ch); err != nil {
+				b.Fatal(err)
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range ch {
+				}
+			}()
+		}
+		b.Cleanup(func() {
+			br.UnregisterAll()
+			wg.Wait()
+		})
+
+		b.ResetTimer()
+		sendFromAgents(b, client, agents, max(b.N/agents, 1))
+	}
+
+	b.Run("direct", func(b *testing.B) { run(b) })
+	b.Run("merger", func(b *testing.B) { run(b, WithMerger(b.Context(), 1024)) })
+}
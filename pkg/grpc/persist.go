@@ -0,0 +1,112 @@
+package grpc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kubensage/relay/proto/gen"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// persistIDKey is the metadata key carrying an optional persistent subscriber ID.
+const persistIDKey = "relay-subscriber-persist-id"
+
+// persistState tracks the delivery position of a persistent subscriber across
+// its SubscribeMetrics streams.
+type persistState struct {
+	mu             sync.Mutex // Protects the fields below
+	lastSeq        uint64     // Sequence number of the last message handed to the stream
+	active         bool       // Whether a stream currently uses this state
+	disconnectedAt time.Time  // End of the last stream, for expiry
+}
+
+// persistentID returns the relay-subscriber-persist-id metadata, or an empty
+// string if absent or if WithPersistentSubscribers is not set.
+//
+// Parameters:
+//   - ctx: stream context carrying the incoming metadata.
+//
+// Returns:
+//   - string: the persistent subscriber ID.
+func (s *MetricsServer) persistentID(ctx context.Context) string {
+	if s.cfg.persistTTL <= 0 {
+		return ""
+	}
+	values := metadata.ValueFromIncomingContext(ctx, persistIDKey)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// claimPersistState returns the delivery state of a persistent subscriber and
+// marks it as in use. State left unused for longer than the persistence TTL is
+// discarded, both for this ID and for every other inactive ID.
+//
+// Parameters:
+//   - persistID: the persistent subscriber ID.
+//
+// Returns:
+//   - *persistState: the claimed state; release it with releasePersistState.
+//   - uint64: sequence number of the last message delivered under this ID (0 = none).
+//   - error: codes.AlreadyExists if another stream uses the same persistent ID.
+func (s *MetricsServer) claimPersistState(persistID string) (*persistState, uint64, error) {
+	now := time.Now()
+	s.persistStates.Range(func(key, value any) bool {
+		st := value.(*persistState)
+		st.mu.Lock()
+		expired := !st.active && now.Sub(st.disconnectedAt) > s.cfg.persistTTL
+		st.mu.Unlock()
+		if expired {
+			s.persistStates.CompareAndDelete(key, value)
+		}
+		return true
+	})
+
+	v, _ := s.persistStates.LoadOrStore(persistID, &persistState{})
+	st := v.(*persistState)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.active {
+		return nil, 0, status.Errorf(codes.AlreadyExists, "persistent subscriber %s is already connected", persistID)
+	}
+	st.active = true
+	return st, st.lastSeq, nil
+}
+
+// releasePersistState marks a claimed state as unused, starting its expiry.
+func (s *MetricsServer) releasePersistState(st *persistState) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.active = false
+	st.disconnectedAt = time.Now()
+}
+
+// advance records msg as delivered, before it is sent. Recording first gives
+// at-most-once delivery: a message lost in a failing Send is not delivered again
+// after a reconnect.
+//
+// Parameters:
+//   - b: the Broadcaster that assigned the sequence numbers.
+//   - msg: the message about to be sent.
+//
+// Returns:
+//   - bool: false if the message was already delivered and must be skipped.
+func (st *persistState) advance(b *Broadcaster, msg *gen.Metrics) bool {
+	seq, ok := b.SequenceOf(msg)
+	if !ok {
+		// Already evicted from the replay buffer, so it cannot be replayed either
+		return true
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if seq <= st.lastSeq {
+		return false
+	}
+	st.lastSeq = seq
+	return true
+}
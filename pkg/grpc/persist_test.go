@@ -0,0 +1,59 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestPersistentSubscriberResumesWithoutDuplicates(t *testing.T) {
+	b := newTestBroadcaster(t, nil, WithReplayBuffer(10))
+	client, ms := startTestServer(t, b, WithPersistentSubscribers(time.Minute))
+
+	firstCtx, cancelFirst := context.WithCancel(withMetadata(t, persistIDKey, "dashboard"))
+	first, err := client.SubscribeMetrics(firstCtx, &emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := first.Header(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := subscribeHeader(t, withMetadata(t, persistIDKey, "dashboard"), client); status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("second stream with the persistent ID: got %v, want AlreadyExists", err)
+	}
+
+	for _, host := range []string{"before-1", "before-2"} {
+		b.Broadcast(hostMetrics(host))
+		if _, err := first.Recv(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cancelFirst()
+	waitFor(t, "the first stream to release its persistent state", func() bool {
+		v, ok := ms.persistStates.Load("dashboard")
+		if !ok {
+			return false
+		}
+		st := v.(*persistState)
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		return !st.active
+	})
+	b.Broadcast(hostMetrics("while-away"))
+
+	second, err := client.SubscribeMetrics(withMetadata(t, persistIDKey, "dashboard"), &emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := second.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := msg.GetNodeMetrics().GetHostname(); got != "while-away" {
+		t.Fatalf("first message after resuming: got %q, want while-away without the delivered ones", got)
+	}
+}
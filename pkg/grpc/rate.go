@@ -0,0 +1,40 @@
+package grpc
+
+import (
+	"math"
+	"time"
+)
+
+// ewmaRate estimates an event rate (events per second) as an exponentially
+// weighted moving average.
+//
+// Every observed event adds 1/window to the rate, and the rate decays by
+// e^(-dt/window) between events, so a steady rate r converges to r with a time
+// constant of window. It is not safe for concurrent use.
+type ewmaRate struct {
+	window time.Duration // Averaging time constant
+	rate   float64       // Current estimate in events per second
+	last   time.Time     // Time of the last observed event
+}
+
+// newEWMARate creates an ewmaRate with the given averaging window.
+func newEWMARate(window time.Duration) *ewmaRate {
+	return &ewmaRate{window: window}
+}
+
+// observe records an event at now and returns the updated rate.
+//
+// Parameters:
+//   - now: time of the event.
+//
+// Returns:
+//   - float64: the estimated rate in events per second.
+func (e *ewmaRate) observe(now time.Time) float64 {
+	w := e.window.Seconds()
+	if !e.last.IsZero() {
+		e.rate *= math.Exp(-now.Sub(e.last).Seconds() / w)
+	}
+	e.rate += 1 / w
+	e.last = now
+	return e.rate
+}
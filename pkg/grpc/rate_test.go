@@ -0,0 +1,45 @@
+package grpc
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestEWMARateConvergesToSteadyRate(t *testing.T) {
+	rate := newEWMARate(time.Second)
+	now := time.Now()
+	var got float64
+	// 100 events per second for 10 windows
+	for range 1000 {
+		now = now.Add(10 * time.Millisecond)
+		got = rate.observe(now)
+	}
+	if math.Abs(got-100) > 1 {
+		t.Fatalf("rate: got %.2f events/s, want about 100", got)
+	}
+}
+
+func TestAgentRateAlertIsLoggedOnce(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	client, _ := startLoggedTestServer(t, zap.New(core), newTestBroadcaster(t, nil), WithAgentRateAlert(100, time.Second))
+
+	stream, err := client.SendMetrics(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 1000 {
+		if err := stream.Send(hostMetrics("node")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := stream.CloseAndRecv(); err != nil {
+		t.Fatal(err)
+	}
+	if n := logs.FilterMessage("agent send rate above threshold").Len(); n != 1 {
+		t.Fatalf("rate alerts: got %d, want one within the alert interval", n)
+	}
+}
@@ -0,0 +1,78 @@
+package grpc
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"weak"
+
+	"github.com/google/uuid"
+	"github.com/kubensage/relay/proto/gen"
+	"go.uber.org/zap"
+)
+
+// requestIDs maps received messages to the request ID assigned by
+// assignRequestID. Entries are keyed by weak pointers and removed once their
+// message is garbage collected, so that the ID travels with the message through
+// the Broadcaster without being part of the proto data.
+var requestIDs sync.Map // weak.Pointer[gen.Metrics] -> string
+
+// requestIDContextKey is the context key of the request ID of the message being
+// handled.
+type requestIDContextKey struct{}
+
+// assignRequestID assigns a new UUID request ID to msg.
+//
+// Returns:
+//   - string: the assigned request ID.
+func assignRequestID(msg *gen.Metrics) string {
+	id := uuid.NewString()
+	setRequestID(msg, id)
+	return id
+}
+
+// setRequestID associates id with msg until msg is garbage collected.
+func setRequestID(msg *gen.Metrics, id string) {
+	key := weak.Make(msg)
+	requestIDs.Store(key, id)
+	runtime.AddCleanup(msg, func(key weak.Pointer[gen.Metrics]) {
+		requestIDs.Delete(key)
+	}, key)
+}
+
+// requestIDOf returns the request ID of msg, or "" if none was assigned (e.g.
+// messages read from stdin).
+func requestIDOf(msg *gen.Metrics) string {
+	if v, ok := requestIDs.Load(weak.Make(msg)); ok {
+		return v.(string)
+	}
+	return ""
+}
+
+// copyRequestID assigns the request ID of from, if any, to its replacement to,
+// e.g. a copy or the result of a message transformer.
+func copyRequestID(from, to *gen.Metrics) {
+	if from == to {
+		return
+	}
+	if id := requestIDOf(from); id != "" {
+		setRequestID(to, id)
+	}
+}
+
+// contextWithRequestID returns a copy of ctx carrying the request ID of the
+// message being handled.
+func contextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// requestIDFromContext returns the request ID carried by ctx, or "" if none.
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// requestIDField returns the request_id log field of msg.
+func requestIDField(msg *gen.Metrics) zap.Field {
+	return zap.String("request_id", requestIDOf(msg))
+}
@@ -1,115 +1,1512 @@
 package grpc
 
 import (
+	"context"
+	"errors"
 	"io"
+	"math"
+	"net"
+	"path"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/kubensage/relay/pkg/buildinfo"
+	"github.com/kubensage/relay/pkg/metrics"
+	proto2 "github.com/kubensage/relay/pkg/proto"
+	"github.com/kubensage/relay/pkg/ringbuf"
+	"github.com/kubensage/relay/pkg/token"
 	"github.com/kubensage/relay/proto/gen"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// agentIDKey is the metadata key carrying the agent ID, both as an optional
+// request header and in the AgentControl response header.
+const agentIDKey = "relay-agent-id"
+
+// controlQueueSize is the capacity of each agent's pending control message queue.
+const controlQueueSize = 16
+
+// subscriberBatchSizeKey and subscriberBatchFlushKey are the metadata keys
+// configuring SubscribeMetricsBatch.
+const (
+	subscriberBatchSizeKey  = "relay-batch-size"
+	subscriberBatchFlushKey = "relay-batch-flush-ms"
+)
+
+// SubscribeMetricsBatch defaults and limits.
+const (
+	maxSubscriberBatchSize      = 1000
+	defaultSubscriberBatchFlush = time.Second
+)
+
+// ringPollInterval is how often an empty subscriber ring buffer is polled (WithRingBuffer).
+const ringPollInterval = 50 * time.Millisecond
+
+// retryAfterKey is the metadata key carrying the number of seconds after which
+// a rejected agent should retry.
+const retryAfterKey = "retry-after"
+
+// defaultPausedRetryAfter is the retry delay suggested to agents rejected while
+// the broadcaster is paused, unless set with WithPausedRetryAfter; PauseAll has
+// no planned resume time to derive it from.
+const defaultPausedRetryAfter = 10 * time.Second
+
+// rateAlertInterval is the minimum interval between two send rate warnings for the same agent stream.
+const rateAlertInterval = 10 * time.Second
+
+var (
+	// ErrAgentNotFound is returned when no AgentControl stream exists for an agent ID.
+	ErrAgentNotFound = errors.New("agent not found")
+	// ErrControlQueueFull is returned when an agent's control message queue is full.
+	ErrControlQueueFull = errors.New("agent control queue full")
+)
+
+// reconnectTokenKey is the metadata key carrying a subscriber reconnection token,
+// both in the SubscribeMetrics response header and in the reconnect request.
+const reconnectTokenKey = "relay-reconnect-token"
+
+// subscriberIDKey is the SubscribeMetrics response header carrying the subscriber ID.
+const subscriberIDKey = "relay-subscriber-id"
+
+// subscriberCountKey is the SubscribeMetrics response header carrying the
+// number of subscribers of the topic, including the new one.
+const subscriberCountKey = "relay-subscriber-count"
+
 // MetricsServer implements the gRPC MetricsServiceServer interface.
 //
 // Responsibilities:
 //   - Accepts streamed metrics from agents via SendMetrics.
 //   - Fans out incoming metrics to all active subscribers via a Broadcaster.
 //   - Allows clients to subscribe to a live metrics stream via SubscribeMetrics.
+//   - Reports aggregate statistics of the relayed metrics via GetMetricsSummary.
+//
+// Logging convention: every stream handler derives a child logger from s.logger
+// at its start, carrying the stream identity (subscriber_id, peer_addr, ...),
+// and uses only that child logger afterwards. New handlers must follow the same
+// pattern so that every log line of a stream can be correlated.
 type MetricsServer struct {
 	gen.UnimplementedMetricsServiceServer
-	broadcaster *Broadcaster // Manages subscribers and broadcasts messages
-	logger      *zap.Logger  // Structured logger for observability
+	broadcaster *Broadcaster      // Manages subscribers and broadcasts messages
+	groups      *GroupBroadcaster // Manages consumer groups on top of broadcaster
+	logger      *zap.Logger       // Structured logger for observability
+	cfg         serverConfig      // Optional behavior set through ServerOption
+	startedAt   time.Time         // Creation time, reported as uptime by Ping
+
+	activeAgents atomic.Int64 // Number of currently open agent streams
+	controlChs   sync.Map     // Agent ID -> chan *gen.ControlMessage for AgentControl streams
+	activeIPs    sync.Map     // Agent IP -> struct{} for open agent streams (WithOneStreamPerIP)
+	sendAgentIDs sync.Map     // Agent ID -> struct{} for open SendMetrics and SendMetricsV2 streams
+
+	agentConns        sync.Map // Agent ID -> *agentConn for open agent streams
+	subscriberInfos   sync.Map // Subscriber ID -> SubscriberInfo for connected subscribers
+	subscriberCancels sync.Map // Subscriber ID -> context.CancelFunc ending the subscriber stream (DisconnectSubscriber)
+
+	summary summaryStats // Counters reported by GetMetricsSummary
+
+	persistStates sync.Map // Persistent subscriber ID -> *persistState (WithPersistentSubscribers)
+	topics        sync.Map // Cluster name -> *topic for relay-cluster-name routing
+	topicsMu      sync.Mutex
+	topicCount    int // Number of entries in topics, protected by topicsMu
+
+	forwarder *relayForwarder // Forwards accepted messages to a parent relay (nil = disabled)
+	merger    *merger         // Broadcasts the messages of all agent streams serially (nil = disabled)
 }
 
 // NewMetricsServer creates a new MetricsServer.
 //
 // Parameters:
 //   - logger: zap.Logger for structured logging.
+//   - broadcaster: Broadcaster used to fan out received metrics.
+//   - opts: optional ServerOption values.
 //
 // Returns:
 //   - *MetricsServer: initialized server ready to be registered with gRPC.
-func NewMetricsServer(logger *zap.Logger) *MetricsServer {
-	return &MetricsServer{
-		broadcaster: NewBroadcaster(logger),
+func NewMetricsServer(logger *zap.Logger, broadcaster *Broadcaster, opts ...ServerOption) *MetricsServer {
+	s := &MetricsServer{
+		broadcaster: broadcaster,
+		groups:      NewGroupBroadcaster(broadcaster),
 		logger:      logger,
+		startedAt:   time.Now(),
+	}
+	for _, opt := range opts {
+		opt(&s.cfg)
+	}
+	if s.cfg.mergerSize > 0 {
+		s.merger = newMerger(s.cfg.mergerCtx, broadcaster, s.cfg.mergerSize)
+	}
+	if s.cfg.forwardAddr != "" {
+		forwarder, err := newRelayForwarder(s.cfg.forwardCtx, logger, s.cfg.forwardAddr, s.cfg.forwardDialOpts)
+		if err != nil {
+			logger.Error("failed to create parent relay client, forwarding disabled", zap.String("parent_relay", s.cfg.forwardAddr), zap.Error(err))
+		} else {
+			s.forwarder = forwarder
+		}
 	}
+	return s
+}
+
+// Ping is a unary liveness check, usable by probes that cannot open streams.
+//
+// Parameters:
+//   - _ (context.Context): unused request context.
+//   - _ (*emptypb.Empty): unused request.
+//
+// Returns:
+//   - *gen.PingResponse: the current server time, build version and uptime in seconds.
+//   - error: always nil.
+func (s *MetricsServer) Ping(_ context.Context, _ *emptypb.Empty) (*gen.PingResponse, error) {
+	now := time.Now()
+	return &gen.PingResponse{
+		ServerTime:    timestamppb.New(now),
+		Version:       buildinfo.Version,
+		UptimeSeconds: int64(now.Sub(s.startedAt).Seconds()),
+	}, nil
 }
 
 // SendMetrics handles incoming streamed metrics from agents.
 //
 // Behavior:
+//   - With WithOneStreamPerIP, a stream from an IP that already has an open
+//     agent stream is rejected with codes.AlreadyExists.
+//   - With WithSupportedAgentVersions, an unsupported relay-agent-version is logged
+//     and, if required, the stream is rejected with codes.FailedPrecondition.
+//   - A stream whose relay-agent-id already has an open SendMetrics or
+//     SendMetricsV2 stream is rejected with codes.AlreadyExists, unless
+//     WithAgentIDReuse is set.
+//   - The stream is counted in ActiveAgentCount and listed in Agents while it is open.
+//   - All log lines carry the agent ID (agent_id, the relay-agent-id metadata or
+//     a generated UUID, as listed in Agents) and peer address (peer_addr).
 //   - Continuously reads from the gRPC stream until EOF or error.
 //   - Each received message is logged at INFO level (host, pod count).
-//   - Messages are broadcasted to all active subscribers.
+//   - The time from the stream opening to its first message is logged and
+//     observed in relay_agent_time_to_first_message_seconds.
+//   - With WithAgentLogInterval, a summary of the messages, bytes and distinct
+//     pods received during each interval is logged at INFO level.
+//   - When the stream ends, its duration is observed in relay_stream_duration_seconds
+//     with rpc_method and exit_reason labels (see observeStream).
+//   - A message listing the same pod (namespace/name) twice ends the stream with
+//     codes.InvalidArgument and is not broadcast.
+//   - With WithMaxMessageSize, a message whose encoded size exceeds the limit
+//     ends the stream with codes.InvalidArgument and is not broadcast.
+//   - With WithMaxPodsPerMessage, a message with more PodMetrics than the limit
+//     ends the stream with codes.InvalidArgument and is not broadcast.
+//   - With WithMaxProtoDepth, a message nested deeper than the limit ends the
+//     stream with codes.InvalidArgument and is not broadcast.
+//   - Messages are broadcasted to all active subscribers of the default topic and,
+//     when the stream carries relay-cluster-name, to the subscribers of that cluster.
+//   - With WithMerger, messages are queued to the merger goroutine instead of
+//     being broadcast by the stream (except with WithSubscriberAck); a full merger
+//     queue blocks the stream.
+//   - With WithForwardToRelay, broadcast messages are also forwarded to the parent relay.
+//   - With WithSubscriberAck, the next message is only processed once a subscriber
+//     of the default topic received the current one, or the ack timeout elapsed
+//     (see Broadcaster.BroadcastAcked); messages batched with WithBatching are not
+//     waited on.
 //   - On EOF, an acknowledgment is returned to the agent.
+//   - With WithSendOrdering, a message whose non-zero sequence_number is not the
+//     previous one of the stream plus one ends the stream with codes.OutOfRange.
+//   - A message received after its expires_at is logged, counted in
+//     relay_messages_expired_total and discarded; the stream stays open.
+//   - With WithBatching, accepted messages are broadcast in batches of up to the
+//     configured size, or once the flush interval has elapsed; pending messages
+//     are flushed before the acknowledgment and whenever the stream ends.
+//   - With WithQuota, a message beyond the agent's quota ends the stream with
+//     codes.ResourceExhausted.
+//   - With WithMinSendInterval, a message received sooner than the minimum
+//     interval after the previous one ends the stream with codes.ResourceExhausted
+//     and is not broadcast.
+//   - A stream opened while the broadcaster is paused (PauseAll) is rejected with
+//     codes.Unavailable and a retry-after header suggesting a retry delay in
+//     seconds; streams already open keep sending, and their messages are held.
+//   - With WithSendMetricsIdleTimeout, a stream that receives no message within the
+//     timeout is closed with codes.DeadlineExceeded.
 //
 // Parameters:
 //   - stream: gRPC server stream used by agents to send Metrics messages.
 //
 // Returns:
-//   - error: if reading from the stream fails or acknowledgment cannot be sent.
+//   - error: if reading from the stream fails, a message is invalid, or acknowledgment cannot be sent.
 func (s *MetricsServer) SendMetrics(stream gen.MetricsService_SendMetricsServer) error {
-	s.logger.Info("started receiving metrics from agent")
+	return observeStream(stream.Context(), "SendMetrics", func() error {
+		return s.receiveMetrics(stream, nil, func(uint64) error {
+			return stream.SendAndClose(&emptypb.Empty{})
+		})
+	})
+}
+
+// SendMetricsV2 is the bidirectional variant of SendMetrics, acknowledging
+// received messages while the stream is open.
+//
+// Behavior:
+//   - Same as SendMetrics for the received messages.
+//   - Each MetricsAck carries the number of messages of the stream processed so
+//     far (relayed, or discarded as expired).
+//   - With WithSendAcks, an ack is sent every configured number of messages
+//     and/or every configured interval while unacknowledged messages exist;
+//     pending batched messages are broadcast before each ack.
+//   - On EOF, a final ack is sent and the stream ends.
+//
+// Parameters:
+//   - stream: bidirectional gRPC stream with the agent.
+//
+// Returns:
+//   - error: same as SendMetrics, or the error of a failed ack send.
+func (s *MetricsServer) SendMetricsV2(stream gen.MetricsService_SendMetricsV2Server) error {
+	ack := func(processed uint64) error {
+		return stream.Send(&gen.MetricsAck{AcknowledgedCount: processed})
+	}
+	return observeStream(stream.Context(), "SendMetricsV2", func() error {
+		return s.receiveMetrics(stream, ack, ack)
+	})
+}
+
+// agentStream is the server side of a stream receiving Metrics from an agent.
+type agentStream interface {
+	Recv() (*gen.Metrics, error)
+	Context() context.Context
+}
+
+// receiveMetrics implements SendMetrics and SendMetricsV2.
+//
+// Parameters:
+//   - stream: the agent stream.
+//   - ack: sends an intermediate acknowledgment with the number of processed messages (nil = none).
+//   - finish: completes the stream on EOF, given the number of processed messages.
+//
+// Returns:
+//   - error: see SendMetrics and SendMetricsV2.
+func (s *MetricsServer) receiveMetrics(stream agentStream, ack, finish func(processed uint64) error) error {
+	streamOpenedAt := time.Now()
+	agentID := agentIDFromContext(stream.Context())
+	logger := s.logger.With(zap.String("agent_id", agentID), zap.String("peer_addr", peerAddr(stream.Context())))
+	release, err := s.claimPeerIP(stream.Context())
+	if err != nil {
+		logger.Warn("rejected agent stream", zap.Error(err))
+		return err
+	}
+	defer release()
+
+	if err := s.checkAgentVersion(stream.Context(), logger); err != nil {
+		return err
+	}
+	if err := s.checkPaused(stream.Context(), logger); err != nil {
+		return err
+	}
+	cluster, err := s.clusterBroadcaster(stream.Context())
+	if err != nil {
+		logger.Warn("rejected agent stream", zap.Error(err))
+		return err
+	}
+
+	if !s.cfg.allowAgentIDReuse {
+		if _, loaded := s.sendAgentIDs.LoadOrStore(agentID, struct{}{}); loaded {
+			logger.Warn("rejected duplicate agent stream")
+			return status.Errorf(codes.AlreadyExists, "agent %s already has an active stream", agentID)
+		}
+		defer s.sendAgentIDs.Delete(agentID)
+	}
+
+	logger.Info("started receiving metrics from agent")
+
+	conn, untrack := s.trackAgent(stream.Context(), agentID)
+	defer untrack()
+
+	// Recv blocks, so it runs in its own goroutine to allow selecting on the idle timer.
+	// The goroutine exits once the handler returns and the stream context is canceled.
+	received := make(chan recvResult)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			select {
+			case received <- recvResult{req: req, err: err}:
+			case <-stream.Context().Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// A nil channel never fires, which disables the idle timeout
+	var idle <-chan time.Time
+	var idleTimer *time.Timer
+	if s.cfg.sendIdleTimeout > 0 {
+		idleTimer = time.NewTimer(s.cfg.sendIdleTimeout)
+		defer idleTimer.Stop()
+		idle = idleTimer.C
+	}
+
+	var rate *ewmaRate
+	var lastRateAlert time.Time
+	var lastReceivedAt time.Time
+	var lastSeq uint64 // Last accepted sequence number of the stream (WithSendOrdering)
+	firstMessage := true
+	if s.cfg.rateThreshold > 0 && s.cfg.rateWindow > 0 {
+		rate = newEWMARate(s.cfg.rateWindow)
+	}
+
+	// Pending messages are flushed on every return, so that accepted messages are
+	// relayed even if the stream then fails
+	var batch *batcher
+	if s.cfg.batchSize > 1 {
+		batch = newBatcher(s.cfg.batchSize, s.cfg.batchFlushInterval, func(msgs []*gen.Metrics) {
+			s.broadcastBatch(cluster, msgs)
+		})
+		defer batch.stop()
+	}
+
+	// Acknowledgments cover every processed message; pending batched messages
+	// are broadcast first
+	var processed, acked uint64
+	sendAck := func() error {
+		if batch != nil {
+			batch.flush()
+		}
+		if err := ack(processed); err != nil {
+			logger.Error("failed to send acknowledgment to agent", zap.Error(err))
+			return err
+		}
+		acked = processed
+		return nil
+	}
+	var summaryTick <-chan time.Time
+	var intervalStats *agentIntervalStats
+	if s.cfg.agentLogInterval > 0 {
+		ticker := time.NewTicker(s.cfg.agentLogInterval)
+		defer ticker.Stop()
+		summaryTick = ticker.C
+		intervalStats = newAgentIntervalStats()
+	}
+
+	var ackTick <-chan time.Time
+	if ack != nil && s.cfg.ackInterval > 0 {
+		ticker := time.NewTicker(s.cfg.ackInterval)
+		defer ticker.Stop()
+		ackTick = ticker.C
+	}
 
 	for {
-		req, err := stream.Recv()
-		if err == io.EOF {
-			s.logger.Info("agent stream closed, sending acknowledgment")
-			return stream.SendAndClose(&emptypb.Empty{})
+		var flush <-chan time.Time
+		if batch != nil {
+			flush = batch.C()
 		}
-		if err != nil {
-			s.logger.Error("failed to receive metrics from agent", zap.Error(err))
+
+		select {
+		case r := <-received:
+			if r.err == io.EOF {
+				if batch != nil {
+					batch.flush()
+				}
+				logger.Info("agent stream closed, sending acknowledgment", zap.Uint64("processed", processed))
+				return finish(processed)
+			}
+			if r.err != nil {
+				logger.Error("failed to receive metrics from agent", zap.Error(r.err))
+				return r.err
+			}
+
+			conn.messages.Add(1)
+			if intervalStats != nil {
+				intervalStats.record(r.req)
+			}
+
+			if firstMessage {
+				firstMessage = false
+				ttfm := time.Since(streamOpenedAt)
+				metrics.AgentTimeToFirstMessage.Observe(ttfm.Seconds())
+				logger.Info("received first message from agent", zap.Duration("time_to_first_message", ttfm))
+			}
+
+			if idleTimer != nil {
+				// Since Go 1.23, Reset discards any pending expiry; no drain is needed
+				idleTimer.Reset(s.cfg.sendIdleTimeout)
+			}
+
+			if s.cfg.minSendInterval > 0 {
+				now := time.Now()
+				if !lastReceivedAt.IsZero() && now.Sub(lastReceivedAt) < s.cfg.minSendInterval {
+					logger.Warn("rejected agent stream: message rate too high",
+						zap.Duration("interval", now.Sub(lastReceivedAt)),
+						zap.Duration("min_send_interval", s.cfg.minSendInterval),
+					)
+					return status.Error(codes.ResourceExhausted, "message rate too high")
+				}
+				lastReceivedAt = now
+			}
+
+			if rate != nil {
+				now := time.Now()
+				if r := rate.observe(now); r > s.cfg.rateThreshold && now.Sub(lastRateAlert) >= rateAlertInterval {
+					lastRateAlert = now
+					logger.Warn("agent send rate above threshold",
+						zap.Float64("messages_per_second", r),
+						zap.Float64("threshold", s.cfg.rateThreshold),
+					)
+				}
+			}
+
+			if err := s.checkSequence(logger, r.req, &lastSeq); err != nil {
+				return err
+			}
+			if !expired(logger, r.req) {
+				if err := s.consumeQuota(stream.Context(), logger, r.req); err != nil {
+					return err
+				}
+				if batch == nil {
+					if err := s.handleMetrics(stream.Context(), logger, cluster, r.req); err != nil {
+						return err
+					}
+				} else {
+					if err := s.acceptMetrics(logger, r.req); err != nil {
+						return err
+					}
+					batch.add(r.req)
+				}
+			}
+
+			processed++
+			if ack != nil && s.cfg.ackEvery > 0 && processed-acked >= uint64(s.cfg.ackEvery) {
+				if err := sendAck(); err != nil {
+					return err
+				}
+			}
+		case <-ackTick:
+			if processed > acked {
+				if err := sendAck(); err != nil {
+					return err
+				}
+			}
+		case <-summaryTick:
+			intervalStats.logAndReset(logger)
+		case <-flush:
+			batch.flush()
+		case <-idle:
+			logger.Warn("closing idle agent stream", zap.Duration("idle_timeout", s.cfg.sendIdleTimeout))
+			return status.Error(codes.DeadlineExceeded, "agent stream idle timeout")
+		case <-stream.Context().Done():
+			// The Recv goroutine may have exited without reporting its error
+			logger.Info("agent stream context canceled")
+			return nil
+		}
+	}
+}
+
+// recvResult is the outcome of a single stream Recv call.
+type recvResult struct {
+	req *gen.Metrics
+	err error
+}
+
+// AgentControl handles a bidirectional agent stream: the agent sends Metrics
+// messages and the relay sends ControlMessage commands on the same stream.
+//
+// Behavior:
+//   - The agent ID is taken from the relay-agent-id metadata, or generated if absent,
+//     and returned to the agent in the relay-agent-id response header.
+//   - A second stream with an agent ID that already has an open control stream
+//     is rejected with codes.AlreadyExists, as is a stream from an already
+//     connected IP when WithOneStreamPerIP is set.
+//   - The relay-agent-version metadata is checked, and the stream rejected while
+//     the broadcaster is paused, as in SendMetrics.
+//   - Received metrics are checked for ordering (WithSendOrdering), discarded
+//     if expired, then validated, charged to the agent's quota and broadcast
+//     exactly as in SendMetrics.
+//   - Commands queued through SendAgentControl are forwarded to the agent.
+//   - The stream is counted in ActiveAgentCount and listed in Agents while it is open.
+//
+// Parameters:
+//   - stream: bidirectional gRPC stream with the agent.
+//
+// Returns:
+//   - error: if receiving or sending fails.
+func (s *MetricsServer) AgentControl(stream gen.MetricsService_AgentControlServer) error {
+	ctx := stream.Context()
+	agentID := agentIDFromContext(ctx)
+	logger := s.logger.With(zap.String("agent_id", agentID), zap.String("peer_addr", peerAddr(ctx)))
+
+	release, err := s.claimPeerIP(ctx)
+	if err != nil {
+		logger.Warn("rejected agent control stream", zap.Error(err))
+		return err
+	}
+	defer release()
+
+	if err := s.checkAgentVersion(ctx, logger); err != nil {
+		return err
+	}
+	if err := s.checkPaused(ctx, logger); err != nil {
+		return err
+	}
+	cluster, err := s.clusterBroadcaster(ctx)
+	if err != nil {
+		logger.Warn("rejected agent control stream", zap.Error(err))
+		return err
+	}
+
+	controlCh := make(chan *gen.ControlMessage, controlQueueSize)
+	if _, loaded := s.controlChs.LoadOrStore(agentID, controlCh); loaded {
+		logger.Warn("rejected duplicate agent control stream")
+		return status.Errorf(codes.AlreadyExists, "agent %s already has an active control stream", agentID)
+	}
+	defer s.controlChs.Delete(agentID)
+	conn, untrack := s.trackAgent(ctx, agentID)
+	defer untrack()
+
+	if err := stream.SendHeader(metadata.Pairs(agentIDKey, agentID)); err != nil {
+		logger.Error("failed to send agent id header", zap.Error(err))
+		return err
+	}
+	logger.Info("agent control stream opened")
+
+	recvErr := make(chan error, 1)
+	go func() {
+		var lastSeq uint64 // Last accepted sequence number of the stream (WithSendOrdering)
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			conn.messages.Add(1)
+			if err := s.checkSequence(logger, req, &lastSeq); err != nil {
+				recvErr <- err
+				return
+			}
+			if expired(logger, req) {
+				continue
+			}
+			if err := s.consumeQuota(ctx, logger, req); err != nil {
+				recvErr <- err
+				return
+			}
+			if err := s.handleMetrics(ctx, logger, cluster, req); err != nil {
+				recvErr <- err
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case msg := <-controlCh:
+			if err := stream.Send(msg); err != nil {
+				logger.Error("failed to send control message to agent", zap.Error(err))
+				return err
+			}
+			logger.Info("sent control message to agent", zap.Stringer("command", msg.GetCommand()))
+		case err := <-recvErr:
+			if err == io.EOF {
+				logger.Info("agent control stream closed")
+				return nil
+			}
+			logger.Error("agent control stream failed", zap.Error(err))
 			return err
+		case <-ctx.Done():
+			logger.Info("agent control stream context canceled")
+			return nil
 		}
+	}
+}
 
-		s.logger.Info("received metrics batch",
-			zap.String("host", req.GetNodeMetrics().GetHostname()),
-			zap.Int("pods_count", len(req.GetPodMetrics())),
-		)
+// DisconnectSubscriber ends the stream of the subscriber with the given ID,
+// which returns codes.Canceled to the client. It does not wait for the stream
+// to end.
+//
+// Parameters:
+//   - id: ID of the subscriber, as sent in its relay-subscriber-id header.
+//
+// Returns:
+//   - error: ErrSubscriberNotFound if no subscriber stream has the ID.
+func (s *MetricsServer) DisconnectSubscriber(id string) error {
+	v, ok := s.subscriberCancels.Load(id)
+	if !ok {
+		return ErrSubscriberNotFound
+	}
+	v.(context.CancelFunc)()
+	return nil
+}
+
+// SendAgentControl enqueues a control message for the agent connected through
+// AgentControl with the given ID. It never blocks.
+//
+// Parameters:
+//   - agentID: ID of the target agent.
+//   - msg: the control message to send.
+//
+// Returns:
+//   - error: ErrAgentNotFound if the agent has no control stream, or
+//     ErrControlQueueFull if its queue is full.
+func (s *MetricsServer) SendAgentControl(agentID string, msg *gen.ControlMessage) error {
+	v, ok := s.controlChs.Load(agentID)
+	if !ok {
+		return ErrAgentNotFound
+	}
 
-		s.broadcaster.Broadcast(req)
+	select {
+	case v.(chan *gen.ControlMessage) <- msg:
+		return nil
+	default:
+		return ErrControlQueueFull
+	}
+}
+
+// handleMetrics validates and broadcasts a single Metrics message received
+// from an agent stream. With WithSubscriberAck, it returns once a subscriber of
+// the default topic received the message or the ack timeout has elapsed.
+//
+// Parameters:
+//   - ctx: the stream context, bounding the subscriber ack wait.
+//   - logger: the stream's child logger.
+//   - cluster: Broadcaster of the stream's cluster topic, also receiving the message (nil = none).
+//   - req: the received message.
+//
+// Returns:
+//   - error: a gRPC status error if the message is invalid; the message is not broadcast.
+func (s *MetricsServer) handleMetrics(ctx context.Context, logger *zap.Logger, cluster *Broadcaster, req *gen.Metrics) error {
+	if err := s.acceptMetrics(logger, req); err != nil {
+		return err
+	}
+
+	switch {
+	case s.cfg.subscriberAckTimeout > 0:
+		ackCtx, cancel := context.WithTimeout(ctx, s.cfg.subscriberAckTimeout)
+		if !s.broadcaster.BroadcastAcked(ackCtx, req) {
+			logger.Warn("no subscriber received metrics within the ack timeout",
+				zap.String("host", req.GetNodeMetrics().GetHostname()),
+				zap.Duration("ack_timeout", s.cfg.subscriberAckTimeout),
+			)
+		}
+		cancel()
+		if cluster != nil {
+			cluster.Broadcast(req)
+		}
+	case s.merger != nil:
+		if err := s.merger.enqueue(ctx, cluster, req); err != nil {
+			return status.FromContextError(err).Err()
+		}
+	default:
+		sent, dropped := s.broadcaster.Broadcast(req)
+		logger.Debug("broadcast metrics", zap.Int("sent", sent), zap.Int("dropped", dropped))
+		if cluster != nil {
+			cluster.Broadcast(req)
+		}
+	}
+	if s.forwarder != nil {
+		s.forwarder.enqueue(req)
+	}
+	s.summary.recordMessage(req)
+	return nil
+}
+
+// checkPaused rejects an agent stream while the broadcaster is paused, asking
+// the agent to retry later through the Retry-After header, in whole seconds
+// rounded up (see WithPausedRetryAfter).
+//
+// Parameters:
+//   - ctx: stream context on which the header is set.
+//   - logger: the stream's child logger.
+//
+// Returns:
+//   - error: codes.Unavailable if the broadcaster is paused.
+func (s *MetricsServer) checkPaused(ctx context.Context, logger *zap.Logger) error {
+	if !s.broadcaster.IsGloballyPaused() {
+		return nil
+	}
+	retryAfter := s.cfg.pausedRetryAfter
+	if retryAfter <= 0 {
+		retryAfter = defaultPausedRetryAfter
+	}
+	logger.Warn("rejected agent stream: broadcaster paused", zap.Duration("retry_after", retryAfter))
+	// Best effort: the status is returned even if the header cannot be set
+	_ = grpc.SetHeader(ctx, metadata.Pairs(retryAfterKey, strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))))
+	return status.Error(codes.Unavailable, "relay is paused, retry later")
+}
+
+// checkSequence enforces the ordering of the messages of a stream when
+// WithSendOrdering is set: a message with a sequence number must follow the
+// last accepted one. Messages without a sequence number always pass.
+//
+// Parameters:
+//   - logger: the stream's child logger.
+//   - req: the received message.
+//   - lastSeq: last accepted sequence number of the stream, updated on success.
+//
+// Returns:
+//   - error: codes.OutOfRange if the message is out of order.
+func (s *MetricsServer) checkSequence(logger *zap.Logger, req *gen.Metrics, lastSeq *uint64) error {
+	seq := req.GetSequenceNumber()
+	if !s.cfg.enforceSendOrdering || seq == 0 {
+		return nil
+	}
+	if seq != *lastSeq+1 {
+		logger.Warn("rejected out-of-order metrics", zap.Uint64("expected_sequence", *lastSeq+1), zap.Uint64("sequence", seq))
+		return status.Errorf(codes.OutOfRange, "expected sequence %d, got %d", *lastSeq+1, seq)
+	}
+	*lastSeq = seq
+	return nil
+}
+
+// expired reports whether a message was received after its expires_at, in
+// which case it is logged and counted, and must be discarded.
+//
+// Parameters:
+//   - logger: the stream's child logger.
+//   - req: the received message.
+//
+// Returns:
+//   - bool: true if the message expired.
+func expired(logger *zap.Logger, req *gen.Metrics) bool {
+	if req.GetExpiresAt() == nil {
+		return false
+	}
+	expiresAt := req.GetExpiresAt().AsTime()
+	if !time.Now().After(expiresAt) {
+		return false
+	}
+
+	logger.Warn("discarding expired metrics",
+		zap.String("host", req.GetNodeMetrics().GetHostname()),
+		zap.Time("expires_at", expiresAt),
+	)
+	metrics.MessagesExpired.Inc()
+	return true
+}
+
+// acceptMetrics assigns a request ID to a Metrics message received from an
+// agent stream, then logs and validates it, without broadcasting it. The
+// request ID is logged as request_id by every later stage handling the message:
+// the broadcast, each subscriber send and each subscriber stream.
+//
+// Parameters:
+//   - logger: the stream's child logger.
+//   - req: the received message.
+//
+// Returns:
+//   - error: a gRPC status error if the message is invalid.
+func (s *MetricsServer) acceptMetrics(logger *zap.Logger, req *gen.Metrics) error {
+	logger = logger.With(zap.String("request_id", assignRequestID(req)))
+	logger.Info("received metrics batch",
+		zap.String("host", req.GetNodeMetrics().GetHostname()),
+		zap.Int("pods_count", len(req.GetPodMetrics())),
+	)
+
+	// Checked first: validation iterates over the pods
+	if n := len(req.GetPodMetrics()); s.cfg.maxPodsPerMessage > 0 && n > s.cfg.maxPodsPerMessage {
+		logger.Warn("rejected metrics batch with too many pods", zap.Int("pods_count", n), zap.Int("max_pods", s.cfg.maxPodsPerMessage))
+		return status.Errorf(codes.InvalidArgument, "message has %d pod metrics, exceeding the maximum of %d", n, s.cfg.maxPodsPerMessage)
+	}
+	if err := validatePodMetrics(req); err != nil {
+		logger.Warn("rejected invalid metrics batch", zap.Error(err))
+		return err
+	}
+	if size := proto.Size(req); s.cfg.maxMessageSize > 0 && size > s.cfg.maxMessageSize {
+		logger.Warn("rejected oversized metrics batch", zap.Int("size_bytes", size), zap.Int("max_size_bytes", s.cfg.maxMessageSize))
+		return status.Errorf(codes.InvalidArgument, "message size %d bytes exceeds the maximum of %d bytes", size, s.cfg.maxMessageSize)
+	}
+	if d := proto2.Depth(req); s.cfg.maxProtoDepth > 0 && d > s.cfg.maxProtoDepth {
+		logger.Warn("rejected metrics batch nested too deeply", zap.Int("depth", d), zap.Int("max_depth", s.cfg.maxProtoDepth))
+		return status.Errorf(codes.InvalidArgument, "message depth %d exceeds the maximum of %d", d, s.cfg.maxProtoDepth)
+	}
+	return nil
+}
+
+// broadcastBatch broadcasts messages accepted by acceptMetrics in one
+// Broadcaster.BroadcastBatch call.
+//
+// Parameters:
+//   - cluster: Broadcaster of the stream's cluster topic, also receiving the batch (nil = none).
+//   - batch: the accepted messages, in order.
+func (s *MetricsServer) broadcastBatch(cluster *Broadcaster, batch []*gen.Metrics) {
+	s.broadcaster.BroadcastBatch(batch)
+	if cluster != nil {
+		cluster.BroadcastBatch(batch)
+	}
+	for _, req := range batch {
+		if s.forwarder != nil {
+			s.forwarder.enqueue(req)
+		}
+		s.summary.recordMessage(req)
+	}
+}
+
+// consumeQuota charges a received message to the agent's quota when WithQuota
+// is set. The agent is identified by its relay-agent-id metadata or, if absent,
+// by the message hostname, so that the quota survives reconnections.
+//
+// Parameters:
+//   - ctx: stream context carrying the incoming metadata.
+//   - logger: the stream's child logger.
+//   - req: the received message.
+//
+// Returns:
+//   - error: codes.ResourceExhausted if the agent's quota is exhausted.
+func (s *MetricsServer) consumeQuota(ctx context.Context, logger *zap.Logger, req *gen.Metrics) error {
+	if s.cfg.quota == nil {
+		return nil
+	}
+
+	agent := req.GetNodeMetrics().GetHostname()
+	if values := metadata.ValueFromIncomingContext(ctx, agentIDKey); len(values) > 0 && values[0] != "" {
+		agent = values[0]
+	}
+	if allowed, _ := s.cfg.quota.Check(agent); !allowed {
+		logger.Warn("agent message quota exhausted", zap.String("quota_agent", agent))
+		return status.Errorf(codes.ResourceExhausted, "message quota exhausted for agent %s", agent)
+	}
+	return nil
+}
+
+// validatePodMetrics checks that every pod appears at most once in the message.
+// Pods are identified by namespace and name.
+//
+// Parameters:
+//   - req: the message to validate.
+//
+// Returns:
+//   - error: codes.InvalidArgument naming the first duplicated pod.
+func validatePodMetrics(req *gen.Metrics) error {
+	seen := make(map[string]struct{}, len(req.GetPodMetrics()))
+	for _, pod := range req.GetPodMetrics() {
+		name := pod.GetNamespace() + "/" + pod.GetName()
+		if _, ok := seen[name]; ok {
+			return status.Errorf(codes.InvalidArgument, "duplicate pod name: %s", name)
+		}
+		seen[name] = struct{}{}
+	}
+	return nil
+}
+
+// claimPeerIP marks the stream's peer IP as having an open agent stream when
+// WithOneStreamPerIP is set. Streams without peer information are not limited.
+//
+// Parameters:
+//   - ctx: stream context carrying the peer information.
+//
+// Returns:
+//   - func(): releases the IP; meant to be deferred. Never nil.
+//   - error: codes.AlreadyExists if the IP already has an open agent stream.
+func (s *MetricsServer) claimPeerIP(ctx context.Context) (func(), error) {
+	if !s.cfg.oneStreamPerIP {
+		return func() {}, nil
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return func() {}, nil
+	}
+	ip := p.Addr.String()
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	if _, loaded := s.activeIPs.LoadOrStore(ip, struct{}{}); loaded {
+		return nil, status.Errorf(codes.AlreadyExists, "agent IP %s already has an active stream", ip)
+	}
+	return func() { s.activeIPs.Delete(ip) }, nil
+}
+
+// observeStream runs a stream handler and records its duration in
+// relay_stream_duration_seconds, labeled with the RPC method and the exit reason:
+//   - eof: the handler returned nil while the stream was still open.
+//   - context_canceled: the stream context was done (client cancellation or
+//     deadline), or the handler returned codes.Canceled.
+//   - limit_exceeded: the handler returned codes.ResourceExhausted (quota,
+//     subscriber cap) or codes.DeadlineExceeded (idle timeout).
+//   - error: any other error.
+//
+// Parameters:
+//   - ctx: the stream context.
+//   - method: the RPC method name.
+//   - run: the stream handler.
+//
+// Returns:
+//   - error: the error returned by run.
+func observeStream(ctx context.Context, method string, run func() error) error {
+	start := time.Now()
+	err := run()
+
+	reason := "error"
+	switch {
+	case ctx.Err() != nil || status.Code(err) == codes.Canceled:
+		reason = "context_canceled"
+	case err == nil:
+		reason = "eof"
+	case status.Code(err) == codes.ResourceExhausted || status.Code(err) == codes.DeadlineExceeded:
+		reason = "limit_exceeded"
+	}
+	metrics.StreamDuration.WithLabelValues(method, reason).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// trackAgent counts an agent stream as active and lists it in Agents until the
+// returned function is called. Transitions between no agent streams and some
+// agent streams are logged, like the subscriber transitions of the Broadcaster.
+//
+// Parameters:
+//   - ctx: stream context carrying the peer information.
+//   - agentID: the agent ID of the stream.
+//
+// Returns:
+//   - *agentConn: the live state of the stream, for message accounting.
+//   - func(): releases the stream; meant to be deferred.
+func (s *MetricsServer) trackAgent(ctx context.Context, agentID string) (*agentConn, func()) {
+	conn := &agentConn{id: agentID, peerAddr: peerAddr(ctx), connectedAt: time.Now()}
+	s.agentConns.Store(agentID, conn)
+	if s.activeAgents.Add(1) == 1 {
+		s.logger.Info("first agent stream opened", zap.String("agent_id", agentID), zap.String("peer_addr", conn.peerAddr))
+	}
+	s.summary.agentsSeen.Add(1)
+	metrics.AgentConnectionsActive.Inc()
+	return conn, func() {
+		// A newer stream with the same agent ID may have replaced this one
+		s.agentConns.CompareAndDelete(agentID, conn)
+		if s.activeAgents.Add(-1) == 0 {
+			s.logger.Info("last agent stream closed", zap.String("agent_id", agentID), zap.String("peer_addr", conn.peerAddr))
+		}
+		metrics.AgentConnectionsActive.Dec()
 	}
 }
 
 // SubscribeMetrics allows a client to subscribe to the live metrics stream.
 //
 // Behavior:
-//   - Assigns a unique ID to the subscriber.
-//   - Registers the subscriber with a buffered channel.
-//   - Streams metrics to the client until the context is canceled or an error occurs.
-//   - Ensures cleanup on disconnect.
+//   - Assigns a unique ID to the subscriber, or restores the ID carried by a valid
+//     relay-reconnect-token when reconnection tokens are enabled. Tokens are bound
+//     to the topic (relay-cluster-name) they were issued on; a restored ID still
+//     registered on the topic is rejected with codes.AlreadyExists.
+//   - Registers the subscriber with a buffered channel (codes.ResourceExhausted if the
+//     Broadcaster subscriber cap is reached) or, when relay-consumer-group
+//     is set, joins that consumer group: each message is then delivered to exactly
+//     one member of the group (see GroupBroadcaster).
+//   - All log lines carry the subscriber peer address (peer_addr, "unknown" if
+//     unavailable).
+//   - All log lines after ID assignment carry the subscriber ID (subscriber_id) and
+//     the display name from relay-subscriber-name (subscriber_name), with characters
+//     outside [a-zA-Z0-9_-] replaced by '_'.
+//   - With relay-cluster-name, the subscriber only receives messages from agent
+//     streams tagged with the same cluster name; without it (or with "_all"), it
+//     receives every message.
+//   - With relay-accept-encoding (none, gzip or zstd), messages are compressed with
+//     the requested compressor; an unavailable one falls back to none with a warning.
+//   - Once registered, sends the subscriber ID in the relay-subscriber-id response
+//     header, before any message, along with a fresh relay-reconnect-token when
+//     reconnection tokens are enabled.
+//   - The relay-subscriber-count response header carries the number of
+//     subscribers registered on the subscriber's topic, including itself; a
+//     consumer group counts once.
+//   - With WithPersistentSubscribers, a subscriber presenting relay-subscriber-persist-id
+//     is replayed only the buffered messages after the last one delivered under that ID,
+//     and never receives a message twice (at-most-once). A second concurrent stream with
+//     the same persistent ID is rejected with codes.AlreadyExists.
+//   - With WithRingBuffer, delivers through a ring buffer polled every
+//     ringPollInterval: a subscriber that falls behind loses the oldest queued
+//     messages instead of the newest.
+//   - Streams metrics to the client until the context is canceled, the relay closes
+//     the subscriber channel (see DrainAndClose), or an error occurs.
+//   - A subscriber disconnected with DisconnectSubscriber ends with codes.Canceled.
+//   - When the stream ends, its duration is observed in relay_stream_duration_seconds
+//     as for SendMetrics.
+//   - Ensures cleanup on disconnect, logged at INFO level with the connection
+//     duration (duration_seconds).
 //
 // Parameters:
 //   - _ (*emptypb.Empty): unused input placeholder.
 //   - stream: gRPC stream used to send metrics messages to the subscriber.
 //
 // Returns:
-//   - error: if sending fails or the stream context is canceled.
+//   - error: if sending fails, the reconnection token is rejected, or the stream context is canceled.
 func (s *MetricsServer) SubscribeMetrics(_ *emptypb.Empty, stream gen.MetricsService_SubscribeMetricsServer) error {
-	id := uuid.New().String()
-	ch := make(chan *gen.Metrics, 100)
+	return observeStream(stream.Context(), "SubscribeMetrics", func() error {
+		return s.subscribe(stream, nil)
+	})
+}
+
+// SubscribeMetricsV2 is the bidirectional variant of SubscribeMetrics.
+//
+// Behavior:
+//   - Same as SubscribeMetrics, with an initially empty filter (all hosts).
+//   - Each FilterUpdate received from the client replaces the hostname filter;
+//     only messages whose NodeMetrics.hostname matches the glob are forwarded.
+//   - Updates are applied in the delivery loop, so a message is always matched
+//     against a single, complete filter.
+//   - An invalid glob ends the stream with codes.InvalidArgument.
+//   - The client closing its send side keeps the subscription open with the last filter.
+//
+// Parameters:
+//   - stream: bidirectional gRPC stream with the subscriber.
+//
+// Returns:
+//   - error: same as SubscribeMetrics, or codes.InvalidArgument for an invalid glob.
+func (s *MetricsServer) SubscribeMetricsV2(stream gen.MetricsService_SubscribeMetricsV2Server) error {
+	updates := make(chan filterUpdateResult)
+	go func() {
+		for {
+			update, err := stream.Recv()
+			select {
+			case updates <- filterUpdateResult{update: update, err: err}:
+			case <-stream.Context().Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return observeStream(stream.Context(), "SubscribeMetricsV2", func() error {
+		return s.subscribe(stream, updates)
+	})
+}
+
+// SubscribeMetricsBatch is the variant of SubscribeMetrics delivering several
+// messages per MetricsBatch.
+//
+// Behavior:
+//   - Same as SubscribeMetrics, but messages are buffered and sent in batches.
+//   - relay-batch-size sets the number of messages per batch (default 1, at most
+//     maxSubscriberBatchSize); a full batch is sent immediately.
+//   - relay-batch-flush-ms sets how long a partial batch waits for more messages
+//     (default defaultSubscriberBatchFlush; 0 = only send full batches).
+//   - A pending partial batch is sent before the stream ends because the relay
+//     closed the subscriber channel.
+//   - Invalid batch metadata ends the stream with codes.InvalidArgument.
+//
+// Parameters:
+//   - _ (*emptypb.Empty): unused input placeholder.
+//   - stream: gRPC stream used to send metrics batches to the subscriber.
+//
+// Returns:
+//   - error: same as SubscribeMetrics, or codes.InvalidArgument for invalid batch metadata.
+func (s *MetricsServer) SubscribeMetricsBatch(_ *emptypb.Empty, stream gen.MetricsService_SubscribeMetricsBatchServer) error {
+	return observeStream(stream.Context(), "SubscribeMetricsBatch", func() error {
+		size, interval, err := subscriberBatchConfig(stream.Context())
+		if err != nil {
+			s.logger.Warn("rejected batch subscriber", zap.String("peer_addr", peerAddr(stream.Context())), zap.Error(err))
+			return err
+		}
+
+		batched := newBatchSubscriberStream(stream, size, interval)
+		defer batched.batch.stop()
+		return s.subscribe(batched, nil)
+	})
+}
+
+// SubscribeMetricsFlowControlled is the variant of SubscribeMetrics with
+// subscriber flow control.
+//
+// Behavior:
+//   - Same as SubscribeMetrics for the delivered messages.
+//   - The client sends MetricsAck messages carrying the number of messages it
+//     received so far on the stream.
+//   - With WithSubscriberFlowControl, once the configured number of messages is
+//     unacknowledged, the relay waits for an acknowledgment before sending the
+//     next one instead of sending it; the stream ends with codes.DeadlineExceeded
+//     if none arrives within the block timeout, or with codes.FailedPrecondition
+//     if the client closed its side.
+//
+// Parameters:
+//   - stream: bidirectional gRPC stream with the subscriber.
+//
+// Returns:
+//   - error: same as SubscribeMetrics, or the flow control errors above.
+func (s *MetricsServer) SubscribeMetricsFlowControlled(stream gen.MetricsService_SubscribeMetricsFlowControlledServer) error {
+	return observeStream(stream.Context(), "SubscribeMetricsFlowControlled", func() error {
+		return s.subscribe(newFlowControlledStream(stream, s.cfg.maxUnacked, s.cfg.windowBlockTimeout), nil)
+	})
+}
+
+// subscriberBatchConfig reads the SubscribeMetricsBatch settings from the
+// relay-batch-size and relay-batch-flush-ms metadata.
+//
+// Parameters:
+//   - ctx: stream context carrying the incoming metadata.
+//
+// Returns:
+//   - int: messages per batch.
+//   - time.Duration: partial batch flush interval.
+//   - error: codes.InvalidArgument if a value is not a valid number or out of range.
+func subscriberBatchConfig(ctx context.Context) (int, time.Duration, error) {
+	size := 1
+	interval := defaultSubscriberBatchFlush
+
+	if values := metadata.ValueFromIncomingContext(ctx, subscriberBatchSizeKey); len(values) > 0 {
+		n, err := strconv.Atoi(values[0])
+		if err != nil || n < 1 || n > maxSubscriberBatchSize {
+			return 0, 0, status.Errorf(codes.InvalidArgument, "%s must be between 1 and %d, got %q",
+				subscriberBatchSizeKey, maxSubscriberBatchSize, values[0])
+		}
+		size = n
+	}
+	if values := metadata.ValueFromIncomingContext(ctx, subscriberBatchFlushKey); len(values) > 0 {
+		ms, err := strconv.Atoi(values[0])
+		if err != nil || ms < 0 {
+			return 0, 0, status.Errorf(codes.InvalidArgument, "%s must be a non-negative number of milliseconds, got %q",
+				subscriberBatchFlushKey, values[0])
+		}
+		interval = time.Duration(ms) * time.Millisecond
+	}
+	return size, interval, nil
+}
+
+// subscriberStream is the server side of a stream delivering Metrics to a subscriber.
+type subscriberStream interface {
+	Send(*gen.Metrics) error
+	SendHeader(metadata.MD) error
+	Context() context.Context
+}
+
+// filterUpdateResult is the outcome of a single FilterUpdate Recv call.
+type filterUpdateResult struct {
+	update *gen.FilterUpdate
+	err    error
+}
 
-	s.logger.Info("subscriber connected", zap.String("subscriber_id", id))
-	s.broadcaster.Register(id, ch)
+// subscribe registers a subscriber and delivers broadcast metrics to it until
+// the stream ends. It implements both SubscribeMetrics and SubscribeMetricsV2.
+//
+// Parameters:
+//   - stream: the subscriber stream.
+//   - updates: filter updates received from the client (nil for SubscribeMetrics).
+//
+// Returns:
+//   - error: see SubscribeMetrics and SubscribeMetricsV2.
+func (s *MetricsServer) subscribe(stream subscriberStream, updates <-chan filterUpdateResult) error {
+	connectedAt := time.Now()
+	logger := s.logger.With(zap.String("peer_addr", peerAddr(stream.Context())))
+	cluster := clusterName(stream.Context())
+	t, err := s.topicFor(cluster)
+	if err != nil {
+		logger.Warn("rejected subscriber", zap.String("cluster", cluster), zap.Error(err))
+		return err
+	}
+	topicName := cluster
+	if topicName == "" {
+		topicName = defaultTopic
+	}
+	id, err := s.subscriberID(stream.Context(), logger, topicName)
+	if err != nil {
+		return err
+	}
+	name, sanitized := subscriberName(stream.Context())
+	group := consumerGroupName(stream.Context())
+	logger = logger.With(zap.String("subscriber_id", id), zap.String("subscriber_name", name))
+	if cluster != "" {
+		logger = logger.With(zap.String("cluster", cluster))
+	}
+	if group != "" {
+		logger = logger.With(zap.String("consumer_group", group))
+	}
+	if sanitized {
+		logger.Warn("sanitized subscriber name: invalid characters replaced with '_'")
+	}
+
+	logger.Info("subscriber connected")
+	negotiateCompression(stream.Context(), logger)
+
+	// Persistent subscribers resume after the last message delivered under their
+	// persistent ID; consumer group members share a channel and cannot resume
+	var resume *persistState
+	var afterSeq uint64
+	if persistID := s.persistentID(stream.Context()); persistID != "" && group == "" {
+		resume, afterSeq, err = s.claimPersistState(persistID)
+		if err != nil {
+			logger.Warn("rejected persistent subscriber", zap.Error(err))
+			return err
+		}
+		defer s.releasePersistState(resume)
+		logger = logger.With(zap.String("persist_id", persistID))
+		logger.Info("resuming persistent subscriber", zap.Uint64("after_seq", afterSeq))
+	}
+
+	// Members of a consumer group share the group channel instead of owning one
+	var ch chan *gen.Metrics
+	var ring *ringbuf.RingBuffer[*gen.Metrics]
+	if group != "" {
+		ch, err = t.groups.Join(group, id)
+	} else if size := t.broadcaster.cfg.ringBufferSize; size > 0 {
+		ring = ringbuf.New[*gen.Metrics](size)
+		_, err = t.broadcaster.register(id, &subscriber{ring: ring}, afterSeq, true)
+	} else {
+		ch = make(chan *gen.Metrics, 100)
+		_, err = t.broadcaster.register(id, &subscriber{ch: ch}, afterSeq, true)
+	}
+	if errors.Is(err, ErrSubscriberAlreadyExists) {
+		// Only a restored ID can collide: new IDs are random UUIDs
+		logger.Warn("rejected subscriber: still connected")
+		return status.Errorf(codes.AlreadyExists, "subscriber %s is still connected", id)
+	}
+	if errors.Is(err, ErrSubscriberCapReached) {
+		logger.Warn("rejected subscriber: subscriber cap reached")
+		return status.Error(codes.ResourceExhausted, "subscriber cap reached")
+	}
+	if err != nil {
+		logger.Error("failed to register subscriber", zap.Error(err))
+		return status.Error(codes.Internal, "failed to register subscriber")
+	}
+
+	s.subscriberInfos.Store(id, SubscriberInfo{ID: id, Name: name})
+	disconnectCtx, disconnect := context.WithCancel(stream.Context())
+	s.subscriberCancels.Store(id, disconnect)
 	defer func() {
-		s.logger.Info("subscriber disconnected", zap.String("subscriber_id", id))
-		s.broadcaster.Unregister(id)
+		logger.Info("subscriber disconnected", zap.Float64("duration_seconds", time.Since(connectedAt).Seconds()))
+		if group != "" {
+			t.groups.Leave(group, id)
+		} else {
+			t.broadcaster.unregisterOwned(id, ch, ring)
+		}
+		s.subscriberInfos.Delete(id)
+		s.subscriberCancels.Delete(id)
+		disconnect()
 	}()
 
+	header := metadata.Pairs(
+		subscriberIDKey, id,
+		subscriberCountKey, strconv.Itoa(t.broadcaster.SubscriberCount()),
+	)
+	if s.cfg.tokenSigner != nil {
+		tok, err := s.cfg.tokenSigner.Issue(id, topicName)
+		if err != nil {
+			logger.Error("failed to issue reconnect token", zap.Error(err))
+			return status.Error(codes.Internal, "failed to issue reconnect token")
+		}
+		header.Set(reconnectTokenKey, tok)
+	}
+	if err := stream.SendHeader(header); err != nil {
+		logger.Error("failed to send subscriber response header", zap.Error(err))
+		return err
+	}
+
+	hostnameGlob := ""
+
+	forward := func(msg *gen.Metrics) error {
+		if hostnameGlob != "" {
+			// The glob was validated when it was set, so Match cannot fail here
+			if matched, _ := path.Match(hostnameGlob, msg.GetNodeMetrics().GetHostname()); !matched {
+				return nil
+			}
+		}
+		if resume != nil && !resume.advance(t.broadcaster, msg) {
+			return nil
+		}
+		ctx := contextWithRequestID(stream.Context(), requestIDOf(msg))
+		msgLogger := logger.With(zap.String("request_id", requestIDFromContext(ctx)))
+		if err := stream.Send(msg); err != nil {
+			msgLogger.Error("failed to send metrics to subscriber", zap.Error(err))
+			return err
+		}
+		msgLogger.Debug("sent metrics to subscriber")
+		return nil
+	}
+
+	// SubscribeMetricsBatch streams send partial batches on their flush interval
+	batched, _ := stream.(*batchSubscriberStream)
+
 	for {
+		// A ring buffer cannot be selected on: drain it, then poll again after
+		// ringPollInterval. ch is nil in that case, so its case never fires.
+		var poll <-chan time.Time
+		if ring != nil {
+			if msg, ok := ring.Recv(); ok {
+				if err := forward(msg); err != nil {
+					return err
+				}
+				continue
+			}
+			if ring.Closed() {
+				logger.Info("subscriber ring buffer closed by relay")
+				return s.flushSubscriber(logger, batched)
+			}
+			poll = time.After(ringPollInterval)
+		}
+		var flush <-chan time.Time
+		if batched != nil {
+			flush = batched.batch.C()
+		}
+
 		select {
-		case msg := <-ch:
-			if err := stream.Send(msg); err != nil {
-				s.logger.Error("failed to send metrics to subscriber",
-					zap.String("subscriber_id", id),
-					zap.Error(err),
-				)
+		case msg, ok := <-ch:
+			if !ok {
+				logger.Info("subscriber channel closed by relay")
+				return s.flushSubscriber(logger, batched)
+			}
+			if err := forward(msg); err != nil {
 				return err
 			}
-			s.logger.Debug("sent metrics to subscriber", zap.String("subscriber_id", id))
-		case <-stream.Context().Done():
-			s.logger.Info("subscriber context canceled", zap.String("subscriber_id", id))
+		case <-flush:
+			if err := s.flushSubscriber(logger, batched); err != nil {
+				return err
+			}
+		case <-poll:
+		case r := <-updates:
+			if r.err == io.EOF {
+				// No further updates: keep streaming with the current filter
+				updates = nil
+				continue
+			}
+			if r.err != nil {
+				logger.Error("failed to receive filter update from subscriber", zap.Error(r.err))
+				return r.err
+			}
+			glob := r.update.GetHostnameGlob()
+			if _, err := path.Match(glob, ""); err != nil {
+				logger.Warn("rejected invalid hostname filter", zap.String("hostname_glob", glob), zap.Error(err))
+				return status.Errorf(codes.InvalidArgument, "invalid hostname_glob %q: %v", glob, err)
+			}
+			hostnameGlob = glob
+			logger.Info("subscriber filter updated", zap.String("hostname_glob", glob))
+		case <-disconnectCtx.Done():
+			if stream.Context().Err() == nil {
+				logger.Info("subscriber disconnected by admin")
+				return status.Error(codes.Canceled, "subscriber disconnected by relay admin")
+			}
+			logger.Info("subscriber context canceled")
 			return nil
 		}
 	}
 }
+
+// flushSubscriber sends the pending partial batch of a SubscribeMetricsBatch
+// stream; it does nothing for other streams.
+//
+// Parameters:
+//   - logger: the subscriber's child logger.
+//   - batched: the batching stream, or nil.
+//
+// Returns:
+//   - error: the send error, if any.
+func (s *MetricsServer) flushSubscriber(logger *zap.Logger, batched *batchSubscriberStream) error {
+	if batched == nil {
+		return nil
+	}
+	if err := batched.flush(); err != nil {
+		logger.Error("failed to send metrics batch to subscriber", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// Subscriber returns the information recorded for a connected subscriber.
+//
+// Parameters:
+//   - id: Subscriber identifier.
+//
+// Returns:
+//   - SubscriberInfo: the subscriber information.
+//   - bool: true if the subscriber is connected.
+func (s *MetricsServer) Subscriber(id string) (SubscriberInfo, bool) {
+	v, ok := s.subscriberInfos.Load(id)
+	if !ok {
+		return SubscriberInfo{}, false
+	}
+	return v.(SubscriberInfo), true
+}
+
+// ActiveAgentCount returns the number of currently open agent streams
+// (SendMetrics and AgentControl).
+//
+// Returns:
+//   - int: number of connected agents.
+func (s *MetricsServer) ActiveAgentCount() int {
+	return int(s.activeAgents.Load())
+}
+
+// subscriberID returns the ID to use for a new subscription.
+//
+// Behavior:
+//   - Without reconnection tokens, or without a token in the metadata, a new UUID is generated.
+//   - With a valid token issued for topic, the subscriber ID stored in the token is restored.
+//   - Expired or invalid tokens, and tokens issued for another topic, are
+//     rejected with codes.Unauthenticated.
+//   - A restored ID that is still registered is rejected with codes.AlreadyExists
+//     by the registration of the subscriber, not here.
+//
+// Parameters:
+//   - ctx: stream context carrying the incoming metadata.
+//   - logger: the stream's child logger.
+//   - topic: the topic the subscriber connects to (defaultTopic without a cluster name).
+//
+// Returns:
+//   - string: the subscriber ID.
+//   - error: a gRPC status error if the token is rejected.
+func (s *MetricsServer) subscriberID(ctx context.Context, logger *zap.Logger, topic string) (string, error) {
+	if s.cfg.tokenSigner == nil {
+		return uuid.New().String(), nil
+	}
+
+	values := metadata.ValueFromIncomingContext(ctx, reconnectTokenKey)
+	if len(values) == 0 {
+		return uuid.New().String(), nil
+	}
+
+	claims, err := s.cfg.tokenSigner.Verify(values[0], topic)
+	if errors.Is(err, token.ErrExpired) {
+		logger.Warn("rejected expired reconnect token")
+		return "", status.Error(codes.Unauthenticated, "reconnect token expired")
+	}
+	if errors.Is(err, token.ErrTopicMismatch) {
+		logger.Warn("rejected reconnect token issued for another topic", zap.String("topic", topic))
+		return "", status.Error(codes.Unauthenticated, "reconnect token issued for another topic")
+	}
+	if err != nil {
+		logger.Warn("rejected invalid reconnect token", zap.Error(err))
+		return "", status.Error(codes.Unauthenticated, "invalid reconnect token")
+	}
+
+	logger.Info("restored subscriber from reconnect token", zap.String("subscriber_id", claims.SubscriberID))
+	return claims.SubscriberID, nil
+}
+
+// agentIDFromContext returns the agent ID from the relay-agent-id metadata,
+// or a new UUID if the metadata is absent or empty.
+//
+// Parameters:
+//   - ctx: stream context carrying the incoming metadata.
+//
+// Returns:
+//   - string: the agent ID.
+func agentIDFromContext(ctx context.Context) string {
+	if values := metadata.ValueFromIncomingContext(ctx, agentIDKey); len(values) > 0 && values[0] != "" {
+		return values[0]
+	}
+	return uuid.New().String()
+}
+
+// peerAddr returns the remote address of the stream peer, or "unknown" if the
+// context carries no peer information.
+//
+// Parameters:
+//   - ctx: stream context.
+//
+// Returns:
+//   - string: the peer address.
+func peerAddr(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "unknown"
+	}
+	return p.Addr.String()
+}
+
+// DrainAndClose closes every subscriber channel so that all active
+// SubscribeMetrics streams return. It must be called before stopping the
+// gRPC server gracefully, otherwise GracefulStop waits on subscriber streams
+// that never end on their own.
+func (s *MetricsServer) DrainAndClose() {
+	s.broadcaster.UnregisterAll()
+	s.topics.Range(func(_, v any) bool {
+		v.(*topic).broadcaster.UnregisterAll()
+		return true
+	})
+}
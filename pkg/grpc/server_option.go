@@ -0,0 +1,369 @@
+package grpc
+
+import (
+	"context"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/kubensage/relay/pkg/quota"
+	"github.com/kubensage/relay/pkg/token"
+	"google.golang.org/grpc"
+)
+
+// ServerOption configures optional MetricsServer behavior.
+type ServerOption func(*serverConfig)
+
+// serverConfig holds the tunables set through ServerOption values.
+// The zero value keeps the default relay behavior.
+type serverConfig struct {
+	tokenSigner     *token.Signer // Issues and verifies reconnection tokens (nil = disabled)
+	oneStreamPerIP  bool          // Reject agent streams from an IP that already has one open
+	sendIdleTimeout time.Duration // Close SendMetrics streams idle for this long (0 = disabled)
+	rateThreshold   float64       // Per-agent messages/sec above which a warning is logged (0 = disabled)
+	rateWindow      time.Duration // EWMA window of the per-agent message rate
+
+	allowAgentIDReuse bool // Accept several SendMetrics streams with the same agent ID
+
+	minSendInterval time.Duration // Minimum interval between two messages of a SendMetrics stream (0 = unlimited)
+
+	maxUnacked         int           // Unacknowledged messages per SubscribeMetricsFlowControlled stream (0 = unlimited)
+	windowBlockTimeout time.Duration // Maximum wait for an acknowledgment while the window is full
+
+	agentVersions       *semver.Constraints // Supported relay-agent-version range (nil = unchecked)
+	requireAgentVersion bool                // Reject agent streams whose version is outside agentVersions
+
+	quota quota.QuotaStore // Per-agent message quotas (nil = unlimited)
+
+	batchSize          int           // Messages per SendMetrics broadcast batch (<= 1 = no batching)
+	batchFlushInterval time.Duration // Maximum wait before a partial batch is broadcast (0 = only when full)
+
+	persistTTL time.Duration // Retention of persistent subscriber state after disconnect (0 = disabled)
+
+	enforceSendOrdering bool // Reject out-of-order SendMetrics sequence numbers
+
+	ackInterval time.Duration // SendMetricsV2 acknowledgment interval (0 = no timed acks)
+	ackEvery    int           // SendMetricsV2 messages per acknowledgment (0 = no count-based acks)
+
+	maxMessageSize int // Maximum encoded size of received messages in bytes (0 = unlimited)
+	maxProtoDepth  int // Maximum nesting depth of received messages (0 = unlimited)
+
+	maxPodsPerMessage int // Maximum number of PodMetrics per received message (0 = unlimited)
+
+	maxClusterTopics int // Maximum number of relay-cluster-name topics (0 = unlimited)
+
+	agentLogInterval time.Duration // Interval of the per-stream SendMetrics summary log (0 = disabled)
+
+	pausedRetryAfter time.Duration // Retry delay suggested to agents rejected while paused (0 = 10s)
+
+	subscriberAckTimeout time.Duration // Maximum wait for a subscriber to receive each agent message (0 = no wait)
+
+	mergerCtx  context.Context // Context bounding the merger goroutine
+	mergerSize int             // Capacity of the merger queue (0 = streams broadcast directly)
+
+	forwardCtx      context.Context   // Context bounding the parent relay forwarder
+	forwardAddr     string            // Address of the parent relay ("" = no forwarding)
+	forwardDialOpts []grpc.DialOption // Dial options of the parent relay connection
+}
+
+// WithReconnectTokens enables reconnection tokens for SubscribeMetrics.
+//
+// When set, every subscriber receives a signed token in the
+// relay-reconnect-token response header. Presenting that token on a later
+// SubscribeMetrics call restores the original subscriber ID.
+//
+// Parameters:
+//   - signer: token signer used to issue and verify tokens.
+func WithReconnectTokens(signer *token.Signer) ServerOption {
+	return func(c *serverConfig) {
+		c.tokenSigner = signer
+	}
+}
+
+// WithOneStreamPerIP limits every agent IP to a single open agent stream
+// (SendMetrics or AgentControl). Further streams from the same IP are rejected
+// with codes.AlreadyExists until the open one ends.
+func WithOneStreamPerIP() ServerOption {
+	return func(c *serverConfig) {
+		c.oneStreamPerIP = true
+	}
+}
+
+// WithAgentIDReuse accepts several concurrent SendMetrics and SendMetricsV2
+// streams with the same relay-agent-id metadata, for deployments that
+// intentionally reuse agent IDs. By default, such a stream is rejected with
+// codes.AlreadyExists while the first one is open, as it usually indicates a
+// misconfiguration.
+func WithAgentIDReuse() ServerOption {
+	return func(c *serverConfig) {
+		c.allowAgentIDReuse = true
+	}
+}
+
+// WithSendMetricsIdleTimeout closes SendMetrics streams that receive no message
+// within the given duration, with codes.DeadlineExceeded.
+//
+// Parameters:
+//   - d: idle timeout (0 = disabled).
+func WithSendMetricsIdleTimeout(d time.Duration) ServerOption {
+	return func(c *serverConfig) {
+		c.sendIdleTimeout = d
+	}
+}
+
+// WithSubscriberFlowControl sets the acknowledgment window of
+// SubscribeMetricsFlowControlled streams: once maxUnacked messages are sent but
+// not acknowledged, the relay stops sending to the subscriber until it
+// acknowledges more, waiting at most blockTimeout before ending the stream with
+// codes.DeadlineExceeded. Meanwhile, messages queue on the subscriber channel
+// and the SlowSubscriberPolicy applies once it is full.
+//
+// Parameters:
+//   - maxUnacked: window size in messages (0 = unlimited).
+//   - blockTimeout: maximum wait for an acknowledgment; must be positive with a window.
+func WithSubscriberFlowControl(maxUnacked int, blockTimeout time.Duration) ServerOption {
+	return func(c *serverConfig) {
+		c.maxUnacked = maxUnacked
+		c.windowBlockTimeout = blockTimeout
+	}
+}
+
+// WithMinSendInterval ends SendMetrics streams with codes.ResourceExhausted when
+// a message is received less than d after the previous message of the same
+// stream, to cut off agents flooding the relay. The interval applies to each
+// stream separately.
+//
+// Parameters:
+//   - d: minimum interval between two messages of a stream (0 = unlimited).
+func WithMinSendInterval(d time.Duration) ServerOption {
+	return func(c *serverConfig) {
+		c.minSendInterval = d
+	}
+}
+
+// WithAgentRateAlert tracks an exponentially weighted moving average of the
+// messages per second received on each SendMetrics stream, and logs a warning
+// (at most once per rateAlertInterval) while it exceeds threshold.
+//
+// Parameters:
+//   - threshold: alert threshold in messages per second (0 = disabled).
+//   - window: EWMA averaging window.
+func WithAgentRateAlert(threshold float64, window time.Duration) ServerOption {
+	return func(c *serverConfig) {
+		c.rateThreshold = threshold
+		c.rateWindow = window
+	}
+}
+
+// WithSupportedAgentVersions checks the relay-agent-version metadata of every
+// agent stream against the given semver constraints (e.g., ">=1.0.0, <2.0.0").
+// Unsupported versions are logged as a warning; when require is set, the stream
+// is also rejected with codes.FailedPrecondition.
+//
+// Parameters:
+//   - constraints: supported agent versions.
+//   - require: whether unsupported versions are rejected.
+func WithSupportedAgentVersions(constraints *semver.Constraints, require bool) ServerOption {
+	return func(c *serverConfig) {
+		c.agentVersions = constraints
+		c.requireAgentVersion = require
+	}
+}
+
+// WithQuota charges every message received on an agent stream to the agent's
+// quota in store. A message beyond the quota ends the stream with
+// codes.ResourceExhausted. Resetting the store (e.g., quota.ResetDaily) is up
+// to the caller.
+//
+// Parameters:
+//   - store: the quota store.
+func WithQuota(store quota.QuotaStore) ServerOption {
+	return func(c *serverConfig) {
+		c.quota = store
+	}
+}
+
+// WithBatching makes SendMetrics accumulate up to size messages and broadcast
+// them with a single Broadcaster.BroadcastBatch call, reducing lock traffic
+// under high agent throughput.
+//
+// Parameters:
+//   - size: messages per batch (<= 1 = no batching).
+//   - flushInterval: maximum time a message waits for its batch to fill (0 = only flush when full).
+func WithBatching(size int, flushInterval time.Duration) ServerOption {
+	return func(c *serverConfig) {
+		c.batchSize = size
+		c.batchFlushInterval = flushInterval
+	}
+}
+
+// WithPersistentSubscribers enables the relay-subscriber-persist-id metadata on
+// SubscribeMetrics. The server remembers the last message delivered under each
+// persistent ID for ttl after its stream ends, so a reconnecting subscriber
+// resumes from the next buffered message without duplicates. Resumption only
+// covers the messages still held in the Broadcaster replay buffer (WithReplayBuffer).
+//
+// Parameters:
+//   - ttl: how long the delivery position is kept after a disconnect (0 = disabled).
+func WithPersistentSubscribers(ttl time.Duration) ServerOption {
+	return func(c *serverConfig) {
+		c.persistTTL = ttl
+	}
+}
+
+// WithSendOrdering makes SendMetrics enforce the order of sequenced messages:
+// a message with a non-zero sequence_number must carry exactly the sequence
+// number of the previous sequenced message of the same stream plus one (1 for
+// the first), otherwise the stream ends with codes.OutOfRange. Messages without
+// a sequence number are not checked.
+func WithSendOrdering() ServerOption {
+	return func(c *serverConfig) {
+		c.enforceSendOrdering = true
+	}
+}
+
+// WithSendAcks makes SendMetricsV2 acknowledge processed messages while the
+// stream is open, in addition to the final acknowledgment. With both values
+// 0, only the final acknowledgment is sent.
+//
+// Parameters:
+//   - interval: maximum time a processed message stays unacknowledged (0 = no timed acks).
+//   - every: number of processed messages that triggers an acknowledgment (0 = no count-based acks).
+func WithSendAcks(interval time.Duration, every int) ServerOption {
+	return func(c *serverConfig) {
+		c.ackInterval = interval
+		c.ackEvery = every
+	}
+}
+
+// WithMaxProtoDepth rejects agent messages nested deeper than n levels (see
+// proto.Depth) with codes.InvalidArgument, ending the stream.
+//
+// Parameters:
+//   - n: maximum nesting depth, counting the Metrics message itself (0 = unlimited).
+func WithMaxProtoDepth(n int) ServerOption {
+	return func(c *serverConfig) {
+		c.maxProtoDepth = n
+	}
+}
+
+// WithMaxMessageSize rejects agent messages whose encoded size (proto.Size)
+// exceeds n bytes with codes.InvalidArgument, ending the stream. Unlike the gRPC
+// transport limit, the error reports the actual and maximum sizes.
+//
+// Parameters:
+//   - n: maximum message size in bytes (0 = unlimited).
+func WithMaxMessageSize(n int) ServerOption {
+	return func(c *serverConfig) {
+		c.maxMessageSize = n
+	}
+}
+
+// WithMaxPodsPerMessage rejects agent messages carrying more than n PodMetrics
+// with codes.InvalidArgument, ending the stream, to bound the memory a single
+// message can take.
+//
+// Parameters:
+//   - n: maximum number of pods per message (0 = unlimited).
+func WithMaxPodsPerMessage(n int) ServerOption {
+	return func(c *serverConfig) {
+		c.maxPodsPerMessage = n
+	}
+}
+
+// WithMaxClusterTopics bounds the number of cluster topics (relay-cluster-name)
+// the relay creates. Every topic holds a Broadcaster, and its workers with
+// WithWorkerPool, for the lifetime of the server; once n topics exist, agent
+// and subscriber streams naming a new cluster are rejected with
+// codes.ResourceExhausted. Streams of existing topics are unaffected.
+//
+// Parameters:
+//   - n: maximum number of cluster topics (0 = unlimited).
+func WithMaxClusterTopics(n int) ServerOption {
+	return func(c *serverConfig) {
+		c.maxClusterTopics = n
+	}
+}
+
+// WithAgentLogInterval makes SendMetrics and SendMetricsV2 log, every d, a
+// summary of what each stream received during the interval: agent_id (as in
+// Agents), hostname (of the last message), messages_last_interval,
+// bytes_last_interval (encoded size) and unique_pods. The counters reset after
+// every summary.
+//
+// Parameters:
+//   - d: summary interval (0 = disabled).
+func WithAgentLogInterval(d time.Duration) ServerOption {
+	return func(c *serverConfig) {
+		c.agentLogInterval = d
+	}
+}
+
+// WithPausedRetryAfter sets the retry-after header of the agent streams
+// rejected while the broadcaster is paused (see Broadcaster.PauseAll), in whole
+// seconds rounded up. Agents should wait that long before retrying; it should
+// match how long pauses usually last.
+//
+// Parameters:
+//   - d: suggested retry delay (0 = 10s).
+func WithPausedRetryAfter(d time.Duration) ServerOption {
+	return func(c *serverConfig) {
+		c.pausedRetryAfter = d
+	}
+}
+
+// WithForwardToRelay forwards every message accepted from local agents to a
+// parent relay, for hierarchical topologies. The server keeps a SendMetrics
+// client stream open to addr from a separate goroutine, stopped when ctx is
+// done, so forwarding never blocks the agent streams; up to 1000 messages wait
+// to be forwarded, and further ones are dropped with a warning. A stream that
+// cannot be opened or fails is reopened with exponential backoff, from 100ms
+// up to 30s.
+//
+// Parameters:
+//   - ctx: context bounding the forwarder.
+//   - addr: gRPC target of the parent relay ("" = disabled).
+//   - dialOpts: dial options of the parent connection (none = plaintext), e.g.
+//     grpc.WithTransportCredentials(ForwardTLSCredentials(...)) for (mutual) TLS.
+func WithForwardToRelay(ctx context.Context, addr string, dialOpts ...grpc.DialOption) ServerOption {
+	return func(c *serverConfig) {
+		c.forwardCtx = ctx
+		c.forwardAddr = addr
+		c.forwardDialOpts = dialOpts
+	}
+}
+
+// WithSubscriberAck makes agent streams wait, after broadcasting each message,
+// until at least one subscriber of the default topic received it (see
+// Broadcaster.BroadcastAcked) before processing the next one, so that agents
+// sending critical metrics are slowed down rather than outpacing subscribers.
+// While no subscriber is connected, each message waits up to the timeout for one
+// to connect; a message no subscriber received in time is logged as a warning and the
+// stream continues. Messages batched with WithBatching are not waited on.
+//
+// Parameters:
+//   - timeout: maximum wait per message (0 = disabled).
+func WithSubscriberAck(timeout time.Duration) ServerOption {
+	return func(c *serverConfig) {
+		c.subscriberAckTimeout = timeout
+	}
+}
+
+// WithMerger makes agent streams queue their accepted messages to a single
+// merger goroutine instead of calling the Broadcaster themselves. The merger
+// broadcasts every message queued while its previous broadcast ran with one
+// Broadcaster.BroadcastBatch call (up to 256 messages), so that many concurrent
+// agents share subscriber snapshots instead of contending on the Broadcaster.
+// A full queue blocks the agent stream until there is room. The merger stops
+// when ctx is done; messages still queued are then lost, and later messages are
+// broadcast by their stream again. Messages batched with WithBatching, and all
+// messages with WithSubscriberAck, bypass the merger.
+//
+// Parameters:
+//   - ctx: context bounding the merger goroutine.
+//   - size: capacity of the merger queue (0 = disabled).
+func WithMerger(ctx context.Context, size int) ServerOption {
+	return func(c *serverConfig) {
+		c.mergerCtx = ctx
+		c.mergerSize = size
+	}
+}
@@ -0,0 +1,1373 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubensage/relay/pkg/buildinfo"
+	"github.com/kubensage/relay/pkg/codec"
+	"github.com/kubensage/relay/pkg/metrics"
+	"github.com/kubensage/relay/pkg/quota"
+	"github.com/kubensage/relay/pkg/token"
+	"github.com/kubensage/relay/proto/gen"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// subscribeHeader opens a SubscribeMetrics stream with the given metadata and
+// returns its response header, or the stream error if it was rejected.
+func subscribeHeader(t *testing.T, ctx context.Context, client gen.MetricsServiceClient) (metadata.MD, error) {
+	t.Helper()
+	stream, err := client.SubscribeMetrics(ctx, &emptypb.Empty{})
+	if err != nil {
+		return nil, err
+	}
+	if header, _ := stream.Header(); len(header.Get(subscriberIDKey)) > 0 {
+		return header, nil
+	}
+	_, err = stream.Recv()
+	return nil, err
+}
+
+func TestReconnectTokenRestoresSubscriberOnItsTopic(t *testing.T) {
+	signer := token.NewSigner([]byte("test-key"), time.Hour)
+	client, ms := startTestServer(t, newTestBroadcaster(t, nil), WithReconnectTokens(signer))
+
+	firstCtx, cancelFirst := context.WithCancel(withMetadata(t, clusterNameKey, "east"))
+	header, err := subscribeHeader(t, firstCtx, client)
+	if err != nil {
+		t.Fatalf("first subscription: %v", err)
+	}
+	id := header.Get(subscriberIDKey)[0]
+	tok := header.Get(reconnectTokenKey)[0]
+
+	_, err = subscribeHeader(t, withMetadata(t, clusterNameKey, "east", reconnectTokenKey, tok), client)
+	if status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("reconnect while connected: got %v, want AlreadyExists", err)
+	}
+	_, err = subscribeHeader(t, withMetadata(t, reconnectTokenKey, tok), client)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("reconnect on another topic: got %v, want Unauthenticated", err)
+	}
+
+	cancelFirst()
+	east, err := ms.topicFor("east")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the first subscriber to unregister", func() bool { return !east.broadcaster.Has(id) })
+
+	header, err = subscribeHeader(t, withMetadata(t, clusterNameKey, "east", reconnectTokenKey, tok), client)
+	if err != nil {
+		t.Fatalf("reconnect: %v", err)
+	}
+	if got := header.Get(subscriberIDKey)[0]; got != id {
+		t.Fatalf("restored ID: got %s, want %s", got, id)
+	}
+}
+
+func TestReconnectTokenRejectsExpiredToken(t *testing.T) {
+	signer := token.NewSigner([]byte("test-key"), time.Hour)
+	client, _ := startTestServer(t, newTestBroadcaster(t, nil), WithReconnectTokens(signer))
+
+	expired, err := token.NewSigner([]byte("test-key"), -time.Minute).Issue("sub-1", defaultTopic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = subscribeHeader(t, withMetadata(t, reconnectTokenKey, expired), client)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("got %v, want Unauthenticated", err)
+	}
+}
+
+func TestExpiredMetricsAreDiscarded(t *testing.T) {
+	for _, rpc := range []string{"SendMetrics", "AgentControl"} {
+		t.Run(rpc, func(t *testing.T) {
+			b := newTestBroadcaster(t, nil)
+			client, _ := startTestServer(t, b)
+			ch := make(chan *gen.Metrics, 4)
+			if _, err := b.Register("sub", ch); err != nil {
+				t.Fatal(err)
+			}
+
+			var send func(*gen.Metrics) error
+			if rpc == "SendMetrics" {
+				stream, err := client.SendMetrics(t.Context())
+				if err != nil {
+					t.Fatal(err)
+				}
+				send = stream.Send
+			} else {
+				stream, err := client.AgentControl(t.Context())
+				if err != nil {
+					t.Fatal(err)
+				}
+				send = stream.Send
+			}
+
+			before := testutil.ToFloat64(metrics.MessagesExpired)
+			stale := hostMetrics("stale")
+			stale.ExpiresAt = timestamppb.New(time.Now().Add(-time.Minute))
+			if err := send(stale); err != nil {
+				t.Fatal(err)
+			}
+			if err := send(hostMetrics("fresh")); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := receive(t, ch).GetNodeMetrics().GetHostname(); got != "fresh" {
+				t.Fatalf("relayed message: got %q, want the unexpired one", got)
+			}
+			if got := testutil.ToFloat64(metrics.MessagesExpired) - before; got != 1 {
+				t.Fatalf("expired counter increment: got %v, want 1", got)
+			}
+		})
+	}
+}
+
+func TestAgentControlEnforcesSendOrdering(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	client, _ := startTestServer(t, b, WithSendOrdering())
+	ch := make(chan *gen.Metrics, 4)
+	if _, err := b.Register("sub", ch); err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := client.AgentControl(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, seq := range []uint64{1, 2, 4} {
+		msg := hostMetrics("node")
+		msg.SequenceNumber = seq
+		if err := stream.Send(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for range 2 {
+		receive(t, ch)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.OutOfRange {
+		t.Fatalf("out-of-order message: got %v, want OutOfRange", err)
+	}
+}
+
+func TestAgentControlRejectedWhilePaused(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	client, _ := startTestServer(t, b)
+	b.PauseAll()
+
+	stream, err := client.AgentControl(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.Unavailable {
+		t.Fatalf("stream while paused: got %v, want Unavailable", err)
+	}
+	if header, _ := stream.Header(); len(header.Get(retryAfterKey)) == 0 {
+		t.Fatalf("missing %s header", retryAfterKey)
+	}
+}
+
+func TestStreamLogLinesCarryStreamFields(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	client, _ := startLoggedTestServer(t, zap.New(core), newTestBroadcaster(t, nil))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	header, err := subscribeHeader(t, ctx, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := header.Get(subscriberIDKey)[0]
+	cancel()
+	waitFor(t, "the disconnect log line", func() bool {
+		return logs.FilterMessage("subscriber disconnected").Len() == 1
+	})
+	for _, entry := range logs.TakeAll() {
+		if got := entry.ContextMap()["subscriber_id"]; got != id {
+			t.Errorf("subscriber log line %q: subscriber_id %v, want %s", entry.Message, got, id)
+		}
+		if _, ok := entry.ContextMap()["peer_addr"]; !ok {
+			t.Errorf("subscriber log line %q has no peer_addr", entry.Message)
+		}
+	}
+
+	stream, err := client.SendMetrics(withMetadata(t, agentIDKey, "agent-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Send(hostMetrics("node")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.CloseAndRecv(); err != nil {
+		t.Fatal(err)
+	}
+	entries := logs.TakeAll()
+	if len(entries) == 0 {
+		t.Fatal("SendMetrics logged nothing")
+	}
+	for _, entry := range entries {
+		if got := entry.ContextMap()["agent_id"]; got != "agent-1" {
+			t.Errorf("agent log line %q: agent_id %v, want agent-1", entry.Message, got)
+		}
+		if _, ok := entry.ContextMap()["peer_addr"]; !ok {
+			t.Errorf("agent log line %q has no peer_addr", entry.Message)
+		}
+	}
+}
+
+func TestActiveAgentCountTracksOpenStreams(t *testing.T) {
+	client, ms := startTestServer(t, newTestBroadcaster(t, nil))
+
+	stream, err := client.SendMetrics(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Send(hostMetrics("node")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the agent stream to be counted", func() bool { return ms.ActiveAgentCount() == 1 })
+
+	if _, err := stream.CloseAndRecv(); err != nil {
+		t.Fatal(err)
+	}
+	if n := ms.ActiveAgentCount(); n != 0 {
+		t.Fatalf("active agents after the stream ended: got %d, want 0", n)
+	}
+}
+
+func TestAgentControlForwardsControlMessages(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	client, ms := startTestServer(t, b)
+	ch := make(chan *gen.Metrics, 1)
+	if _, err := b.Register("sub", ch); err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := client.AgentControl(withMetadata(t, agentIDKey, "agent-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := stream.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := header.Get(agentIDKey); len(got) != 1 || got[0] != "agent-1" {
+		t.Fatalf("agent id header: got %v, want agent-1", got)
+	}
+
+	if err := ms.SendAgentControl("agent-1", &gen.ControlMessage{Command: gen.ControlCommand_PAUSE}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.GetCommand() != gen.ControlCommand_PAUSE {
+		t.Fatalf("control command: got %s, want PAUSE", msg.GetCommand())
+	}
+
+	if err := stream.Send(hostMetrics("node")); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, ch)
+
+	if err := ms.SendAgentControl("unknown", &gen.ControlMessage{}); !errors.Is(err, ErrAgentNotFound) {
+		t.Fatalf("unknown agent: got %v, want ErrAgentNotFound", err)
+	}
+}
+
+func TestOneStreamPerIPRejectsSecondStream(t *testing.T) {
+	client, ms := startTestServer(t, newTestBroadcaster(t, nil), WithOneStreamPerIP())
+
+	// open starts a SendMetrics stream; every bufconn stream has the same peer address
+	open := func() gen.MetricsService_SendMetricsClient {
+		stream, err := client.SendMetrics(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := stream.Send(hostMetrics("node")); err != nil {
+			t.Fatal(err)
+		}
+		return stream
+	}
+
+	first := open()
+	waitFor(t, "the first stream to open", func() bool { return ms.ActiveAgentCount() == 1 })
+	if _, err := open().CloseAndRecv(); status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("second stream from the same IP: got %v, want AlreadyExists", err)
+	}
+
+	if _, err := first.CloseAndRecv(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := open().CloseAndRecv(); err != nil {
+		t.Fatalf("stream after the first one ended: %v", err)
+	}
+}
+
+func TestDuplicatePodNamesAreRejected(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	client, _ := startTestServer(t, b)
+	ch := make(chan *gen.Metrics, 1)
+	if _, err := b.Register("sub", ch); err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := client.SendMetrics(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := hostMetrics("node")
+	msg.PodMetrics = []*gen.PodMetrics{
+		{Name: "web", Namespace: "default"},
+		{Name: "web", Namespace: "default"},
+	}
+	if err := stream.Send(msg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.CloseAndRecv(); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("duplicate pods: got %v, want InvalidArgument", err)
+	}
+	if len(ch) != 0 {
+		t.Fatal("rejected message was broadcast")
+	}
+}
+
+func TestSendMetricsIdleTimeoutClosesSilentStream(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+	client, _ := startTestServer(t, newTestBroadcaster(t, nil), WithSendMetricsIdleTimeout(timeout))
+
+	stream, err := client.SendMetrics(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	var empty emptypb.Empty
+	if err := stream.RecvMsg(&empty); status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("silent stream: got %v, want DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d < timeout {
+		t.Fatalf("stream closed after %v, before the %v idle timeout", d, timeout)
+	}
+}
+
+func TestSubscribeMetricsV2AppliesFilterUpdates(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	b := newTestBroadcaster(t, nil)
+	client, _ := startLoggedTestServer(t, zap.New(core), b)
+
+	stream, err := client.SubscribeMetricsV2(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Header(); err != nil {
+		t.Fatal(err)
+	}
+	// recvHost returns the hostname of the next message forwarded to the stream
+	recvHost := func() string {
+		msg, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg.GetNodeMetrics().GetHostname()
+	}
+
+	b.Broadcast(hostMetrics("node-1"))
+	if got := recvHost(); got != "node-1" {
+		t.Fatalf("unfiltered stream: got %q, want node-1", got)
+	}
+
+	if err := stream.Send(&gen.FilterUpdate{HostnameGlob: "edge-*"}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the filter update", func() bool {
+		return logs.FilterMessage("subscriber filter updated").Len() == 1
+	})
+	b.Broadcast(hostMetrics("node-2"))
+	b.Broadcast(hostMetrics("edge-1"))
+	if got := recvHost(); got != "edge-1" {
+		t.Fatalf("filtered stream: got %q, want edge-1", got)
+	}
+}
+
+func TestMaxConcurrentStreamsQueuesExtraSubscribers(t *testing.T) {
+	ms := NewMetricsServer(zap.NewNop(), newTestBroadcaster(t, nil))
+	client := gen.NewMetricsServiceClient(serveTest(t, func(srv *grpc.Server) {
+		gen.RegisterMetricsServiceServer(srv, ms)
+	}, grpc.MaxConcurrentStreams(1)))
+
+	firstCtx, cancelFirst := context.WithCancel(t.Context())
+	if _, err := subscribeHeader(t, firstCtx, client); err != nil {
+		t.Fatal(err)
+	}
+
+	second := make(chan error, 1)
+	go func() {
+		stream, err := client.SubscribeMetrics(t.Context(), &emptypb.Empty{})
+		if err == nil {
+			_, err = stream.Header()
+		}
+		second <- err
+	}()
+	select {
+	case err := <-second:
+		t.Fatalf("second stream opened beyond the limit (%v)", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	cancelFirst()
+	select {
+	case err := <-second:
+		if err != nil {
+			t.Fatalf("second stream: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second stream did not open once the first one ended")
+	}
+}
+
+func TestQuotaIsEnforcedAcrossReconnections(t *testing.T) {
+	client, _ := startTestServer(t, newTestBroadcaster(t, nil), WithQuota(quota.NewMemoryStore(3)))
+
+	// send sends n messages as agent-1 on a new stream and returns the stream status
+	send := func(n int) error {
+		stream, err := client.SendMetrics(withMetadata(t, agentIDKey, "agent-1"))
+		if err != nil {
+			return err
+		}
+		for range n {
+			if err := stream.Send(hostMetrics("node")); err != nil {
+				break
+			}
+		}
+		_, err = stream.CloseAndRecv()
+		return err
+	}
+
+	if err := send(2); err != nil {
+		t.Fatalf("first stream within the quota: %v", err)
+	}
+	if err := send(2); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("message beyond the quota after reconnecting: got %v, want ResourceExhausted", err)
+	}
+}
+
+// recordingJSONCodec is the JSON codec, recording the raw messages it decodes.
+type recordingJSONCodec struct {
+	codec.JSON
+	received chan []byte
+}
+
+func (c recordingJSONCodec) Unmarshal(data []byte, v any) error {
+	c.received <- append([]byte(nil), data...)
+	return c.JSON.Unmarshal(data, v)
+}
+
+func TestSubscribeMetricsSendsJSONToJSONClients(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	client, _ := startTestServer(t, b)
+	rec := recordingJSONCodec{received: make(chan []byte, 1)}
+
+	stream, err := client.SubscribeMetrics(t.Context(), &emptypb.Empty{}, grpc.ForceCodec(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Header(); err != nil {
+		t.Fatal(err)
+	}
+	b.Broadcast(hostMetrics("node"))
+
+	msg, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.GetNodeMetrics().GetHostname() != "node" {
+		t.Fatalf("decoded message: got %v", msg)
+	}
+	if raw := <-rec.received; !json.Valid(raw) {
+		t.Fatalf("message on the wire is not JSON: %q", raw)
+	}
+}
+
+func TestSubscribeMetricsRejectedAtSubscriberCap(t *testing.T) {
+	client, _ := startTestServer(t, newTestBroadcaster(t, nil, WithSubscriberCap(1)))
+	if _, err := subscribeHeader(t, t.Context(), client); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := subscribeHeader(t, t.Context(), client); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("subscriber beyond the cap: got %v, want ResourceExhausted", err)
+	}
+}
+
+func TestSendMetricsEndsWhenStreamContextIsDone(t *testing.T) {
+	client, ms := startTestServer(t, newTestBroadcaster(t, nil))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	stream, err := client.SendMetrics(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Send(hostMetrics("node")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the agent stream to open", func() bool { return ms.ActiveAgentCount() == 1 })
+
+	cancel()
+	waitFor(t, "the handler to return", func() bool { return ms.ActiveAgentCount() == 0 })
+}
+
+func TestPingReportsServerState(t *testing.T) {
+	client, ms := startTestServer(t, newTestBroadcaster(t, nil))
+	ms.startedAt = time.Now().Add(-5 * time.Second)
+
+	before := time.Now()
+	resp, err := client.Ping(t.Context(), &emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if at := resp.GetServerTime().AsTime(); at.Before(before) || at.After(time.Now()) {
+		t.Fatalf("server time %v, want during the call", at)
+	}
+	if resp.GetVersion() != buildinfo.Version {
+		t.Fatalf("version: got %q, want %q", resp.GetVersion(), buildinfo.Version)
+	}
+	if up := resp.GetUptimeSeconds(); up < 5 || up > 6 {
+		t.Fatalf("uptime: got %ds, want 5s", up)
+	}
+}
+
+func TestSendOrderingIsEnforcedPerStream(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	client, _ := startTestServer(t, b, WithSendOrdering())
+	ch := make(chan *gen.Metrics, 10)
+	if _, err := b.Register("sub", ch); err != nil {
+		t.Fatal(err)
+	}
+
+	// send sends messages with the given sequence numbers on a new stream and
+	// returns the stream status
+	send := func(seqs ...uint64) error {
+		stream, err := client.SendMetrics(t.Context())
+		if err != nil {
+			return err
+		}
+		for _, seq := range seqs {
+			msg := hostMetrics("node")
+			msg.SequenceNumber = seq
+			if err := stream.Send(msg); err != nil {
+				break
+			}
+		}
+		_, err = stream.CloseAndRecv()
+		return err
+	}
+
+	if err := send(1, 2, 0, 3); err != nil {
+		t.Fatalf("in-order stream: %v", err)
+	}
+	if len(ch) != 4 {
+		t.Fatalf("relayed messages: got %d, want 4", len(ch))
+	}
+	if err := send(1, 3); status.Code(err) != codes.OutOfRange {
+		t.Fatalf("out-of-order stream: got %v, want OutOfRange", err)
+	}
+	if len(ch) != 5 {
+		t.Fatalf("relayed messages: got %d, want the out-of-order one rejected", len(ch))
+	}
+}
+
+func TestSendMetricsV2AcknowledgesProcessedMessages(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	ch := make(chan *gen.Metrics, 10)
+	if _, err := b.Register("sub", ch); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("every", func(t *testing.T) {
+		client, _ := startTestServer(t, b, WithSendAcks(0, 2))
+		stream, err := client.SendMetricsV2(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for range 5 {
+			if err := stream.Send(hostMetrics("node")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := stream.CloseSend(); err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []uint64{2, 4, 5} {
+			ack, err := stream.Recv()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ack.GetAcknowledgedCount() != want {
+				t.Fatalf("acknowledged count: got %d, want %d", ack.GetAcknowledgedCount(), want)
+			}
+		}
+		if _, err := stream.Recv(); err != io.EOF {
+			t.Fatalf("after the final ack: got %v, want EOF", err)
+		}
+	})
+
+	t.Run("interval", func(t *testing.T) {
+		client, _ := startTestServer(t, b, WithSendAcks(10*time.Millisecond, 0))
+		stream, err := client.SendMetricsV2(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := stream.Send(hostMetrics("node")); err != nil {
+			t.Fatal(err)
+		}
+		ack, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ack.GetAcknowledgedCount() != 1 {
+			t.Fatalf("timed ack: got %d, want 1", ack.GetAcknowledgedCount())
+		}
+		if err := stream.CloseSend(); err != nil {
+			t.Fatal(err)
+		}
+		if ack, err := stream.Recv(); err != nil || ack.GetAcknowledgedCount() != 1 {
+			t.Fatalf("final ack: got %v, %v, want 1", ack, err)
+		}
+	})
+
+	if len(ch) != 6 {
+		t.Fatalf("relayed messages: got %d, want 6", len(ch))
+	}
+}
+
+func TestTimeToFirstMessageIsObservedOnce(t *testing.T) {
+	const delay = 150 * time.Millisecond
+	client, ms := startTestServer(t, newTestBroadcaster(t, nil))
+
+	// observed returns the sample count and sum, and the cumulative count of
+	// the 0.1s bucket
+	observed := func() (count uint64, sum float64, le100ms uint64) {
+		var m dto.Metric
+		if err := metrics.AgentTimeToFirstMessage.Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		for _, b := range m.GetHistogram().GetBucket() {
+			if b.GetUpperBound() == 0.1 {
+				le100ms = b.GetCumulativeCount()
+			}
+		}
+		return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum(), le100ms
+	}
+	count, sum, le100ms := observed()
+
+	stream, err := client.SendMetrics(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The stream is tracked once the handler has started timing it, so the
+	// time to first message is at least the delay
+	waitFor(t, "the agent stream to be tracked", func() bool { return ms.ActiveAgentCount() == 1 })
+	time.Sleep(delay)
+	for range 3 {
+		if err := stream.Send(hostMetrics("node")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := stream.CloseAndRecv(); err != nil {
+		t.Fatal(err)
+	}
+
+	gotCount, gotSum, got100ms := observed()
+	if gotCount != count+1 {
+		t.Fatalf("observations: got %d more, want 1", gotCount-count)
+	}
+	if ttfm := gotSum - sum; ttfm < delay.Seconds() {
+		t.Fatalf("observed time to first message: got %.3fs, want at least %v", ttfm, delay)
+	}
+	if got100ms != le100ms {
+		t.Fatalf("buckets: le=0.1 got %d more, want 0", got100ms-le100ms)
+	}
+}
+
+func TestSendMetricsRejectsMessagesNestedTooDeeply(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	client, _ := startTestServer(t, b, WithMaxProtoDepth(2))
+	ch := make(chan *gen.Metrics, 1)
+	if _, err := b.Register("sub", ch); err != nil {
+		t.Fatal(err)
+	}
+
+	// send sends msg on a new stream and returns the stream status
+	send := func(msg *gen.Metrics) error {
+		stream, err := client.SendMetrics(t.Context())
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(msg); err != nil {
+			return err
+		}
+		_, err = stream.CloseAndRecv()
+		return err
+	}
+
+	if err := send(hostMetrics("node")); err != nil {
+		t.Fatalf("shallow message: %v", err)
+	}
+	receive(t, ch)
+	deep := &gen.Metrics{NodeMetrics: &gen.NodeMetrics{PrimaryIpv4: wrapperspb.String("10.0.0.1")}}
+	if err := send(deep); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("deep message: got %v, want InvalidArgument", err)
+	}
+	if len(ch) != 0 {
+		t.Fatal("the deep message was relayed")
+	}
+}
+
+func TestSubscribeMetricsSendsSubscriberIDHeader(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	b := newTestBroadcaster(t, nil)
+	client, _ := startLoggedTestServer(t, zap.New(core), b)
+
+	// Nothing is broadcast: the header must not wait for a first message
+	stream, err := client.SubscribeMetrics(t.Context(), &emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := stream.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := header.Get(subscriberIDKey)
+	if len(ids) != 1 {
+		t.Fatalf("%s header: got %v, want one ID", subscriberIDKey, ids)
+	}
+
+	connected := logs.FilterMessage("subscriber connected").All()
+	if len(connected) != 1 {
+		t.Fatalf("connected log lines: got %d, want 1", len(connected))
+	}
+	if logged := connected[0].ContextMap()["subscriber_id"]; logged != ids[0] {
+		t.Fatalf("logged subscriber_id %v, header %s", logged, ids[0])
+	}
+	if _, ok := b.RegisteredSince(ids[0]); !ok {
+		t.Fatalf("no subscriber registered as %s", ids[0])
+	}
+}
+
+func TestSendMetricsRejectsOversizedMessages(t *testing.T) {
+	small := hostMetrics("node")
+	large := hostMetrics(strings.Repeat("n", 100))
+	client, _ := startTestServer(t, newTestBroadcaster(t, nil), WithMaxMessageSize(proto.Size(small)))
+
+	stream, err := client.SendMetrics(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []*gen.Metrics{small, large} {
+		if err := stream.Send(msg); err != nil {
+			break
+		}
+	}
+	_, err = stream.CloseAndRecv()
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("oversized message: got %v, want InvalidArgument", err)
+	}
+	want := fmt.Sprintf("message size %d bytes exceeds the maximum of %d bytes", proto.Size(large), proto.Size(small))
+	if msg := status.Convert(err).Message(); msg != want {
+		t.Fatalf("error message: got %q, want %q", msg, want)
+	}
+}
+
+func TestSendMetricsRejectsMessagesWithTooManyPods(t *testing.T) {
+	const limit = 3
+	// withPods returns a Metrics message carrying n distinct pods
+	withPods := func(n int) *gen.Metrics {
+		msg := hostMetrics("node")
+		for i := range n {
+			msg.PodMetrics = append(msg.PodMetrics, &gen.PodMetrics{Namespace: "default", Name: fmt.Sprintf("pod-%d", i)})
+		}
+		return msg
+	}
+	b := newTestBroadcaster(t, nil)
+	ch := make(chan *gen.Metrics, 1)
+	if _, err := b.Register("sub", ch); err != nil {
+		t.Fatal(err)
+	}
+	client, _ := startTestServer(t, b, WithMaxPodsPerMessage(limit))
+
+	stream, err := client.SendMetrics(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Send(withPods(limit)); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(receive(t, ch).GetPodMetrics()); got != limit {
+		t.Fatalf("message at the limit: got %d pods, want %d", got, limit)
+	}
+
+	_ = stream.Send(withPods(limit + 1))
+	_, err = stream.CloseAndRecv()
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("message beyond the limit: got %v, want InvalidArgument", err)
+	}
+	want := fmt.Sprintf("message has %d pod metrics, exceeding the maximum of %d", limit+1, limit)
+	if msg := status.Convert(err).Message(); msg != want {
+		t.Fatalf("error message: got %q, want %q", msg, want)
+	}
+	select {
+	case msg := <-ch:
+		t.Fatalf("rejected message was broadcast: %v", msg)
+	default:
+	}
+}
+
+func TestStreamDurationIsObservedByExitReason(t *testing.T) {
+	// observed returns the sample count of the series and the count of its
+	// first (1s) bucket
+	observed := func(method, reason string) (count, le1s uint64) {
+		var m dto.Metric
+		if err := metrics.StreamDuration.WithLabelValues(method, reason).(prometheus.Metric).Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		h := m.GetHistogram()
+		return h.GetSampleCount(), h.GetBucket()[0].GetCumulativeCount()
+	}
+
+	tests := []struct {
+		method, reason string
+		opts           []ServerOption
+		brOpts         []BroadcasterOption
+		run            func(t *testing.T, client gen.MetricsServiceClient)
+	}{
+		{
+			method: "SendMetrics", reason: "eof",
+			run: func(t *testing.T, client gen.MetricsServiceClient) {
+				stream, err := client.SendMetrics(t.Context())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := stream.CloseAndRecv(); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			method: "SendMetrics", reason: "error",
+			opts: []ServerOption{WithMaxMessageSize(1)},
+			run: func(t *testing.T, client gen.MetricsServiceClient) {
+				stream, err := client.SendMetrics(t.Context())
+				if err != nil {
+					t.Fatal(err)
+				}
+				_ = stream.Send(hostMetrics("node"))
+				if _, err := stream.CloseAndRecv(); status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("got %v, want InvalidArgument", err)
+				}
+			},
+		},
+		{
+			method: "SendMetrics", reason: "limit_exceeded",
+			opts: []ServerOption{WithSendMetricsIdleTimeout(10 * time.Millisecond)},
+			run: func(t *testing.T, client gen.MetricsServiceClient) {
+				stream, err := client.SendMetrics(t.Context())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := stream.RecvMsg(&emptypb.Empty{}); status.Code(err) != codes.DeadlineExceeded {
+					t.Fatalf("got %v, want DeadlineExceeded", err)
+				}
+			},
+		},
+		{
+			method: "SubscribeMetrics", reason: "context_canceled",
+			run: func(t *testing.T, client gen.MetricsServiceClient) {
+				ctx, cancel := context.WithCancel(t.Context())
+				if _, err := subscribeHeader(t, ctx, client); err != nil {
+					t.Fatal(err)
+				}
+				cancel()
+			},
+		},
+		{
+			method: "SubscribeMetrics", reason: "limit_exceeded",
+			brOpts: []BroadcasterOption{WithSubscriberCap(1)},
+			run: func(t *testing.T, client gen.MetricsServiceClient) {
+				if _, err := subscribeHeader(t, t.Context(), client); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := subscribeHeader(t, t.Context(), client); status.Code(err) != codes.ResourceExhausted {
+					t.Fatalf("got %v, want ResourceExhausted", err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+"/"+tt.reason, func(t *testing.T) {
+			count, le1s := observed(tt.method, tt.reason)
+			client, _ := startTestServer(t, newTestBroadcaster(t, nil, tt.brOpts...), tt.opts...)
+			tt.run(t, client)
+			waitFor(t, "the stream duration", func() bool {
+				gotCount, _ := observed(tt.method, tt.reason)
+				return gotCount == count+1
+			})
+			if _, got := observed(tt.method, tt.reason); got != le1s+1 {
+				t.Fatalf("1s bucket: got %d more, want 1", got-le1s)
+			}
+		})
+	}
+}
+
+func TestSubscribeMetricsSendsSubscriberCountHeader(t *testing.T) {
+	client, _ := startTestServer(t, newTestBroadcaster(t, nil))
+
+	for _, want := range []string{"1", "2"} {
+		// The previous subscriber stays connected
+		header, err := subscribeHeader(t, t.Context(), client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := header.Get(subscriberCountKey); len(got) != 1 || got[0] != want {
+			t.Fatalf("%s header: got %v, want %s", subscriberCountKey, got, want)
+		}
+	}
+}
+
+func TestSubscriberAckBlocksAgentStream(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+
+	// send sends count messages on a new stream and returns how long the
+	// stream took to complete
+	send := func(t *testing.T, client gen.MetricsServiceClient, count int) time.Duration {
+		start := time.Now()
+		stream, err := client.SendMetrics(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for range count {
+			if err := stream.Send(hostMetrics("node")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := stream.CloseAndRecv(); err != nil {
+			t.Fatal(err)
+		}
+		return time.Since(start)
+	}
+
+	t.Run("timeout without subscribers", func(t *testing.T) {
+		client, _ := startTestServer(t, newTestBroadcaster(t, nil), WithSubscriberAck(timeout))
+		if d := send(t, client, 2); d < 2*timeout {
+			t.Fatalf("stream completed after %v, want each message to wait %v", d, timeout)
+		}
+	})
+
+	t.Run("released by a subscriber", func(t *testing.T) {
+		b := newTestBroadcaster(t, nil)
+		client, _ := startTestServer(t, b, WithSubscriberAck(5*time.Second))
+		ch := make(chan *gen.Metrics, 2)
+		time.AfterFunc(timeout, func() {
+			if _, err := b.Register("sub", ch); err != nil {
+				t.Error(err)
+			}
+		})
+		if d := send(t, client, 2); d < timeout || d >= 5*time.Second {
+			t.Fatalf("stream completed after %v, want it to wait for the subscriber only", d)
+		}
+		if len(ch) != 2 {
+			t.Fatalf("received messages: got %d, want 2", len(ch))
+		}
+	})
+}
+
+func TestRequestIDIsLoggedAtEveryStage(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zap.New(core)
+	client, _ := startLoggedTestServer(t, logger, newTestBroadcaster(t, nil, WithLogger(logger)))
+
+	sub, err := client.SubscribeMetrics(t.Context(), &emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sub.Header(); err != nil {
+		t.Fatal(err)
+	}
+	stream, err := client.SendMetrics(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Send(hostMetrics("node")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.CloseAndRecv(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sub.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the subscriber log line", func() bool {
+		return logs.FilterMessage("sent metrics to subscriber").Len() == 1
+	})
+
+	// Agent receive, broadcast entry, subscriber send and subscriber stream
+	stages := []string{"received metrics batch", "broadcasting metrics", "broadcasted message", "sent metrics to subscriber"}
+	var id string
+	for _, stage := range stages {
+		entries := logs.FilterMessage(stage).All()
+		if len(entries) != 1 {
+			t.Fatalf("%q log lines: got %d, want 1", stage, len(entries))
+		}
+		got, _ := entries[0].ContextMap()["request_id"].(string)
+		if id == "" {
+			id = got
+		}
+		if got == "" || got != id {
+			t.Fatalf("%q request_id: got %q, want %q", stage, got, id)
+		}
+	}
+}
+
+func TestSubscriberDisconnectLogsConnectionDuration(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	client, _ := startLoggedTestServer(t, zap.New(core), newTestBroadcaster(t, nil))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	if _, err := subscribeHeader(t, ctx, client); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	waitFor(t, "the disconnect log line", func() bool {
+		return logs.FilterMessage("subscriber disconnected").Len() == 1
+	})
+
+	entry := logs.FilterMessage("subscriber disconnected").All()[0]
+	if entry.Level != zap.InfoLevel {
+		t.Fatalf("disconnect log level: got %v, want info", entry.Level)
+	}
+	if d, ok := entry.ContextMap()["duration_seconds"].(float64); !ok || d < 0 {
+		t.Fatalf("duration_seconds: got %v, want a non-negative number", entry.ContextMap()["duration_seconds"])
+	}
+}
+
+func TestDuplicateAgentIDsAreRejected(t *testing.T) {
+	// openAgent opens a SendMetrics stream as agent-1 and sends a message on it
+	openAgent := func(client gen.MetricsServiceClient) gen.MetricsService_SendMetricsClient {
+		stream, err := client.SendMetrics(withMetadata(t, agentIDKey, "agent-1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = stream.Send(hostMetrics("node"))
+		return stream
+	}
+
+	t.Run("rejected", func(t *testing.T) {
+		b := newTestBroadcaster(t, nil)
+		ch := make(chan *gen.Metrics, 10)
+		if _, err := b.Register("sub", ch); err != nil {
+			t.Fatal(err)
+		}
+		client, _ := startTestServer(t, b)
+
+		first := openAgent(client)
+		receive(t, ch)
+		_, err := openAgent(client).CloseAndRecv()
+		if status.Code(err) != codes.AlreadyExists {
+			t.Fatalf("second stream: got %v, want AlreadyExists", err)
+		}
+		if want := "agent agent-1 already has an active stream"; status.Convert(err).Message() != want {
+			t.Fatalf("error message: got %q, want %q", status.Convert(err).Message(), want)
+		}
+
+		// The first stream keeps working, and its ID is released when it ends
+		if err := first.Send(hostMetrics("node")); err != nil {
+			t.Fatal(err)
+		}
+		receive(t, ch)
+		if _, err := first.CloseAndRecv(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := openAgent(client).CloseAndRecv(); err != nil {
+			t.Fatalf("stream after the first ended: %v", err)
+		}
+	})
+
+	t.Run("reuse allowed", func(t *testing.T) {
+		b := newTestBroadcaster(t, nil)
+		ch := make(chan *gen.Metrics, 10)
+		if _, err := b.Register("sub", ch); err != nil {
+			t.Fatal(err)
+		}
+		client, _ := startTestServer(t, b, WithAgentIDReuse())
+
+		first := openAgent(client)
+		receive(t, ch)
+		if _, err := openAgent(client).CloseAndRecv(); err != nil {
+			t.Fatalf("second stream: %v", err)
+		}
+		if _, err := first.CloseAndRecv(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestMinSendIntervalIsEnforcedPerStream(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	ch := make(chan *gen.Metrics, 10)
+	if _, err := b.Register("sub", ch); err != nil {
+		t.Fatal(err)
+	}
+	const interval = 200 * time.Millisecond
+	client, _ := startTestServer(t, b, WithMinSendInterval(interval))
+
+	// The interval is per stream: another stream sending meanwhile is not limited
+	other, err := client.SendMetrics(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Send(hostMetrics("other")); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, ch)
+
+	stream, err := client.SendMetrics(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Send(hostMetrics("node")); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, ch)
+	time.Sleep(time.Millisecond)
+	_ = stream.Send(hostMetrics("node"))
+	_, err = stream.CloseAndRecv()
+	if status.Code(err) != codes.ResourceExhausted || status.Convert(err).Message() != "message rate too high" {
+		t.Fatalf("message 1ms later: got %v, want ResourceExhausted", err)
+	}
+	if len(ch) != 0 {
+		t.Fatal("the rejected message was broadcast")
+	}
+
+	time.Sleep(interval)
+	if err := other.Send(hostMetrics("other")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.CloseAndRecv(); err != nil {
+		t.Fatalf("other stream: %v", err)
+	}
+}
+
+func TestSubscribeMetricsFlowControlledWindow(t *testing.T) {
+	const window = 2
+
+	// subscribe opens a flow-controlled subscription and returns the stream and
+	// a channel receiving its messages, then its error
+	subscribe := func(t *testing.T, b *Broadcaster, blockTimeout time.Duration) (grpc.BidiStreamingClient[gen.MetricsAck, gen.Metrics], <-chan *gen.Metrics, <-chan error) {
+		client, _ := startTestServer(t, b, WithSubscriberFlowControl(window, blockTimeout))
+		stream, err := client.SubscribeMetricsFlowControlled(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stream.Header(); err != nil {
+			t.Fatal(err)
+		}
+		msgs, errs := make(chan *gen.Metrics, 10), make(chan error, 1)
+		go func() {
+			for {
+				msg, err := stream.Recv()
+				if err != nil {
+					errs <- err
+					return
+				}
+				msgs <- msg
+			}
+		}()
+		return stream, msgs, errs
+	}
+
+	t.Run("acknowledgments open the window", func(t *testing.T) {
+		b := newTestBroadcaster(t, nil)
+		stream, msgs, _ := subscribe(t, b, 5*time.Second)
+		for range window + 1 {
+			b.Broadcast(hostMetrics("node"))
+		}
+		receive(t, msgs)
+		receive(t, msgs)
+		select {
+		case <-msgs:
+			t.Fatal("a message beyond the window was sent before any acknowledgment")
+		case <-time.After(50 * time.Millisecond):
+		}
+		if err := stream.Send(&gen.MetricsAck{AcknowledgedCount: window}); err != nil {
+			t.Fatal(err)
+		}
+		receive(t, msgs)
+	})
+
+	t.Run("block timeout", func(t *testing.T) {
+		b := newTestBroadcaster(t, nil)
+		_, _, errs := subscribe(t, b, 20*time.Millisecond)
+		for range window + 1 {
+			b.Broadcast(hostMetrics("node"))
+		}
+		if err := <-errs; status.Code(err) != codes.DeadlineExceeded {
+			t.Fatalf("full window without acknowledgment: got %v, want DeadlineExceeded", err)
+		}
+	})
+
+	t.Run("closed acknowledgments", func(t *testing.T) {
+		b := newTestBroadcaster(t, nil)
+		stream, _, errs := subscribe(t, b, 5*time.Second)
+		if err := stream.CloseSend(); err != nil {
+			t.Fatal(err)
+		}
+		for range window + 1 {
+			b.Broadcast(hostMetrics("node"))
+		}
+		if err := <-errs; status.Code(err) != codes.FailedPrecondition {
+			t.Fatalf("full window after CloseSend: got %v, want FailedPrecondition", err)
+		}
+	})
+}
+
+func TestSendMetricsRejectedWhileBroadcasterPaused(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	client, _ := startTestServer(t, b)
+
+	// Streams opened before the pause keep sending
+	open, err := client.SendMetrics(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := open.Send(hostMetrics("node")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the message of the open stream", func() bool { return b.Stats().TotalBroadcasts == 1 })
+	b.PauseAll()
+
+	stream, err := client.SendMetrics(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = stream.CloseAndRecv()
+	if status.Code(err) != codes.Unavailable || status.Convert(err).Message() != "relay is paused, retry later" {
+		t.Fatalf("stream opened while paused: got %v, want Unavailable", err)
+	}
+	header, err := stream.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := header.Get(retryAfterKey); len(got) != 1 || got[0] != "10" {
+		t.Fatalf("%s header: got %v, want 10", retryAfterKey, got)
+	}
+
+	if err := open.Send(hostMetrics("node")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := open.CloseAndRecv(); err != nil {
+		t.Fatalf("stream opened before the pause: %v", err)
+	}
+}
+
+func TestPausedRetryAfterIsConfigurable(t *testing.T) {
+	b := newTestBroadcaster(t, nil)
+	client, _ := startTestServer(t, b, WithPausedRetryAfter(1500*time.Millisecond))
+	b.PauseAll()
+	if !b.IsGloballyPaused() {
+		t.Fatal("IsGloballyPaused: got false after PauseAll")
+	}
+
+	stream, err := client.SendMetrics(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.CloseAndRecv(); status.Code(err) != codes.Unavailable {
+		t.Fatalf("stream opened while paused: got %v, want Unavailable", err)
+	}
+	header, err := stream.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Rounded up to whole seconds
+	if got := header.Get(retryAfterKey); len(got) != 1 || got[0] != "2" {
+		t.Fatalf("%s header: got %v, want 2", retryAfterKey, got)
+	}
+
+	b.ResumeAll()
+	if b.IsGloballyPaused() {
+		t.Fatal("IsGloballyPaused: got true after ResumeAll")
+	}
+}
+
+func TestAgentStreamTransitionsAreLogged(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	b := newTestBroadcaster(t, nil)
+	ch := make(chan *gen.Metrics, 10)
+	if _, err := b.Register("sub", ch); err != nil {
+		t.Fatal(err)
+	}
+	client, _ := startLoggedTestServer(t, zap.New(core), b)
+
+	// count returns the number of transition log lines with the given message
+	count := func(message string) int {
+		return logs.FilterMessage(message).Len()
+	}
+	// open opens a SendMetrics stream as agentID, returning once its first
+	// message is broadcast
+	open := func(agentID string) gen.MetricsService_SendMetricsClient {
+		stream, err := client.SendMetrics(withMetadata(t, agentIDKey, agentID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := stream.Send(hostMetrics(agentID)); err != nil {
+			t.Fatal(err)
+		}
+		receive(t, ch)
+		return stream
+	}
+
+	first := open("agent-1")
+	if n := count("first agent stream opened"); n != 1 {
+		t.Fatalf("first agent: got %d opened lines, want 1", n)
+	}
+	second := open("agent-2")
+	if n := count("first agent stream opened"); n != 1 {
+		t.Fatalf("second agent: got %d opened lines, want 1", n)
+	}
+
+	if _, err := first.CloseAndRecv(); err != nil {
+		t.Fatal(err)
+	}
+	if n := count("last agent stream closed"); n != 0 {
+		t.Fatalf("one agent left: got %d closed lines, want 0", n)
+	}
+	if _, err := second.CloseAndRecv(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the last agent stream closed line", func() bool { return count("last agent stream closed") == 1 })
+	if id := logs.FilterMessage("last agent stream closed").All()[0].ContextMap()["agent_id"]; id != "agent-2" {
+		t.Fatalf("closed line agent_id: got %v, want agent-2", id)
+	}
+
+	open("agent-3")
+	if n := count("first agent stream opened"); n != 2 {
+		t.Fatalf("agent after the last closed: got %d opened lines, want 2", n)
+	}
+}
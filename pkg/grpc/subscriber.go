@@ -0,0 +1,62 @@
+package grpc
+
+import (
+	"context"
+	"regexp"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// subscriberNameKey is the metadata key carrying an optional subscriber display name.
+const subscriberNameKey = "relay-subscriber-name"
+
+// consumerGroupKey is the metadata key carrying an optional consumer group name.
+const consumerGroupKey = "relay-consumer-group"
+
+// invalidNameChars matches characters not allowed in subscriber display names.
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// SubscriberInfo describes a connected subscriber.
+//
+// Fields:
+//   - ID: unique subscriber identifier (UUID or restored from a reconnection token).
+//   - Name: sanitized display name from the relay-subscriber-name metadata (may be empty).
+type SubscriberInfo struct {
+	ID   string
+	Name string
+}
+
+// subscriberName returns the display name from the relay-subscriber-name
+// metadata, with every character outside [a-zA-Z0-9_-] replaced by '_'.
+//
+// Parameters:
+//   - ctx: stream context carrying the incoming metadata.
+//
+// Returns:
+//   - string: the sanitized name (empty if absent).
+//   - bool: true if the name had to be sanitized.
+func subscriberName(ctx context.Context) (string, bool) {
+	values := metadata.ValueFromIncomingContext(ctx, subscriberNameKey)
+	if len(values) == 0 {
+		return "", false
+	}
+
+	sanitized := invalidNameChars.ReplaceAllString(values[0], "_")
+	return sanitized, sanitized != values[0]
+}
+
+// consumerGroupName returns the group name from the relay-consumer-group metadata,
+// sanitized like subscriber display names.
+//
+// Parameters:
+//   - ctx: stream context carrying the incoming metadata.
+//
+// Returns:
+//   - string: the sanitized group name (empty if absent).
+func consumerGroupName(ctx context.Context) string {
+	values := metadata.ValueFromIncomingContext(ctx, consumerGroupKey)
+	if len(values) == 0 {
+		return ""
+	}
+	return invalidNameChars.ReplaceAllString(values[0], "_")
+}
@@ -0,0 +1,21 @@
+package grpc
+
+import "testing"
+
+func TestSubscriberNameIsSanitized(t *testing.T) {
+	client, ms := startTestServer(t, newTestBroadcaster(t, nil))
+
+	header, err := subscribeHeader(t, withMetadata(t, subscriberNameKey, "my dash/board!"), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := header.Get(subscriberIDKey)[0]
+
+	info, ok := ms.Subscriber(id)
+	if !ok {
+		t.Fatalf("subscriber %s has no stored info", id)
+	}
+	if info.ID != id || info.Name != "my_dash_board_" {
+		t.Fatalf("stored info: got %+v, want the name sanitized to my_dash_board_", info)
+	}
+}
@@ -0,0 +1,86 @@
+package grpc
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kubensage/relay/proto/gen"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// summaryStats holds the counters reported by GetMetricsSummary.
+//
+// The set of hostnames is never pruned, so it grows with the number of
+// distinct agents seen during the lifetime of the relay.
+type summaryStats struct {
+	agentsSeen      atomic.Uint64       // Number of agent streams opened
+	messagesRelayed atomic.Uint64       // Number of messages passed to the broadcaster
+	lastMessageAt   atomic.Int64        // Unix nanoseconds of the last relayed message (0 = none)
+	hostnamesMu     sync.Mutex          // Protects hostnames
+	hostnames       map[string]struct{} // Distinct hostnames of relayed messages
+}
+
+// recordMessage accounts for a message passed to the broadcaster.
+//
+// Parameters:
+//   - msg: the relayed message.
+func (st *summaryStats) recordMessage(msg *gen.Metrics) {
+	st.messagesRelayed.Add(1)
+	st.lastMessageAt.Store(time.Now().UnixNano())
+
+	host := msg.GetNodeMetrics().GetHostname()
+	if host == "" {
+		return
+	}
+	st.hostnamesMu.Lock()
+	defer st.hostnamesMu.Unlock()
+	if st.hostnames == nil {
+		st.hostnames = make(map[string]struct{})
+	}
+	st.hostnames[host] = struct{}{}
+}
+
+// sortedHostnames returns the distinct hostnames seen so far, sorted.
+func (st *summaryStats) sortedHostnames() []string {
+	st.hostnamesMu.Lock()
+	defer st.hostnamesMu.Unlock()
+	hosts := make([]string, 0, len(st.hostnames))
+	for h := range st.hostnames {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// GetMetricsSummary returns aggregate statistics about the metrics relayed
+// since the server started.
+//
+// Parameters:
+//   - _ (context.Context): unused request context.
+//   - _ (*emptypb.Empty): unused request.
+//
+// Returns:
+//   - *gen.MetricsSummary: the summary snapshot.
+//   - error: always nil.
+func (s *MetricsServer) GetMetricsSummary(_ context.Context, _ *emptypb.Empty) (*gen.MetricsSummary, error) {
+	var subscribers uint32
+	s.subscriberInfos.Range(func(_, _ any) bool {
+		subscribers++
+		return true
+	})
+
+	summary := &gen.MetricsSummary{
+		TotalAgentsSeen:      s.summary.agentsSeen.Load(),
+		TotalMessagesRelayed: s.summary.messagesRelayed.Load(),
+		UniqueHostnames:      s.summary.sortedHostnames(),
+		ActiveSubscribers:    subscribers,
+	}
+	if last := s.summary.lastMessageAt.Load(); last != 0 {
+		summary.LastMessageAt = timestamppb.New(time.Unix(0, last))
+	}
+	return summary, nil
+}
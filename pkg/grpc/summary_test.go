@@ -0,0 +1,46 @@
+package grpc
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestMetricsSummaryCountsRelayedMessages(t *testing.T) {
+	client, _ := startTestServer(t, newTestBroadcaster(t, nil))
+	if _, err := subscribeHeader(t, t.Context(), client); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	for range 2 {
+		stream, err := client.SendMetrics(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, host := range []string{"node-b", "node-a", "node-b"} {
+			if err := stream.Send(hostMetrics(host)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := stream.CloseAndRecv(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	summary, err := client.GetMetricsSummary(t.Context(), &emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.GetTotalAgentsSeen() != 2 || summary.GetTotalMessagesRelayed() != 6 || summary.GetActiveSubscribers() != 1 {
+		t.Fatalf("summary: got %v, want 2 agents, 6 messages, 1 subscriber", summary)
+	}
+	if got := summary.GetUniqueHostnames(); !slices.Equal(got, []string{"node-a", "node-b"}) {
+		t.Fatalf("unique hostnames: got %v, want [node-a node-b]", got)
+	}
+	if at := summary.GetLastMessageAt().AsTime(); at.Before(start.Add(-time.Second)) || at.After(time.Now()) {
+		t.Fatalf("last message at %v, want during the test", at)
+	}
+}
@@ -0,0 +1,110 @@
+package grpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// clusterNameKey is the metadata key carrying the optional Kubernetes cluster
+// name of an agent or subscriber stream.
+const clusterNameKey = "relay-cluster-name"
+
+// defaultTopic is the topic of subscribers that set no cluster name; it
+// receives every message regardless of cluster.
+const defaultTopic = "_all"
+
+// topic is the set of subscribers of one cluster: a Broadcaster and its
+// consumer groups.
+type topic struct {
+	broadcaster *Broadcaster
+	groups      *GroupBroadcaster
+}
+
+// clusterName returns the cluster name from the relay-cluster-name metadata,
+// sanitized like subscriber display names.
+//
+// Parameters:
+//   - ctx: stream context carrying the incoming metadata.
+//
+// Returns:
+//   - string: the sanitized cluster name (empty if absent).
+func clusterName(ctx context.Context) string {
+	values := metadata.ValueFromIncomingContext(ctx, clusterNameKey)
+	if len(values) == 0 {
+		return ""
+	}
+	return invalidNameChars.ReplaceAllString(values[0], "_")
+}
+
+// topicFor returns the topic of a cluster, creating it on first use with the
+// same options as the default broadcaster. An empty name or defaultTopic maps
+// to the default topic.
+//
+// Cluster topics are never removed, so every distinct cluster name seen by the
+// relay holds a Broadcaster for its lifetime: WithMaxClusterTopics bounds how
+// many clients can create.
+//
+// Parameters:
+//   - cluster: the cluster name.
+//
+// Returns:
+//   - *topic: the cluster topic.
+//   - error: codes.ResourceExhausted if the topic does not exist and the
+//     cluster topic limit is reached.
+func (s *MetricsServer) topicFor(cluster string) (*topic, error) {
+	if cluster == "" || cluster == defaultTopic {
+		return &topic{broadcaster: s.broadcaster, groups: s.groups}, nil
+	}
+	if v, ok := s.topics.Load(cluster); ok {
+		return v.(*topic), nil
+	}
+
+	s.topicsMu.Lock()
+	defer s.topicsMu.Unlock()
+	if v, ok := s.topics.Load(cluster); ok {
+		return v.(*topic), nil
+	}
+	if s.cfg.maxClusterTopics > 0 && s.topicCount >= s.cfg.maxClusterTopics {
+		return nil, status.Errorf(codes.ResourceExhausted, "cluster topic limit reached (%d)", s.cfg.maxClusterTopics)
+	}
+	b := s.broadcaster.sibling(cluster)
+	t := &topic{broadcaster: b, groups: NewGroupBroadcaster(b)}
+	s.topics.Store(cluster, t)
+	s.topicCount++
+	return t, nil
+}
+
+// forEachTopic calls fn with the name and topic of the default topic
+// (defaultTopic), then of every cluster topic created so far.
+func (s *MetricsServer) forEachTopic(fn func(name string, t *topic)) {
+	fn(defaultTopic, &topic{broadcaster: s.broadcaster, groups: s.groups})
+	s.topics.Range(func(k, v any) bool {
+		fn(k.(string), v.(*topic))
+		return true
+	})
+}
+
+// clusterBroadcaster returns the Broadcaster of the cluster an agent stream is
+// tagged with, in addition to the default one, or nil if the stream carries no
+// cluster name.
+//
+// Parameters:
+//   - ctx: agent stream context carrying the incoming metadata.
+//
+// Returns:
+//   - *Broadcaster: the cluster Broadcaster, or nil.
+//   - error: see topicFor.
+func (s *MetricsServer) clusterBroadcaster(ctx context.Context) (*Broadcaster, error) {
+	cluster := clusterName(ctx)
+	if cluster == "" || cluster == defaultTopic {
+		return nil, nil
+	}
+	t, err := s.topicFor(cluster)
+	if err != nil {
+		return nil, err
+	}
+	return t.broadcaster, nil
+}
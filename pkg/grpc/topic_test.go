@@ -0,0 +1,67 @@
+package grpc
+
+import (
+	"testing"
+
+	"github.com/kubensage/relay/proto/gen"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestMaxClusterTopicsRejectsNewClusters(t *testing.T) {
+	client, _ := startTestServer(t, newTestBroadcaster(t, nil), WithMaxClusterTopics(1))
+
+	// subscribe returns nil once the subscriber is registered, the stream error otherwise
+	subscribe := func(cluster string) error {
+		stream, err := client.SubscribeMetrics(withMetadata(t, clusterNameKey, cluster), &emptypb.Empty{})
+		if err != nil {
+			return err
+		}
+		if header, _ := stream.Header(); len(header.Get(subscriberIDKey)) > 0 {
+			return nil
+		}
+		_, err = stream.Recv()
+		return err
+	}
+
+	if err := subscribe("east"); err != nil {
+		t.Fatalf("first cluster: %v", err)
+	}
+	if err := subscribe("east"); err != nil {
+		t.Fatalf("existing cluster: %v", err)
+	}
+	if err := subscribe(defaultTopic); err != nil {
+		t.Fatalf("default topic: %v", err)
+	}
+	if err := subscribe("west"); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("new cluster beyond the limit: got %v, want ResourceExhausted", err)
+	}
+}
+
+func TestTopicSeriesAreIsolated(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	def := newTestBroadcaster(t, reg)
+	east := def.sibling("east")
+
+	for _, b := range []*Broadcaster{def, east} {
+		// Unbuffered and never received from: every broadcast is dropped
+		if _, err := b.Register("group:shared", make(chan *gen.Metrics)); err != nil {
+			t.Fatal(err)
+		}
+		b.Broadcast(&gen.Metrics{})
+	}
+	if n := testutil.CollectAndCount(def.metrics.SubscriberDroppedMessages); n != 2 {
+		t.Fatalf("dropped series: got %d, want one per topic", n)
+	}
+
+	east.Unregister("group:shared")
+	if got := testutil.ToFloat64(def.metrics.SubscriberDroppedMessages.WithLabelValues(defaultTopic, "group:shared")); got != 1 {
+		t.Fatalf("default topic series after unregistering on east: got %v, want 1", got)
+	}
+	if n := testutil.CollectAndCount(def.metrics.SubscriberDroppedMessages); n != 1 {
+		t.Fatalf("dropped series after unregistering on east: got %d, want 1", n)
+	}
+}
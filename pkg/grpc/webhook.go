@@ -0,0 +1,132 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kubensage/relay/proto/gen"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// webhookQueueSize is the number of messages waiting to be posted to the
+// webhook; further messages are dropped until the queue drains.
+const webhookQueueSize = 100
+
+// webhookInitialBackoff is the wait before the first retry of a failed webhook
+// post; it doubles on every further retry.
+const webhookInitialBackoff = 100 * time.Millisecond
+
+// webhookForwarder posts broadcast messages to an HTTP endpoint from its own
+// goroutine, so that slow or failing requests never delay a broadcast.
+type webhookForwarder struct {
+	url     string            // Endpoint receiving the messages
+	client  *http.Client      // Client used for the requests
+	retries int               // Retries of a failed post
+	queue   chan *gen.Metrics // Messages waiting to be posted
+	logger  *zap.Logger       // Logger for observability
+}
+
+// newWebhookForwarder creates a webhookForwarder and starts its goroutine,
+// which stops when ctx is done.
+//
+// Parameters:
+//   - ctx: context bounding the forwarder goroutine and its requests.
+//   - logger: zap.Logger for observability.
+//   - url: endpoint receiving the messages.
+//   - client: HTTP client (nil = http.DefaultClient).
+//   - retries: retries of a failed post.
+//
+// Returns:
+//   - *webhookForwarder: the running forwarder.
+func newWebhookForwarder(ctx context.Context, logger *zap.Logger, url string, client *http.Client, retries int) *webhookForwarder {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	w := &webhookForwarder{
+		url:     url,
+		client:  client,
+		retries: retries,
+		queue:   make(chan *gen.Metrics, webhookQueueSize),
+		logger:  logger,
+	}
+	go w.run(ctx)
+	return w
+}
+
+// enqueue queues msg for posting without blocking. Messages are dropped while
+// the queue is full.
+func (w *webhookForwarder) enqueue(msg *gen.Metrics) {
+	select {
+	case w.queue <- msg:
+	default:
+		w.logger.Warn("dropping webhook message: queue full", zap.String("url", w.url))
+	}
+}
+
+// run posts queued messages in order until ctx is done.
+func (w *webhookForwarder) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-w.queue:
+			w.forward(ctx, msg)
+		}
+	}
+}
+
+// forward posts msg, retrying with exponential backoff up to the configured
+// number of retries. A message that cannot be posted is logged and dropped.
+func (w *webhookForwarder) forward(ctx context.Context, msg *gen.Metrics) {
+	body, err := protojson.Marshal(msg)
+	if err != nil {
+		w.logger.Error("failed to encode webhook message", zap.Error(err))
+		return
+	}
+
+	backoff := webhookInitialBackoff
+	for attempt := 0; ; attempt++ {
+		err = w.post(ctx, body)
+		if err == nil {
+			return
+		}
+		if attempt >= w.retries || ctx.Err() != nil {
+			break
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+		backoff *= 2
+	}
+	w.logger.Warn("dropping webhook message: post failed", zap.String("url", w.url), zap.Int("retries", w.retries), zap.Error(err))
+}
+
+// post sends a single POST request with the JSON body.
+//
+// Returns:
+//   - error: if the request fails or the response status is not 2xx.
+func (w *webhookForwarder) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected webhook response status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package grpc
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kubensage/relay/proto/gen"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestWebhookForwarderPostsBroadcastMessages(t *testing.T) {
+	var attempts atomic.Int32
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first attempt fails and is retried
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if ct := r.Header.Get("Content-Type"); r.Method != http.MethodPost || ct != "application/json" {
+			t.Errorf("request: got %s with Content-Type %q, want a JSON POST", r.Method, ct)
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		bodies <- body
+	}))
+	t.Cleanup(srv.Close)
+
+	b := newTestBroadcaster(t, nil, WithWebhookForwarder(srv.URL, srv.Client(), 1))
+	ch := make(chan *gen.Metrics, 1)
+	if _, err := b.Register("sub", ch); err != nil {
+		t.Fatal(err)
+	}
+	msg := hostMetrics("node")
+	msg.SequenceNumber = 7
+	b.Broadcast(msg)
+	receive(t, ch)
+
+	select {
+	case body := <-bodies:
+		var got gen.Metrics
+		if err := protojson.Unmarshal(body, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !proto.Equal(&got, msg) {
+			t.Fatalf("webhook payload: got %v, want %v", &got, msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the webhook post")
+	}
+	if n := attempts.Load(); n != 2 {
+		t.Fatalf("attempts: got %d, want 2", n)
+	}
+}
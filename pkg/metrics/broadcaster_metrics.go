@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// BroadcasterMetrics holds the Prometheus collectors updated by a Broadcaster.
+// Broadcasters sharing a registerer share the same collectors; per-subscriber
+// series carry the topic of their Broadcaster ("_all" for the default one), so
+// that subscribers with the same ID on different topics do not share a series.
+type BroadcasterMetrics struct {
+	// SubscriberDroppedMessages counts the messages dropped for each subscriber.
+	// Series are deleted when their subscriber unregisters.
+	SubscriberDroppedMessages *prometheus.CounterVec
+	// BroadcastMessages counts the messages passed to the broadcasters.
+	BroadcastMessages prometheus.Counter
+	// Subscribers tracks the number of registered subscribers.
+	Subscribers prometheus.Gauge
+	// FilteredMessages counts the messages discarded by the message filter or
+	// transformer before fan-out.
+	FilteredMessages prometheus.Counter
+	// FanoutDuration observes the time from a broadcast call to its last
+	// subscriber send attempt.
+	FanoutDuration prometheus.Histogram
+	// SentMessages counts the messages sent to subscribers, once per subscriber
+	// that received them.
+	SentMessages prometheus.Counter
+	// LockHeld observes how long each fan-out held the broadcaster lock, with
+	// lock profiling enabled.
+	LockHeld prometheus.Histogram
+	// SubscriberChannelDepth tracks the number of messages queued on each
+	// subscriber, sampled after every fan-out to it. Series are deleted when
+	// their subscriber unregisters.
+	SubscriberChannelDepth *prometheus.GaugeVec
+}
+
+// NewBroadcasterMetrics creates the broadcaster collectors and registers them
+// on reg. Collectors already registered on reg, e.g. by another Broadcaster,
+// are reused instead.
+//
+// Parameters:
+//   - reg: the registerer to register the collectors on.
+//
+// Returns:
+//   - *BroadcasterMetrics: the registered collectors.
+//
+// Panics if a collector conflicts with a different one already registered on reg.
+func NewBroadcasterMetrics(reg prometheus.Registerer) *BroadcasterMetrics {
+	return &BroadcasterMetrics{
+		SubscriberDroppedMessages: register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "relay_subscriber_dropped_messages_total",
+			Help: "Number of metrics messages dropped for a subscriber.",
+		}, []string{"topic", "subscriber_id"})),
+		BroadcastMessages: register(reg, prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "relay_broadcast_messages_total",
+			Help: "Number of metrics messages passed to the broadcaster.",
+		})),
+		Subscribers: register(reg, prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "relay_broadcaster_subscribers",
+			Help: "Number of subscribers registered on the broadcaster.",
+		})),
+		FilteredMessages: register(reg, prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "relay_messages_filtered_total",
+			Help: "Number of metrics messages discarded by the broadcaster message filter or transformer.",
+		})),
+		// 1µs to about 262ms
+		FanoutDuration: register(reg, prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "relay_broadcast_fanout_duration_seconds",
+			Help:    "Time from a broadcast call to its last subscriber send attempt.",
+			Buckets: prometheus.ExponentialBuckets(1e-6, 4, 10),
+		})),
+		SentMessages: register(reg, prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "relay_messages_sent_total",
+			Help: "Number of metrics messages sent to subscribers, once per receiving subscriber.",
+		})),
+		// 1µs to about 262ms
+		LockHeld: register(reg, prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "relay_broadcast_lock_held_seconds",
+			Help:    "Time each fan-out held the broadcaster lock (lock profiling only).",
+			Buckets: prometheus.ExponentialBuckets(1e-6, 4, 10),
+		})),
+		SubscriberChannelDepth: register(reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "relay_subscriber_channel_depth",
+			Help: "Number of metrics messages queued on a subscriber after the last fan-out to it.",
+		}, []string{"topic", "subscriber_id"})),
+	}
+}
+
+// register registers c on reg, or returns the equivalent collector already
+// registered on reg.
+func register[C prometheus.Collector](reg prometheus.Registerer, c C) C {
+	err := reg.Register(c)
+	if err == nil {
+		return c
+	}
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		if existing, ok := are.ExistingCollector.(C); ok {
+			return existing
+		}
+	}
+	panic(err)
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// AgentConnectionsActive tracks the number of currently open SendMetrics streams.
+var AgentConnectionsActive = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "relay_agent_connections_active",
+	Help: "Number of currently open agent SendMetrics streams.",
+})
+
+// MessagesExpired counts agent messages (SendMetrics and AgentControl) discarded
+// because their expires_at had passed.
+var MessagesExpired = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "relay_messages_expired_total",
+	Help: "Number of agent messages discarded because they arrived after their expires_at.",
+})
+
+// AgentTimeToFirstMessage observes, for each SendMetrics stream, the time between
+// the stream opening and its first received message.
+var AgentTimeToFirstMessage = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "relay_agent_time_to_first_message_seconds",
+	Help:    "Time between an agent SendMetrics stream opening and its first message.",
+	Buckets: prometheus.DefBuckets,
+})
+
+// StreamDuration observes the duration of agent and subscriber streams, by RPC
+// method and exit reason (eof, error, context_canceled or limit_exceeded).
+var StreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "relay_stream_duration_seconds",
+	Help:    "Duration of relay gRPC streams, by RPC method and exit reason.",
+	Buckets: prometheus.ExponentialBuckets(1, 4, 10),
+}, []string{"rpc_method", "exit_reason"})
@@ -0,0 +1,50 @@
+package proto
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Depth returns the nesting depth of m: 1 for a message without populated
+// message fields, plus one for every level of populated nested messages,
+// including the elements of repeated fields and the values of map fields.
+//
+// Parameters:
+//   - m: the message to inspect.
+//
+// Returns:
+//   - int: the nesting depth, or 0 if m is nil or invalid.
+func Depth(m proto.Message) int {
+	if m == nil {
+		return 0
+	}
+	return depth(m.ProtoReflect())
+}
+
+// depth computes Depth on the reflective view of a message.
+func depth(m protoreflect.Message) int {
+	if !m.IsValid() {
+		return 0
+	}
+	deepest := 0
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		var d int
+		switch {
+		case fd.IsList() && fd.Message() != nil:
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				d = max(d, depth(list.Get(i).Message()))
+			}
+		case fd.IsMap() && fd.MapValue().Message() != nil:
+			v.Map().Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+				d = max(d, depth(mv.Message()))
+				return true
+			})
+		case !fd.IsList() && !fd.IsMap() && fd.Message() != nil:
+			d = depth(v.Message())
+		}
+		deepest = max(deepest, d)
+		return true
+	})
+	return deepest + 1
+}
@@ -0,0 +1,53 @@
+package proto
+
+import (
+	"testing"
+
+	"github.com/kubensage/relay/proto/gen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// nestedList returns a Value nesting n lists, each holding the next one.
+func nestedList(n int) *structpb.Value {
+	v := structpb.NewNullValue()
+	for range n {
+		v = structpb.NewListValue(&structpb.ListValue{Values: []*structpb.Value{v}})
+	}
+	return v
+}
+
+func TestDepth(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  proto.Message
+		want int
+	}{
+		{name: "nil", msg: nil, want: 0},
+		{name: "empty", msg: &gen.Metrics{}, want: 1},
+		{name: "nested", msg: &gen.Metrics{NodeMetrics: &gen.NodeMetrics{Hostname: "node"}}, want: 2},
+		{
+			name: "deepest field",
+			msg: &gen.Metrics{
+				NodeMetrics: &gen.NodeMetrics{PrimaryIpv4: wrapperspb.String("10.0.0.1")},
+				PodMetrics:  []*gen.PodMetrics{{}},
+			},
+			want: 3,
+		},
+		// Each list adds a ListValue and a Value level
+		{name: "repeated", msg: nestedList(20), want: 41},
+		{
+			name: "map",
+			msg:  &structpb.Struct{Fields: map[string]*structpb.Value{"a": structpb.NewStringValue("x"), "b": nestedList(1)}},
+			want: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Depth(tt.msg); got != tt.want {
+				t.Fatalf("Depth: got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
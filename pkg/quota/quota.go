@@ -0,0 +1,79 @@
+package quota
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// QuotaStore tracks per-agent message quotas.
+//
+// Implementations must be safe for concurrent use. MemoryStore keeps the
+// counters in process memory; a shared backend (e.g., Redis) can implement the
+// same interface to enforce quotas across relay replicas.
+type QuotaStore interface {
+	// Check consumes one message from the agent's quota.
+	//
+	// Returns:
+	//   - allowed: false if the quota was already exhausted.
+	//   - remaining: messages left in the quota after this one.
+	Check(agentID string) (allowed bool, remaining int64)
+
+	// Reset restores the full quota of every agent.
+	Reset()
+}
+
+// MemoryStore is an in-memory QuotaStore with the same limit for every agent.
+type MemoryStore struct {
+	limit int64    // Messages allowed per agent between two resets
+	used  sync.Map // Agent ID -> *atomic.Int64 messages consumed
+}
+
+// NewMemoryStore creates a MemoryStore allowing limit messages per agent.
+//
+// Parameters:
+//   - limit: messages allowed per agent between two resets.
+//
+// Returns:
+//   - *MemoryStore: a new store with every quota full.
+func NewMemoryStore(limit int64) *MemoryStore {
+	return &MemoryStore{limit: limit}
+}
+
+// Check implements QuotaStore.
+func (m *MemoryStore) Check(agentID string) (bool, int64) {
+	v, _ := m.used.LoadOrStore(agentID, new(atomic.Int64))
+	n := v.(*atomic.Int64).Add(1)
+	if n > m.limit {
+		return false, 0
+	}
+	return true, m.limit - n
+}
+
+// Reset implements QuotaStore.
+func (m *MemoryStore) Reset() {
+	m.used.Clear()
+}
+
+// ResetDaily resets store at every midnight UTC until ctx is done. It blocks
+// and is meant to run in its own goroutine.
+//
+// Parameters:
+//   - ctx: stops the reset loop when done.
+//   - store: the store to reset.
+func ResetDaily(ctx context.Context, store QuotaStore) {
+	for {
+		now := time.Now().UTC()
+		midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		timer := time.NewTimer(midnight.Sub(now))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			store.Reset()
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package quota
+
+import "testing"
+
+func TestMemoryStoreCheck(t *testing.T) {
+	store := NewMemoryStore(2)
+
+	for want := int64(1); want >= 0; want-- {
+		if allowed, remaining := store.Check("agent"); !allowed || remaining != want {
+			t.Fatalf("within quota: got %v/%d, want allowed with %d remaining", allowed, remaining, want)
+		}
+	}
+	if allowed, _ := store.Check("agent"); allowed {
+		t.Fatal("message beyond the quota was allowed")
+	}
+	if allowed, _ := store.Check("other"); !allowed {
+		t.Fatal("quota of another agent was consumed")
+	}
+
+	store.Reset()
+	if allowed, remaining := store.Check("agent"); !allowed || remaining != 1 {
+		t.Fatalf("after reset: got %v/%d, want allowed with 1 remaining", allowed, remaining)
+	}
+}
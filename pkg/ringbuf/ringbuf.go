@@ -0,0 +1,99 @@
+package ringbuf
+
+import "sync"
+
+// RingBuffer is a fixed-capacity FIFO queue that never blocks the sender: when
+// it is full, Send overwrites the oldest element. It suits real-time data where
+// the newest values matter most.
+//
+// All operations are safe for concurrent use by multiple goroutines.
+type RingBuffer[T any] struct {
+	mu     sync.Mutex // Protects all fields below
+	data   []T        // Underlying storage
+	start  int        // Index of the oldest element
+	size   int        // Number of stored elements
+	closed bool       // Set by Close
+}
+
+// New creates an empty RingBuffer holding up to size elements.
+//
+// Parameters:
+//   - size: buffer capacity; values below 1 are raised to 1.
+//
+// Returns:
+//   - *RingBuffer[T]: the new buffer.
+func New[T any](size int) *RingBuffer[T] {
+	if size < 1 {
+		size = 1
+	}
+	return &RingBuffer[T]{data: make([]T, size)}
+}
+
+// Send appends v, overwriting the oldest element if the buffer is full. Values
+// sent after Close are discarded.
+//
+// Parameters:
+//   - v: the value to append.
+//
+// Returns:
+//   - bool: false if an element was overwritten or the buffer is closed.
+func (r *RingBuffer[T]) Send(v T) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return false
+	}
+
+	r.data[(r.start+r.size)%len(r.data)] = v
+	if r.size < len(r.data) {
+		r.size++
+		return true
+	}
+	r.start = (r.start + 1) % len(r.data)
+	return false
+}
+
+// Recv removes and returns the oldest element without blocking. Elements sent
+// before Close remain receivable.
+//
+// Returns:
+//   - T: the oldest element (zero value if the buffer is empty).
+//   - bool: false if the buffer is empty.
+func (r *RingBuffer[T]) Recv() (T, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var zero T
+	if r.size == 0 {
+		return zero, false
+	}
+	v := r.data[r.start]
+	r.data[r.start] = zero // Drop the reference for the GC
+	r.start = (r.start + 1) % len(r.data)
+	r.size--
+	return v, true
+}
+
+// Len returns the number of stored elements.
+func (r *RingBuffer[T]) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.size
+}
+
+// Close marks the buffer as closed, the equivalent of closing a channel: the
+// receiver drains the remaining elements, then observes Closed. Closing an
+// already closed buffer is a no-op.
+func (r *RingBuffer[T]) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+}
+
+// Closed reports whether Close was called.
+func (r *RingBuffer[T]) Closed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
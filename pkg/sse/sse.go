@@ -0,0 +1,82 @@
+package sse
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	grpc2 "github.com/kubensage/relay/pkg/grpc"
+	"github.com/kubensage/relay/proto/gen"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// channelSize is the capacity of the channel of each SSE subscriber.
+const channelSize = 100
+
+// SSEHandler returns an http.Handler streaming broadcast metrics as
+// server-sent events, for clients that cannot use gRPC.
+//
+// Behavior:
+//   - Every request registers a new subscriber with a random UUID; the
+//     subscriber cap set with WithSubscriberCap answers 503 Service Unavailable.
+//   - The response is text/event-stream, with one event per message whose data
+//     field is the protojson encoding of the Metrics message, flushed right away.
+//   - The subscriber is unregistered when the client disconnects, which is
+//     detected through the request context.
+//   - The response ends when the broadcaster closes the subscriber channel
+//     (e.g., UnregisterAll during shutdown).
+//
+// Parameters:
+//   - broadcaster: the Broadcaster the subscribers register with.
+//
+// Returns:
+//   - http.Handler: the SSE handler.
+func SSEHandler(broadcaster *grpc2.Broadcaster) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		id := uuid.NewString()
+		ch := make(chan *gen.Metrics, channelSize)
+		if _, err := broadcaster.Register(id, ch); err != nil {
+			if errors.Is(err, grpc2.ErrSubscriberCapReached) {
+				http.Error(w, "subscriber cap reached", http.StatusServiceUnavailable)
+				return
+			}
+			http.Error(w, "failed to register subscriber", http.StatusInternalServerError)
+			return
+		}
+		defer broadcaster.Unregister(id)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		for {
+			select {
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				// protojson never emits newlines without Multiline, so the
+				// encoding fits in a single data line
+				data, err := protojson.Marshal(msg)
+				if err != nil {
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+					return
+				}
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+}
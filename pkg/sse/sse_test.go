@@ -0,0 +1,62 @@
+package sse
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	grpc2 "github.com/kubensage/relay/pkg/grpc"
+	"github.com/kubensage/relay/proto/gen"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestSSEHandlerStreamsBroadcastMessages(t *testing.T) {
+	broadcaster := grpc2.NewBroadcaster(t.Context(), grpc2.WithMetrics(prometheus.NewRegistry()))
+	srv := httptest.NewServer(SSEHandler(broadcaster))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type: got %q, want text/event-stream", ct)
+	}
+	// The subscriber is registered before the response headers are sent
+	for i := range 5 {
+		broadcaster.Broadcast(&gen.Metrics{NodeMetrics: &gen.NodeMetrics{Hostname: fmt.Sprintf("node-%d", i)}})
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for i := 0; i < 5; {
+		if !scanner.Scan() {
+			t.Fatalf("stream ended after %d events: %v", i, scanner.Err())
+		}
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		msg := &gen.Metrics{}
+		if err := protojson.Unmarshal([]byte(data), msg); err != nil {
+			t.Fatalf("event %d: %v", i, err)
+		}
+		if got, want := msg.GetNodeMetrics().GetHostname(), fmt.Sprintf("node-%d", i); got != want {
+			t.Fatalf("event %d: got host %q, want %q", i, got, want)
+		}
+		i++
+	}
+
+	resp.Body.Close()
+	deadline := time.Now().Add(time.Second)
+	for broadcaster.SubscriberCount() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("subscriber still registered after the client disconnected")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,108 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrExpired is returned by Verify when the token signature is valid but its
+	// expiry time has passed.
+	ErrExpired = errors.New("reconnect token expired")
+	// ErrTopicMismatch is returned by Verify when the token was issued for
+	// another topic than the one the subscriber reconnects to.
+	ErrTopicMismatch = errors.New("reconnect token issued for another topic")
+)
+
+// Claims is the payload carried by a reconnection token.
+//
+// Fields:
+//   - SubscriberID: the subscriber ID to restore on reconnect (stored as the JWT subject).
+//   - Topic: the topic the subscriber was registered on.
+//   - ExpiresAt: time after which the token is rejected.
+type Claims struct {
+	SubscriberID string
+	Topic        string
+	ExpiresAt    time.Time
+}
+
+// jwtClaims is the signed JWT payload: the registered claims and the topic.
+type jwtClaims struct {
+	jwt.RegisteredClaims
+	Topic string `json:"topic"`
+}
+
+// Signer issues and verifies HMAC-SHA256 signed reconnection tokens (JWT, HS256).
+type Signer struct {
+	key []byte        // HMAC signing key
+	ttl time.Duration // Lifetime of issued tokens
+}
+
+// NewSigner creates a Signer using the given key and token lifetime.
+//
+// Parameters:
+//   - key: HMAC-SHA256 signing key. Must not be empty.
+//   - ttl: lifetime of issued tokens.
+//
+// Returns:
+//   - *Signer: a new Signer instance.
+func NewSigner(key []byte, ttl time.Duration) *Signer {
+	return &Signer{key: key, ttl: ttl}
+}
+
+// Issue creates a signed token for the given subscriber ID and topic.
+//
+// Parameters:
+//   - subscriberID: ID of the subscriber the token identifies.
+//   - topic: topic the subscriber is registered on.
+//
+// Returns:
+//   - string: the compact serialized JWT.
+//   - error: if signing fails.
+func (s *Signer) Issue(subscriberID, topic string) (string, error) {
+	now := time.Now()
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, jwtClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subscriberID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.ttl)),
+		},
+		Topic: topic,
+	})
+	return t.SignedString(s.key)
+}
+
+// Verify parses the given token, checks its signature, expiry and topic, and
+// returns its claims.
+//
+// Parameters:
+//   - raw: the compact serialized JWT.
+//   - topic: topic the subscriber reconnects to.
+//
+// Returns:
+//   - *Claims: the verified token claims.
+//   - error: ErrExpired if the token has expired, ErrTopicMismatch if it was
+//     issued for another topic, or a descriptive error if it is invalid.
+func (s *Signer) Verify(raw, topic string) (*Claims, error) {
+	var c jwtClaims
+	_, err := jwt.ParseWithClaims(raw, &c, func(*jwt.Token) (any, error) {
+		return s.key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, ErrExpired
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid reconnect token: %w", err)
+	}
+	if c.Subject == "" {
+		return nil, errors.New("invalid reconnect token: missing subject")
+	}
+	if c.Topic != topic {
+		return nil, ErrTopicMismatch
+	}
+
+	return &Claims{SubscriberID: c.Subject, Topic: c.Topic, ExpiresAt: c.ExpiresAt.Time}, nil
+}
@@ -0,0 +1,59 @@
+package token
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIssueVerifyRoundTrip(t *testing.T) {
+	s := NewSigner([]byte("test-key"), time.Hour)
+	raw, err := s.Issue("sub-1", "east")
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	claims, err := s.Verify(raw, "east")
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if claims.SubscriberID != "sub-1" || claims.Topic != "east" {
+		t.Fatalf("claims: got %+v", claims)
+	}
+	if until := time.Until(claims.ExpiresAt); until <= 0 || until > time.Hour {
+		t.Fatalf("expiry: got %v from now, want within the TTL", until)
+	}
+}
+
+func TestVerifyRejectsExpiredToken(t *testing.T) {
+	s := NewSigner([]byte("test-key"), -time.Minute)
+	raw, err := s.Issue("sub-1", "east")
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if _, err := s.Verify(raw, "east"); !errors.Is(err, ErrExpired) {
+		t.Fatalf("got %v, want ErrExpired", err)
+	}
+}
+
+func TestVerifyRejectsOtherTopic(t *testing.T) {
+	s := NewSigner([]byte("test-key"), time.Hour)
+	raw, err := s.Issue("sub-1", "east")
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if _, err := s.Verify(raw, "west"); !errors.Is(err, ErrTopicMismatch) {
+		t.Fatalf("got %v, want ErrTopicMismatch", err)
+	}
+}
+
+func TestVerifyRejectsOtherKey(t *testing.T) {
+	raw, err := NewSigner([]byte("key-a"), time.Hour).Issue("sub-1", "east")
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	_, err = NewSigner([]byte("key-b"), time.Hour).Verify(raw, "east")
+	if err == nil || errors.Is(err, ErrExpired) || errors.Is(err, ErrTopicMismatch) {
+		t.Fatalf("got %v, want an invalid token error", err)
+	}
+}
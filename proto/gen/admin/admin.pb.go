@@ -0,0 +1,734 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v3.21.12
+// source: proto/admin/admin.proto
+
+package admin
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// AgentCommand enumerates the control commands an operator can send to an agent.
+// Values mirror metrics.ControlCommand.
+type AgentCommand int32
+
+const (
+	// Default value, rejected by the relay.
+	AgentCommand_AGENT_COMMAND_UNSPECIFIED AgentCommand = 0
+	// Stop sending metrics until RESUME is received.
+	AgentCommand_PAUSE AgentCommand = 1
+	// Resume sending metrics after a PAUSE.
+	AgentCommand_RESUME AgentCommand = 2
+	// Replace the set of metric groups the agent sends.
+	AgentCommand_FILTER_UPDATE AgentCommand = 3
+)
+
+// Enum value maps for AgentCommand.
+var (
+	AgentCommand_name = map[int32]string{
+		0: "AGENT_COMMAND_UNSPECIFIED",
+		1: "PAUSE",
+		2: "RESUME",
+		3: "FILTER_UPDATE",
+	}
+	AgentCommand_value = map[string]int32{
+		"AGENT_COMMAND_UNSPECIFIED": 0,
+		"PAUSE":                     1,
+		"RESUME":                    2,
+		"FILTER_UPDATE":             3,
+	}
+)
+
+func (x AgentCommand) Enum() *AgentCommand {
+	p := new(AgentCommand)
+	*p = x
+	return p
+}
+
+func (x AgentCommand) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (AgentCommand) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_admin_admin_proto_enumTypes[0].Descriptor()
+}
+
+func (AgentCommand) Type() protoreflect.EnumType {
+	return &file_proto_admin_admin_proto_enumTypes[0]
+}
+
+func (x AgentCommand) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use AgentCommand.Descriptor instead.
+func (AgentCommand) EnumDescriptor() ([]byte, []int) {
+	return file_proto_admin_admin_proto_rawDescGZIP(), []int{0}
+}
+
+// SendAgentControlRequest targets a control command at a connected agent.
+type SendAgentControlRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// ID of the agent, as returned in the relay-agent-id header of its AgentControl stream.
+	AgentId string `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	// Command to send.
+	Command AgentCommand `protobuf:"varint,2,opt,name=command,proto3,enum=admin.AgentCommand" json:"command,omitempty"`
+	// Metric groups for FILTER_UPDATE (e.g., "cpu", "memory"). Empty means all groups.
+	MetricGroups  []string `protobuf:"bytes,3,rep,name=metric_groups,json=metricGroups,proto3" json:"metric_groups,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SendAgentControlRequest) Reset() {
+	*x = SendAgentControlRequest{}
+	mi := &file_proto_admin_admin_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SendAgentControlRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendAgentControlRequest) ProtoMessage() {}
+
+func (x *SendAgentControlRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_admin_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendAgentControlRequest.ProtoReflect.Descriptor instead.
+func (*SendAgentControlRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_admin_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SendAgentControlRequest) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *SendAgentControlRequest) GetCommand() AgentCommand {
+	if x != nil {
+		return x.Command
+	}
+	return AgentCommand_AGENT_COMMAND_UNSPECIFIED
+}
+
+func (x *SendAgentControlRequest) GetMetricGroups() []string {
+	if x != nil {
+		return x.MetricGroups
+	}
+	return nil
+}
+
+// DisconnectRequest targets a connected subscriber.
+type DisconnectRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// ID of the subscriber, as returned in the relay-subscriber-id header of its stream.
+	SubscriberId  string `protobuf:"bytes,1,opt,name=subscriber_id,json=subscriberId,proto3" json:"subscriber_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DisconnectRequest) Reset() {
+	*x = DisconnectRequest{}
+	mi := &file_proto_admin_admin_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DisconnectRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DisconnectRequest) ProtoMessage() {}
+
+func (x *DisconnectRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_admin_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DisconnectRequest.ProtoReflect.Descriptor instead.
+func (*DisconnectRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_admin_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *DisconnectRequest) GetSubscriberId() string {
+	if x != nil {
+		return x.SubscriberId
+	}
+	return ""
+}
+
+// SubscriberStatus describes a single registered subscriber.
+type SubscriberStatus struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Subscriber ID assigned by the relay.
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Display name sent in the relay-subscriber-name header, if any.
+	Name string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	// Time the subscriber was registered with the broadcaster.
+	RegisteredAt *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=registered_at,json=registeredAt,proto3" json:"registered_at,omitempty"`
+	// Number of messages queued for the subscriber, in its channel or ring buffer.
+	QueueLength uint32 `protobuf:"varint,4,opt,name=queue_length,json=queueLength,proto3" json:"queue_length,omitempty"`
+	// Topic the subscriber is registered on: its relay-cluster-name, or "_all".
+	Topic         string `protobuf:"bytes,5,opt,name=topic,proto3" json:"topic,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubscriberStatus) Reset() {
+	*x = SubscriberStatus{}
+	mi := &file_proto_admin_admin_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscriberStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscriberStatus) ProtoMessage() {}
+
+func (x *SubscriberStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_admin_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscriberStatus.ProtoReflect.Descriptor instead.
+func (*SubscriberStatus) Descriptor() ([]byte, []int) {
+	return file_proto_admin_admin_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SubscriberStatus) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *SubscriberStatus) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *SubscriberStatus) GetRegisteredAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.RegisteredAt
+	}
+	return nil
+}
+
+func (x *SubscriberStatus) GetQueueLength() uint32 {
+	if x != nil {
+		return x.QueueLength
+	}
+	return 0
+}
+
+func (x *SubscriberStatus) GetTopic() string {
+	if x != nil {
+		return x.Topic
+	}
+	return ""
+}
+
+// BroadcasterStatus is a snapshot of the relay broadcaster telemetry. The
+// counters describe the default topic broadcaster; subscribers lists the
+// subscribers of every topic.
+type BroadcasterStatus struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Number of subscribers registered on the default topic.
+	SubscriberCount uint32 `protobuf:"varint,1,opt,name=subscriber_count,json=subscriberCount,proto3" json:"subscriber_count,omitempty"`
+	// Number of messages passed to the broadcaster.
+	TotalBroadcasts uint64 `protobuf:"varint,2,opt,name=total_broadcasts,json=totalBroadcasts,proto3" json:"total_broadcasts,omitempty"`
+	// Number of per-subscriber deliveries dropped because of slow subscribers.
+	TotalDropped uint64 `protobuf:"varint,3,opt,name=total_dropped,json=totalDropped,proto3" json:"total_dropped,omitempty"`
+	// Number of messages dropped as duplicates.
+	TotalDeduplicated uint64 `protobuf:"varint,4,opt,name=total_deduplicated,json=totalDeduplicated,proto3" json:"total_deduplicated,omitempty"`
+	// Number of messages dropped by the message transformer.
+	TotalFiltered uint64 `protobuf:"varint,5,opt,name=total_filtered,json=totalFiltered,proto3" json:"total_filtered,omitempty"`
+	// Sequence number of the last message fanned out to subscribers.
+	SequenceNumber uint64 `protobuf:"varint,6,opt,name=sequence_number,json=sequenceNumber,proto3" json:"sequence_number,omitempty"`
+	// Number of open SendMetrics agent streams.
+	ActiveAgents uint32 `protobuf:"varint,7,opt,name=active_agents,json=activeAgents,proto3" json:"active_agents,omitempty"`
+	// Registered subscribers of every topic.
+	Subscribers   []*SubscriberStatus `protobuf:"bytes,8,rep,name=subscribers,proto3" json:"subscribers,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BroadcasterStatus) Reset() {
+	*x = BroadcasterStatus{}
+	mi := &file_proto_admin_admin_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BroadcasterStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BroadcasterStatus) ProtoMessage() {}
+
+func (x *BroadcasterStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_admin_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BroadcasterStatus.ProtoReflect.Descriptor instead.
+func (*BroadcasterStatus) Descriptor() ([]byte, []int) {
+	return file_proto_admin_admin_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *BroadcasterStatus) GetSubscriberCount() uint32 {
+	if x != nil {
+		return x.SubscriberCount
+	}
+	return 0
+}
+
+func (x *BroadcasterStatus) GetTotalBroadcasts() uint64 {
+	if x != nil {
+		return x.TotalBroadcasts
+	}
+	return 0
+}
+
+func (x *BroadcasterStatus) GetTotalDropped() uint64 {
+	if x != nil {
+		return x.TotalDropped
+	}
+	return 0
+}
+
+func (x *BroadcasterStatus) GetTotalDeduplicated() uint64 {
+	if x != nil {
+		return x.TotalDeduplicated
+	}
+	return 0
+}
+
+func (x *BroadcasterStatus) GetTotalFiltered() uint64 {
+	if x != nil {
+		return x.TotalFiltered
+	}
+	return 0
+}
+
+func (x *BroadcasterStatus) GetSequenceNumber() uint64 {
+	if x != nil {
+		return x.SequenceNumber
+	}
+	return 0
+}
+
+func (x *BroadcasterStatus) GetActiveAgents() uint32 {
+	if x != nil {
+		return x.ActiveAgents
+	}
+	return 0
+}
+
+func (x *BroadcasterStatus) GetSubscribers() []*SubscriberStatus {
+	if x != nil {
+		return x.Subscribers
+	}
+	return nil
+}
+
+// BroadcasterMetrics is a snapshot of the counters of a broadcaster.
+type BroadcasterMetrics struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Number of messages passed to the broadcaster.
+	TotalBroadcasts uint64 `protobuf:"varint,1,opt,name=total_broadcasts,json=totalBroadcasts,proto3" json:"total_broadcasts,omitempty"`
+	// Number of per-subscriber deliveries dropped.
+	TotalDropped uint64 `protobuf:"varint,2,opt,name=total_dropped,json=totalDropped,proto3" json:"total_dropped,omitempty"`
+	// Number of messages dropped by the message filter or transformer.
+	TotalFiltered uint64 `protobuf:"varint,3,opt,name=total_filtered,json=totalFiltered,proto3" json:"total_filtered,omitempty"`
+	// Number of messages dropped as duplicates.
+	TotalDeduplicated uint64 `protobuf:"varint,4,opt,name=total_deduplicated,json=totalDeduplicated,proto3" json:"total_deduplicated,omitempty"`
+	// Number of registered subscribers.
+	SubscriberCount uint32 `protobuf:"varint,5,opt,name=subscriber_count,json=subscriberCount,proto3" json:"subscriber_count,omitempty"`
+	// Sequence number of the last message fanned out to subscribers.
+	SequenceNumber uint64 `protobuf:"varint,6,opt,name=sequence_number,json=sequenceNumber,proto3" json:"sequence_number,omitempty"`
+	// Time the last message was fanned out; unset if none was.
+	LastBroadcastAt *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=last_broadcast_at,json=lastBroadcastAt,proto3" json:"last_broadcast_at,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *BroadcasterMetrics) Reset() {
+	*x = BroadcasterMetrics{}
+	mi := &file_proto_admin_admin_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BroadcasterMetrics) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BroadcasterMetrics) ProtoMessage() {}
+
+func (x *BroadcasterMetrics) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_admin_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BroadcasterMetrics.ProtoReflect.Descriptor instead.
+func (*BroadcasterMetrics) Descriptor() ([]byte, []int) {
+	return file_proto_admin_admin_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *BroadcasterMetrics) GetTotalBroadcasts() uint64 {
+	if x != nil {
+		return x.TotalBroadcasts
+	}
+	return 0
+}
+
+func (x *BroadcasterMetrics) GetTotalDropped() uint64 {
+	if x != nil {
+		return x.TotalDropped
+	}
+	return 0
+}
+
+func (x *BroadcasterMetrics) GetTotalFiltered() uint64 {
+	if x != nil {
+		return x.TotalFiltered
+	}
+	return 0
+}
+
+func (x *BroadcasterMetrics) GetTotalDeduplicated() uint64 {
+	if x != nil {
+		return x.TotalDeduplicated
+	}
+	return 0
+}
+
+func (x *BroadcasterMetrics) GetSubscriberCount() uint32 {
+	if x != nil {
+		return x.SubscriberCount
+	}
+	return 0
+}
+
+func (x *BroadcasterMetrics) GetSequenceNumber() uint64 {
+	if x != nil {
+		return x.SequenceNumber
+	}
+	return 0
+}
+
+func (x *BroadcasterMetrics) GetLastBroadcastAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastBroadcastAt
+	}
+	return nil
+}
+
+// AgentInfo describes a connected agent stream.
+type AgentInfo struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Agent ID from the relay-agent-id metadata, or generated by the relay if absent.
+	AgentId string `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	// Remote address of the agent.
+	PeerAddr string `protobuf:"bytes,2,opt,name=peer_addr,json=peerAddr,proto3" json:"peer_addr,omitempty"`
+	// Time the agent stream was opened.
+	ConnectedAt *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=connected_at,json=connectedAt,proto3" json:"connected_at,omitempty"`
+	// Number of Metrics messages received on the stream so far.
+	MessagesSent  uint64 `protobuf:"varint,4,opt,name=messages_sent,json=messagesSent,proto3" json:"messages_sent,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AgentInfo) Reset() {
+	*x = AgentInfo{}
+	mi := &file_proto_admin_admin_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AgentInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AgentInfo) ProtoMessage() {}
+
+func (x *AgentInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_admin_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AgentInfo.ProtoReflect.Descriptor instead.
+func (*AgentInfo) Descriptor() ([]byte, []int) {
+	return file_proto_admin_admin_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *AgentInfo) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *AgentInfo) GetPeerAddr() string {
+	if x != nil {
+		return x.PeerAddr
+	}
+	return ""
+}
+
+func (x *AgentInfo) GetConnectedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ConnectedAt
+	}
+	return nil
+}
+
+func (x *AgentInfo) GetMessagesSent() uint64 {
+	if x != nil {
+		return x.MessagesSent
+	}
+	return 0
+}
+
+// AgentList lists the connected agents.
+type AgentList struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Connected agents, oldest connection first.
+	Agents        []*AgentInfo `protobuf:"bytes,1,rep,name=agents,proto3" json:"agents,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AgentList) Reset() {
+	*x = AgentList{}
+	mi := &file_proto_admin_admin_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AgentList) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AgentList) ProtoMessage() {}
+
+func (x *AgentList) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_admin_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AgentList.ProtoReflect.Descriptor instead.
+func (*AgentList) Descriptor() ([]byte, []int) {
+	return file_proto_admin_admin_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *AgentList) GetAgents() []*AgentInfo {
+	if x != nil {
+		return x.Agents
+	}
+	return nil
+}
+
+var File_proto_admin_admin_proto protoreflect.FileDescriptor
+
+const file_proto_admin_admin_proto_rawDesc = "" +
+	"\n" +
+	"\x17proto/admin/admin.proto\x12\x05admin\x1a\x1bgoogle/protobuf/empty.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\x88\x01\n" +
+	"\x17SendAgentControlRequest\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12-\n" +
+	"\acommand\x18\x02 \x01(\x0e2\x13.admin.AgentCommandR\acommand\x12#\n" +
+	"\rmetric_groups\x18\x03 \x03(\tR\fmetricGroups\"8\n" +
+	"\x11DisconnectRequest\x12#\n" +
+	"\rsubscriber_id\x18\x01 \x01(\tR\fsubscriberId\"\xb0\x01\n" +
+	"\x10SubscriberStatus\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12?\n" +
+	"\rregistered_at\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\fregisteredAt\x12!\n" +
+	"\fqueue_length\x18\x04 \x01(\rR\vqueueLength\x12\x14\n" +
+	"\x05topic\x18\x05 \x01(\tR\x05topic\"\xed\x02\n" +
+	"\x11BroadcasterStatus\x12)\n" +
+	"\x10subscriber_count\x18\x01 \x01(\rR\x0fsubscriberCount\x12)\n" +
+	"\x10total_broadcasts\x18\x02 \x01(\x04R\x0ftotalBroadcasts\x12#\n" +
+	"\rtotal_dropped\x18\x03 \x01(\x04R\ftotalDropped\x12-\n" +
+	"\x12total_deduplicated\x18\x04 \x01(\x04R\x11totalDeduplicated\x12%\n" +
+	"\x0etotal_filtered\x18\x05 \x01(\x04R\rtotalFiltered\x12'\n" +
+	"\x0fsequence_number\x18\x06 \x01(\x04R\x0esequenceNumber\x12#\n" +
+	"\ractive_agents\x18\a \x01(\rR\factiveAgents\x129\n" +
+	"\vsubscribers\x18\b \x03(\v2\x17.admin.SubscriberStatusR\vsubscribers\"\xd6\x02\n" +
+	"\x12BroadcasterMetrics\x12)\n" +
+	"\x10total_broadcasts\x18\x01 \x01(\x04R\x0ftotalBroadcasts\x12#\n" +
+	"\rtotal_dropped\x18\x02 \x01(\x04R\ftotalDropped\x12%\n" +
+	"\x0etotal_filtered\x18\x03 \x01(\x04R\rtotalFiltered\x12-\n" +
+	"\x12total_deduplicated\x18\x04 \x01(\x04R\x11totalDeduplicated\x12)\n" +
+	"\x10subscriber_count\x18\x05 \x01(\rR\x0fsubscriberCount\x12'\n" +
+	"\x0fsequence_number\x18\x06 \x01(\x04R\x0esequenceNumber\x12F\n" +
+	"\x11last_broadcast_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\x0flastBroadcastAt\"\xa7\x01\n" +
+	"\tAgentInfo\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\x1b\n" +
+	"\tpeer_addr\x18\x02 \x01(\tR\bpeerAddr\x12=\n" +
+	"\fconnected_at\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\vconnectedAt\x12#\n" +
+	"\rmessages_sent\x18\x04 \x01(\x04R\fmessagesSent\"5\n" +
+	"\tAgentList\x12(\n" +
+	"\x06agents\x18\x01 \x03(\v2\x10.admin.AgentInfoR\x06agents*W\n" +
+	"\fAgentCommand\x12\x1d\n" +
+	"\x19AGENT_COMMAND_UNSPECIFIED\x10\x00\x12\t\n" +
+	"\x05PAUSE\x10\x01\x12\n" +
+	"\n" +
+	"\x06RESUME\x10\x02\x12\x11\n" +
+	"\rFILTER_UPDATE\x10\x032\xf2\x02\n" +
+	"\fAdminService\x12J\n" +
+	"\x10SendAgentControl\x12\x1e.admin.SendAgentControlRequest\x1a\x16.google.protobuf.Empty\x12H\n" +
+	"\x14GetBroadcasterStatus\x12\x16.google.protobuf.Empty\x1a\x18.admin.BroadcasterStatus\x126\n" +
+	"\n" +
+	"ListAgents\x12\x16.google.protobuf.Empty\x1a\x10.admin.AgentList\x12J\n" +
+	"\x15GetBroadcasterMetrics\x12\x16.google.protobuf.Empty\x1a\x19.admin.BroadcasterMetrics\x12H\n" +
+	"\x14DisconnectSubscriber\x12\x18.admin.DisconnectRequest\x1a\x16.google.protobuf.EmptyB\x12Z\x10/proto/gen/adminb\x06proto3"
+
+var (
+	file_proto_admin_admin_proto_rawDescOnce sync.Once
+	file_proto_admin_admin_proto_rawDescData []byte
+)
+
+func file_proto_admin_admin_proto_rawDescGZIP() []byte {
+	file_proto_admin_admin_proto_rawDescOnce.Do(func() {
+		file_proto_admin_admin_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_admin_admin_proto_rawDesc), len(file_proto_admin_admin_proto_rawDesc)))
+	})
+	return file_proto_admin_admin_proto_rawDescData
+}
+
+var file_proto_admin_admin_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_proto_admin_admin_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_proto_admin_admin_proto_goTypes = []any{
+	(AgentCommand)(0),               // 0: admin.AgentCommand
+	(*SendAgentControlRequest)(nil), // 1: admin.SendAgentControlRequest
+	(*DisconnectRequest)(nil),       // 2: admin.DisconnectRequest
+	(*SubscriberStatus)(nil),        // 3: admin.SubscriberStatus
+	(*BroadcasterStatus)(nil),       // 4: admin.BroadcasterStatus
+	(*BroadcasterMetrics)(nil),      // 5: admin.BroadcasterMetrics
+	(*AgentInfo)(nil),               // 6: admin.AgentInfo
+	(*AgentList)(nil),               // 7: admin.AgentList
+	(*timestamppb.Timestamp)(nil),   // 8: google.protobuf.Timestamp
+	(*emptypb.Empty)(nil),           // 9: google.protobuf.Empty
+}
+var file_proto_admin_admin_proto_depIdxs = []int32{
+	0,  // 0: admin.SendAgentControlRequest.command:type_name -> admin.AgentCommand
+	8,  // 1: admin.SubscriberStatus.registered_at:type_name -> google.protobuf.Timestamp
+	3,  // 2: admin.BroadcasterStatus.subscribers:type_name -> admin.SubscriberStatus
+	8,  // 3: admin.BroadcasterMetrics.last_broadcast_at:type_name -> google.protobuf.Timestamp
+	8,  // 4: admin.AgentInfo.connected_at:type_name -> google.protobuf.Timestamp
+	6,  // 5: admin.AgentList.agents:type_name -> admin.AgentInfo
+	1,  // 6: admin.AdminService.SendAgentControl:input_type -> admin.SendAgentControlRequest
+	9,  // 7: admin.AdminService.GetBroadcasterStatus:input_type -> google.protobuf.Empty
+	9,  // 8: admin.AdminService.ListAgents:input_type -> google.protobuf.Empty
+	9,  // 9: admin.AdminService.GetBroadcasterMetrics:input_type -> google.protobuf.Empty
+	2,  // 10: admin.AdminService.DisconnectSubscriber:input_type -> admin.DisconnectRequest
+	9,  // 11: admin.AdminService.SendAgentControl:output_type -> google.protobuf.Empty
+	4,  // 12: admin.AdminService.GetBroadcasterStatus:output_type -> admin.BroadcasterStatus
+	7,  // 13: admin.AdminService.ListAgents:output_type -> admin.AgentList
+	5,  // 14: admin.AdminService.GetBroadcasterMetrics:output_type -> admin.BroadcasterMetrics
+	9,  // 15: admin.AdminService.DisconnectSubscriber:output_type -> google.protobuf.Empty
+	11, // [11:16] is the sub-list for method output_type
+	6,  // [6:11] is the sub-list for method input_type
+	6,  // [6:6] is the sub-list for extension type_name
+	6,  // [6:6] is the sub-list for extension extendee
+	0,  // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_proto_admin_admin_proto_init() }
+func file_proto_admin_admin_proto_init() {
+	if File_proto_admin_admin_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_admin_admin_proto_rawDesc), len(file_proto_admin_admin_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_proto_admin_admin_proto_goTypes,
+		DependencyIndexes: file_proto_admin_admin_proto_depIdxs,
+		EnumInfos:         file_proto_admin_admin_proto_enumTypes,
+		MessageInfos:      file_proto_admin_admin_proto_msgTypes,
+	}.Build()
+	File_proto_admin_admin_proto = out.File
+	file_proto_admin_admin_proto_goTypes = nil
+	file_proto_admin_admin_proto_depIdxs = nil
+}
@@ -10,6 +10,7 @@ import (
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
 	emptypb "google.golang.org/protobuf/types/known/emptypb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
 	reflect "reflect"
 	sync "sync"
 	unsafe "unsafe"
@@ -22,6 +23,63 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// ControlCommand enumerates the control commands the relay can send to an agent.
+type ControlCommand int32
+
+const (
+	// Default value, never sent.
+	ControlCommand_CONTROL_COMMAND_UNSPECIFIED ControlCommand = 0
+	// Stop sending metrics until RESUME is received.
+	ControlCommand_PAUSE ControlCommand = 1
+	// Resume sending metrics after a PAUSE.
+	ControlCommand_RESUME ControlCommand = 2
+	// Replace the set of metric groups the agent sends (see ControlMessage.metric_groups).
+	ControlCommand_FILTER_UPDATE ControlCommand = 3
+)
+
+// Enum value maps for ControlCommand.
+var (
+	ControlCommand_name = map[int32]string{
+		0: "CONTROL_COMMAND_UNSPECIFIED",
+		1: "PAUSE",
+		2: "RESUME",
+		3: "FILTER_UPDATE",
+	}
+	ControlCommand_value = map[string]int32{
+		"CONTROL_COMMAND_UNSPECIFIED": 0,
+		"PAUSE":                       1,
+		"RESUME":                      2,
+		"FILTER_UPDATE":               3,
+	}
+)
+
+func (x ControlCommand) Enum() *ControlCommand {
+	p := new(ControlCommand)
+	*p = x
+	return p
+}
+
+func (x ControlCommand) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ControlCommand) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_metrics_proto_enumTypes[0].Descriptor()
+}
+
+func (ControlCommand) Type() protoreflect.EnumType {
+	return &file_proto_metrics_proto_enumTypes[0]
+}
+
+func (x ControlCommand) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ControlCommand.Descriptor instead.
+func (ControlCommand) EnumDescriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{0}
+}
+
 // Metrics is the root message that encapsulates all collected metrics from a node.
 // It includes both node-level metrics (hardware, OS, pressure stats, etc.)
 // and pod-level metrics (for all pods and containers running on the node).
@@ -32,7 +90,13 @@ type Metrics struct {
 	// System-level metrics for the current node.
 	NodeMetrics *NodeMetrics `protobuf:"bytes,2,opt,name=node_metrics,json=nodeMetrics,proto3" json:"node_metrics,omitempty"`
 	// Runtime metrics for all pods and their containers scheduled on this node.
-	PodMetrics    []*PodMetrics `protobuf:"bytes,3,rep,name=pod_metrics,json=podMetrics,proto3" json:"pod_metrics,omitempty"`
+	PodMetrics []*PodMetrics `protobuf:"bytes,3,rep,name=pod_metrics,json=podMetrics,proto3" json:"pod_metrics,omitempty"`
+	// Optional per-stream sequence number, starting at 1 and incremented by one
+	// for each message of a SendMetrics stream; 0 means unset.
+	SequenceNumber uint64 `protobuf:"varint,4,opt,name=sequence_number,json=sequenceNumber,proto3" json:"sequence_number,omitempty"`
+	// Optional expiry: the relay discards the message instead of relaying it if it is
+	// received after this time.
+	ExpiresAt     *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -88,19 +152,412 @@ func (x *Metrics) GetPodMetrics() []*PodMetrics {
 	return nil
 }
 
+func (x *Metrics) GetSequenceNumber() uint64 {
+	if x != nil {
+		return x.SequenceNumber
+	}
+	return 0
+}
+
+func (x *Metrics) GetExpiresAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return nil
+}
+
+// ControlMessage is a command sent by the relay to an agent over the AgentControl stream.
+type ControlMessage struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Command to execute.
+	Command ControlCommand `protobuf:"varint,1,opt,name=command,proto3,enum=metrics.ControlCommand" json:"command,omitempty"`
+	// Metric groups the agent should send (e.g., "cpu", "memory"). Only used with FILTER_UPDATE;
+	// an empty list means all groups.
+	MetricGroups  []string `protobuf:"bytes,2,rep,name=metric_groups,json=metricGroups,proto3" json:"metric_groups,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ControlMessage) Reset() {
+	*x = ControlMessage{}
+	mi := &file_proto_metrics_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ControlMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ControlMessage) ProtoMessage() {}
+
+func (x *ControlMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ControlMessage.ProtoReflect.Descriptor instead.
+func (*ControlMessage) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ControlMessage) GetCommand() ControlCommand {
+	if x != nil {
+		return x.Command
+	}
+	return ControlCommand_CONTROL_COMMAND_UNSPECIFIED
+}
+
+func (x *ControlMessage) GetMetricGroups() []string {
+	if x != nil {
+		return x.MetricGroups
+	}
+	return nil
+}
+
+// FilterUpdate replaces the filter applied to a SubscribeMetricsV2 stream.
+type FilterUpdate struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Shell-style glob (Go path.Match syntax, e.g., "node-[0-9]*") matched against
+	// NodeMetrics.hostname. Empty matches every host.
+	HostnameGlob  string `protobuf:"bytes,1,opt,name=hostname_glob,json=hostnameGlob,proto3" json:"hostname_glob,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FilterUpdate) Reset() {
+	*x = FilterUpdate{}
+	mi := &file_proto_metrics_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FilterUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FilterUpdate) ProtoMessage() {}
+
+func (x *FilterUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FilterUpdate.ProtoReflect.Descriptor instead.
+func (*FilterUpdate) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *FilterUpdate) GetHostnameGlob() string {
+	if x != nil {
+		return x.HostnameGlob
+	}
+	return ""
+}
+
+// MetricsAck acknowledges the messages received on a SendMetricsV2 stream, by the relay,
+// or on a SubscribeMetricsFlowControlled stream, by the subscriber.
+type MetricsAck struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Number of messages of the stream processed by the receiver so far.
+	AcknowledgedCount uint64 `protobuf:"varint,1,opt,name=acknowledged_count,json=acknowledgedCount,proto3" json:"acknowledged_count,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *MetricsAck) Reset() {
+	*x = MetricsAck{}
+	mi := &file_proto_metrics_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricsAck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricsAck) ProtoMessage() {}
+
+func (x *MetricsAck) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricsAck.ProtoReflect.Descriptor instead.
+func (*MetricsAck) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *MetricsAck) GetAcknowledgedCount() uint64 {
+	if x != nil {
+		return x.AcknowledgedCount
+	}
+	return 0
+}
+
+// MetricsBatch groups consecutive Metrics messages delivered by SubscribeMetricsBatch.
+type MetricsBatch struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The messages, in delivery order.
+	Messages      []*Metrics `protobuf:"bytes,1,rep,name=messages,proto3" json:"messages,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetricsBatch) Reset() {
+	*x = MetricsBatch{}
+	mi := &file_proto_metrics_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricsBatch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricsBatch) ProtoMessage() {}
+
+func (x *MetricsBatch) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricsBatch.ProtoReflect.Descriptor instead.
+func (*MetricsBatch) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *MetricsBatch) GetMessages() []*Metrics {
+	if x != nil {
+		return x.Messages
+	}
+	return nil
+}
+
+// MetricsSummary aggregates what the relay has seen since it started.
+type MetricsSummary struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Number of agent streams (SendMetrics and AgentControl) opened.
+	TotalAgentsSeen uint64 `protobuf:"varint,1,opt,name=total_agents_seen,json=totalAgentsSeen,proto3" json:"total_agents_seen,omitempty"`
+	// Number of Metrics messages accepted and passed on to subscribers.
+	TotalMessagesRelayed uint64 `protobuf:"varint,2,opt,name=total_messages_relayed,json=totalMessagesRelayed,proto3" json:"total_messages_relayed,omitempty"`
+	// Sorted distinct NodeMetrics.hostname values of the relayed messages.
+	UniqueHostnames []string `protobuf:"bytes,3,rep,name=unique_hostnames,json=uniqueHostnames,proto3" json:"unique_hostnames,omitempty"`
+	// Number of currently connected subscribers.
+	ActiveSubscribers uint32 `protobuf:"varint,4,opt,name=active_subscribers,json=activeSubscribers,proto3" json:"active_subscribers,omitempty"`
+	// Time the last message was relayed; unset if none was.
+	LastMessageAt *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=last_message_at,json=lastMessageAt,proto3" json:"last_message_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetricsSummary) Reset() {
+	*x = MetricsSummary{}
+	mi := &file_proto_metrics_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricsSummary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricsSummary) ProtoMessage() {}
+
+func (x *MetricsSummary) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricsSummary.ProtoReflect.Descriptor instead.
+func (*MetricsSummary) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *MetricsSummary) GetTotalAgentsSeen() uint64 {
+	if x != nil {
+		return x.TotalAgentsSeen
+	}
+	return 0
+}
+
+func (x *MetricsSummary) GetTotalMessagesRelayed() uint64 {
+	if x != nil {
+		return x.TotalMessagesRelayed
+	}
+	return 0
+}
+
+func (x *MetricsSummary) GetUniqueHostnames() []string {
+	if x != nil {
+		return x.UniqueHostnames
+	}
+	return nil
+}
+
+func (x *MetricsSummary) GetActiveSubscribers() uint32 {
+	if x != nil {
+		return x.ActiveSubscribers
+	}
+	return 0
+}
+
+func (x *MetricsSummary) GetLastMessageAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastMessageAt
+	}
+	return nil
+}
+
+// PingResponse reports the liveness of the relay.
+type PingResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Current time on the relay.
+	ServerTime *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=server_time,json=serverTime,proto3" json:"server_time,omitempty"`
+	// Relay build version.
+	Version string `protobuf:"bytes,2,opt,name=version,proto3" json:"version,omitempty"`
+	// Seconds elapsed since the relay started.
+	UptimeSeconds int64 `protobuf:"varint,3,opt,name=uptime_seconds,json=uptimeSeconds,proto3" json:"uptime_seconds,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PingResponse) Reset() {
+	*x = PingResponse{}
+	mi := &file_proto_metrics_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PingResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PingResponse) ProtoMessage() {}
+
+func (x *PingResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PingResponse.ProtoReflect.Descriptor instead.
+func (*PingResponse) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *PingResponse) GetServerTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ServerTime
+	}
+	return nil
+}
+
+func (x *PingResponse) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *PingResponse) GetUptimeSeconds() int64 {
+	if x != nil {
+		return x.UptimeSeconds
+	}
+	return 0
+}
+
 var File_proto_metrics_proto protoreflect.FileDescriptor
 
 const file_proto_metrics_proto_rawDesc = "" +
 	"\n" +
-	"\x13proto/metrics.proto\x12\ametrics\x1a\x1bgoogle/protobuf/empty.proto\x1a\x18proto/node_metrics.proto\x1a\x17proto/pod_metrics.proto\"\x96\x01\n" +
+	"\x13proto/metrics.proto\x12\ametrics\x1a\x1bgoogle/protobuf/empty.proto\x1a\x1fgoogle/protobuf/timestamp.proto\x1a\x18proto/node_metrics.proto\x1a\x17proto/pod_metrics.proto\"\xfa\x01\n" +
 	"\aMetrics\x12\x1c\n" +
 	"\ttimestamp\x18\x01 \x01(\x03R\ttimestamp\x127\n" +
 	"\fnode_metrics\x18\x02 \x01(\v2\x14.metrics.NodeMetricsR\vnodeMetrics\x124\n" +
 	"\vpod_metrics\x18\x03 \x03(\v2\x13.metrics.PodMetricsR\n" +
-	"podMetrics2\x8b\x01\n" +
+	"podMetrics\x12'\n" +
+	"\x0fsequence_number\x18\x04 \x01(\x04R\x0esequenceNumber\x129\n" +
+	"\n" +
+	"expires_at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\texpiresAt\"h\n" +
+	"\x0eControlMessage\x121\n" +
+	"\acommand\x18\x01 \x01(\x0e2\x17.metrics.ControlCommandR\acommand\x12#\n" +
+	"\rmetric_groups\x18\x02 \x03(\tR\fmetricGroups\"3\n" +
+	"\fFilterUpdate\x12#\n" +
+	"\rhostname_glob\x18\x01 \x01(\tR\fhostnameGlob\";\n" +
+	"\n" +
+	"MetricsAck\x12-\n" +
+	"\x12acknowledged_count\x18\x01 \x01(\x04R\x11acknowledgedCount\"<\n" +
+	"\fMetricsBatch\x12,\n" +
+	"\bmessages\x18\x01 \x03(\v2\x10.metrics.MetricsR\bmessages\"\x90\x02\n" +
+	"\x0eMetricsSummary\x12*\n" +
+	"\x11total_agents_seen\x18\x01 \x01(\x04R\x0ftotalAgentsSeen\x124\n" +
+	"\x16total_messages_relayed\x18\x02 \x01(\x04R\x14totalMessagesRelayed\x12)\n" +
+	"\x10unique_hostnames\x18\x03 \x03(\tR\x0funiqueHostnames\x12-\n" +
+	"\x12active_subscribers\x18\x04 \x01(\rR\x11activeSubscribers\x12B\n" +
+	"\x0flast_message_at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\rlastMessageAt\"\x8c\x01\n" +
+	"\fPingResponse\x12;\n" +
+	"\vserver_time\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"serverTime\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\tR\aversion\x12%\n" +
+	"\x0euptime_seconds\x18\x03 \x01(\x03R\ruptimeSeconds*[\n" +
+	"\x0eControlCommand\x12\x1f\n" +
+	"\x1bCONTROL_COMMAND_UNSPECIFIED\x10\x00\x12\t\n" +
+	"\x05PAUSE\x10\x01\x12\n" +
+	"\n" +
+	"\x06RESUME\x10\x02\x12\x11\n" +
+	"\rFILTER_UPDATE\x10\x032\xdd\x04\n" +
 	"\x0eMetricsService\x129\n" +
-	"\vSendMetrics\x12\x10.metrics.Metrics\x1a\x16.google.protobuf.Empty(\x01\x12>\n" +
-	"\x10SubscribeMetrics\x12\x16.google.protobuf.Empty\x1a\x10.metrics.Metrics0\x01B\fZ\n" +
+	"\vSendMetrics\x12\x10.metrics.Metrics\x1a\x16.google.protobuf.Empty(\x01\x12:\n" +
+	"\rSendMetricsV2\x12\x10.metrics.Metrics\x1a\x13.metrics.MetricsAck(\x010\x01\x12>\n" +
+	"\x10SubscribeMetrics\x12\x16.google.protobuf.Empty\x1a\x10.metrics.Metrics0\x01\x12A\n" +
+	"\x12SubscribeMetricsV2\x12\x15.metrics.FilterUpdate\x1a\x10.metrics.Metrics(\x010\x01\x12H\n" +
+	"\x15SubscribeMetricsBatch\x12\x16.google.protobuf.Empty\x1a\x15.metrics.MetricsBatch0\x01\x12K\n" +
+	"\x1eSubscribeMetricsFlowControlled\x12\x13.metrics.MetricsAck\x1a\x10.metrics.Metrics(\x010\x01\x12=\n" +
+	"\fAgentControl\x12\x10.metrics.Metrics\x1a\x17.metrics.ControlMessage(\x010\x01\x12D\n" +
+	"\x11GetMetricsSummary\x12\x16.google.protobuf.Empty\x1a\x17.metrics.MetricsSummary\x125\n" +
+	"\x04Ping\x12\x16.google.protobuf.Empty\x1a\x15.metrics.PingResponseB\fZ\n" +
 	"/proto/genb\x06proto3"
 
 var (
@@ -115,25 +572,53 @@ func file_proto_metrics_proto_rawDescGZIP() []byte {
 	return file_proto_metrics_proto_rawDescData
 }
 
-var file_proto_metrics_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_proto_metrics_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_proto_metrics_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
 var file_proto_metrics_proto_goTypes = []any{
-	(*Metrics)(nil),       // 0: metrics.Metrics
-	(*NodeMetrics)(nil),   // 1: metrics.NodeMetrics
-	(*PodMetrics)(nil),    // 2: metrics.PodMetrics
-	(*emptypb.Empty)(nil), // 3: google.protobuf.Empty
+	(ControlCommand)(0),           // 0: metrics.ControlCommand
+	(*Metrics)(nil),               // 1: metrics.Metrics
+	(*ControlMessage)(nil),        // 2: metrics.ControlMessage
+	(*FilterUpdate)(nil),          // 3: metrics.FilterUpdate
+	(*MetricsAck)(nil),            // 4: metrics.MetricsAck
+	(*MetricsBatch)(nil),          // 5: metrics.MetricsBatch
+	(*MetricsSummary)(nil),        // 6: metrics.MetricsSummary
+	(*PingResponse)(nil),          // 7: metrics.PingResponse
+	(*NodeMetrics)(nil),           // 8: metrics.NodeMetrics
+	(*PodMetrics)(nil),            // 9: metrics.PodMetrics
+	(*timestamppb.Timestamp)(nil), // 10: google.protobuf.Timestamp
+	(*emptypb.Empty)(nil),         // 11: google.protobuf.Empty
 }
 var file_proto_metrics_proto_depIdxs = []int32{
-	1, // 0: metrics.Metrics.node_metrics:type_name -> metrics.NodeMetrics
-	2, // 1: metrics.Metrics.pod_metrics:type_name -> metrics.PodMetrics
-	0, // 2: metrics.MetricsService.SendMetrics:input_type -> metrics.Metrics
-	3, // 3: metrics.MetricsService.SubscribeMetrics:input_type -> google.protobuf.Empty
-	3, // 4: metrics.MetricsService.SendMetrics:output_type -> google.protobuf.Empty
-	0, // 5: metrics.MetricsService.SubscribeMetrics:output_type -> metrics.Metrics
-	4, // [4:6] is the sub-list for method output_type
-	2, // [2:4] is the sub-list for method input_type
-	2, // [2:2] is the sub-list for extension type_name
-	2, // [2:2] is the sub-list for extension extendee
-	0, // [0:2] is the sub-list for field type_name
+	8,  // 0: metrics.Metrics.node_metrics:type_name -> metrics.NodeMetrics
+	9,  // 1: metrics.Metrics.pod_metrics:type_name -> metrics.PodMetrics
+	10, // 2: metrics.Metrics.expires_at:type_name -> google.protobuf.Timestamp
+	0,  // 3: metrics.ControlMessage.command:type_name -> metrics.ControlCommand
+	1,  // 4: metrics.MetricsBatch.messages:type_name -> metrics.Metrics
+	10, // 5: metrics.MetricsSummary.last_message_at:type_name -> google.protobuf.Timestamp
+	10, // 6: metrics.PingResponse.server_time:type_name -> google.protobuf.Timestamp
+	1,  // 7: metrics.MetricsService.SendMetrics:input_type -> metrics.Metrics
+	1,  // 8: metrics.MetricsService.SendMetricsV2:input_type -> metrics.Metrics
+	11, // 9: metrics.MetricsService.SubscribeMetrics:input_type -> google.protobuf.Empty
+	3,  // 10: metrics.MetricsService.SubscribeMetricsV2:input_type -> metrics.FilterUpdate
+	11, // 11: metrics.MetricsService.SubscribeMetricsBatch:input_type -> google.protobuf.Empty
+	4,  // 12: metrics.MetricsService.SubscribeMetricsFlowControlled:input_type -> metrics.MetricsAck
+	1,  // 13: metrics.MetricsService.AgentControl:input_type -> metrics.Metrics
+	11, // 14: metrics.MetricsService.GetMetricsSummary:input_type -> google.protobuf.Empty
+	11, // 15: metrics.MetricsService.Ping:input_type -> google.protobuf.Empty
+	11, // 16: metrics.MetricsService.SendMetrics:output_type -> google.protobuf.Empty
+	4,  // 17: metrics.MetricsService.SendMetricsV2:output_type -> metrics.MetricsAck
+	1,  // 18: metrics.MetricsService.SubscribeMetrics:output_type -> metrics.Metrics
+	1,  // 19: metrics.MetricsService.SubscribeMetricsV2:output_type -> metrics.Metrics
+	5,  // 20: metrics.MetricsService.SubscribeMetricsBatch:output_type -> metrics.MetricsBatch
+	1,  // 21: metrics.MetricsService.SubscribeMetricsFlowControlled:output_type -> metrics.Metrics
+	2,  // 22: metrics.MetricsService.AgentControl:output_type -> metrics.ControlMessage
+	6,  // 23: metrics.MetricsService.GetMetricsSummary:output_type -> metrics.MetricsSummary
+	7,  // 24: metrics.MetricsService.Ping:output_type -> metrics.PingResponse
+	16, // [16:25] is the sub-list for method output_type
+	7,  // [7:16] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
 }
 
 func init() { file_proto_metrics_proto_init() }
@@ -148,13 +633,14 @@ func file_proto_metrics_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_metrics_proto_rawDesc), len(file_proto_metrics_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   1,
+			NumEnums:      1,
+			NumMessages:   7,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_proto_metrics_proto_goTypes,
 		DependencyIndexes: file_proto_metrics_proto_depIdxs,
+		EnumInfos:         file_proto_metrics_proto_enumTypes,
 		MessageInfos:      file_proto_metrics_proto_msgTypes,
 	}.Build()
 	File_proto_metrics_proto = out.File
@@ -20,8 +20,15 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	MetricsService_SendMetrics_FullMethodName      = "/metrics.MetricsService/SendMetrics"
-	MetricsService_SubscribeMetrics_FullMethodName = "/metrics.MetricsService/SubscribeMetrics"
+	MetricsService_SendMetrics_FullMethodName                    = "/metrics.MetricsService/SendMetrics"
+	MetricsService_SendMetricsV2_FullMethodName                  = "/metrics.MetricsService/SendMetricsV2"
+	MetricsService_SubscribeMetrics_FullMethodName               = "/metrics.MetricsService/SubscribeMetrics"
+	MetricsService_SubscribeMetricsV2_FullMethodName             = "/metrics.MetricsService/SubscribeMetricsV2"
+	MetricsService_SubscribeMetricsBatch_FullMethodName          = "/metrics.MetricsService/SubscribeMetricsBatch"
+	MetricsService_SubscribeMetricsFlowControlled_FullMethodName = "/metrics.MetricsService/SubscribeMetricsFlowControlled"
+	MetricsService_AgentControl_FullMethodName                   = "/metrics.MetricsService/AgentControl"
+	MetricsService_GetMetricsSummary_FullMethodName              = "/metrics.MetricsService/GetMetricsSummary"
+	MetricsService_Ping_FullMethodName                           = "/metrics.MetricsService/Ping"
 )
 
 // MetricsServiceClient is the client API for MetricsService service.
@@ -34,9 +41,28 @@ type MetricsServiceClient interface {
 	// Receives a continuous stream of Metrics messages from agents.
 	// The agent opens a stream and sends data periodically (e.g., every 5s).
 	SendMetrics(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Metrics, emptypb.Empty], error)
+	// Bidirectional variant of SendMetrics: the relay periodically acknowledges the number
+	// of messages processed so far, and once more when the agent closes its side.
+	SendMetricsV2(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[Metrics, MetricsAck], error)
 	// Allows a client (e.g., exporter or dashboard) to subscribe to a live stream of metrics.
 	// The relay pushes each incoming Metrics message to all subscribers.
 	SubscribeMetrics(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Metrics], error)
+	// Bidirectional variant of SubscribeMetrics: the client can send FilterUpdate messages
+	// at any time to change which Metrics messages are forwarded to it.
+	SubscribeMetricsV2(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[FilterUpdate, Metrics], error)
+	// Variant of SubscribeMetrics delivering up to relay-batch-size messages per MetricsBatch;
+	// a partial batch is sent once relay-batch-flush-ms have elapsed.
+	SubscribeMetricsBatch(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[MetricsBatch], error)
+	// Flow-controlled variant of SubscribeMetrics: the client acknowledges the number of
+	// messages received so far, and the relay stops sending while too many are unacknowledged.
+	SubscribeMetricsFlowControlled(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[MetricsAck, Metrics], error)
+	// Bidirectional variant of SendMetrics: the agent streams Metrics messages while the relay
+	// streams ControlMessage commands back on the same stream.
+	AgentControl(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[Metrics, ControlMessage], error)
+	// Returns aggregate statistics about the relayed metrics, without subscribing to the stream.
+	GetMetricsSummary(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*MetricsSummary, error)
+	// Lightweight unary liveness check, for probes that cannot use streaming RPCs.
+	Ping(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*PingResponse, error)
 }
 
 type metricsServiceClient struct {
@@ -60,9 +86,22 @@ func (c *metricsServiceClient) SendMetrics(ctx context.Context, opts ...grpc.Cal
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type MetricsService_SendMetricsClient = grpc.ClientStreamingClient[Metrics, emptypb.Empty]
 
+func (c *metricsServiceClient) SendMetricsV2(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[Metrics, MetricsAck], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MetricsService_ServiceDesc.Streams[1], MetricsService_SendMetricsV2_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Metrics, MetricsAck]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricsService_SendMetricsV2Client = grpc.BidiStreamingClient[Metrics, MetricsAck]
+
 func (c *metricsServiceClient) SubscribeMetrics(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Metrics], error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	stream, err := c.cc.NewStream(ctx, &MetricsService_ServiceDesc.Streams[1], MetricsService_SubscribeMetrics_FullMethodName, cOpts...)
+	stream, err := c.cc.NewStream(ctx, &MetricsService_ServiceDesc.Streams[2], MetricsService_SubscribeMetrics_FullMethodName, cOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -79,6 +118,84 @@ func (c *metricsServiceClient) SubscribeMetrics(ctx context.Context, in *emptypb
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type MetricsService_SubscribeMetricsClient = grpc.ServerStreamingClient[Metrics]
 
+func (c *metricsServiceClient) SubscribeMetricsV2(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[FilterUpdate, Metrics], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MetricsService_ServiceDesc.Streams[3], MetricsService_SubscribeMetricsV2_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[FilterUpdate, Metrics]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricsService_SubscribeMetricsV2Client = grpc.BidiStreamingClient[FilterUpdate, Metrics]
+
+func (c *metricsServiceClient) SubscribeMetricsBatch(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[MetricsBatch], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MetricsService_ServiceDesc.Streams[4], MetricsService_SubscribeMetricsBatch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[emptypb.Empty, MetricsBatch]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricsService_SubscribeMetricsBatchClient = grpc.ServerStreamingClient[MetricsBatch]
+
+func (c *metricsServiceClient) SubscribeMetricsFlowControlled(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[MetricsAck, Metrics], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MetricsService_ServiceDesc.Streams[5], MetricsService_SubscribeMetricsFlowControlled_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[MetricsAck, Metrics]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricsService_SubscribeMetricsFlowControlledClient = grpc.BidiStreamingClient[MetricsAck, Metrics]
+
+func (c *metricsServiceClient) AgentControl(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[Metrics, ControlMessage], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MetricsService_ServiceDesc.Streams[6], MetricsService_AgentControl_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Metrics, ControlMessage]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricsService_AgentControlClient = grpc.BidiStreamingClient[Metrics, ControlMessage]
+
+func (c *metricsServiceClient) GetMetricsSummary(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*MetricsSummary, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MetricsSummary)
+	err := c.cc.Invoke(ctx, MetricsService_GetMetricsSummary_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsServiceClient) Ping(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*PingResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PingResponse)
+	err := c.cc.Invoke(ctx, MetricsService_Ping_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // MetricsServiceServer is the server API for MetricsService service.
 // All implementations must embed UnimplementedMetricsServiceServer
 // for forward compatibility.
@@ -89,9 +206,28 @@ type MetricsServiceServer interface {
 	// Receives a continuous stream of Metrics messages from agents.
 	// The agent opens a stream and sends data periodically (e.g., every 5s).
 	SendMetrics(grpc.ClientStreamingServer[Metrics, emptypb.Empty]) error
+	// Bidirectional variant of SendMetrics: the relay periodically acknowledges the number
+	// of messages processed so far, and once more when the agent closes its side.
+	SendMetricsV2(grpc.BidiStreamingServer[Metrics, MetricsAck]) error
 	// Allows a client (e.g., exporter or dashboard) to subscribe to a live stream of metrics.
 	// The relay pushes each incoming Metrics message to all subscribers.
 	SubscribeMetrics(*emptypb.Empty, grpc.ServerStreamingServer[Metrics]) error
+	// Bidirectional variant of SubscribeMetrics: the client can send FilterUpdate messages
+	// at any time to change which Metrics messages are forwarded to it.
+	SubscribeMetricsV2(grpc.BidiStreamingServer[FilterUpdate, Metrics]) error
+	// Variant of SubscribeMetrics delivering up to relay-batch-size messages per MetricsBatch;
+	// a partial batch is sent once relay-batch-flush-ms have elapsed.
+	SubscribeMetricsBatch(*emptypb.Empty, grpc.ServerStreamingServer[MetricsBatch]) error
+	// Flow-controlled variant of SubscribeMetrics: the client acknowledges the number of
+	// messages received so far, and the relay stops sending while too many are unacknowledged.
+	SubscribeMetricsFlowControlled(grpc.BidiStreamingServer[MetricsAck, Metrics]) error
+	// Bidirectional variant of SendMetrics: the agent streams Metrics messages while the relay
+	// streams ControlMessage commands back on the same stream.
+	AgentControl(grpc.BidiStreamingServer[Metrics, ControlMessage]) error
+	// Returns aggregate statistics about the relayed metrics, without subscribing to the stream.
+	GetMetricsSummary(context.Context, *emptypb.Empty) (*MetricsSummary, error)
+	// Lightweight unary liveness check, for probes that cannot use streaming RPCs.
+	Ping(context.Context, *emptypb.Empty) (*PingResponse, error)
 	mustEmbedUnimplementedMetricsServiceServer()
 }
 
@@ -105,9 +241,30 @@ type UnimplementedMetricsServiceServer struct{}
 func (UnimplementedMetricsServiceServer) SendMetrics(grpc.ClientStreamingServer[Metrics, emptypb.Empty]) error {
 	return status.Errorf(codes.Unimplemented, "method SendMetrics not implemented")
 }
+func (UnimplementedMetricsServiceServer) SendMetricsV2(grpc.BidiStreamingServer[Metrics, MetricsAck]) error {
+	return status.Errorf(codes.Unimplemented, "method SendMetricsV2 not implemented")
+}
 func (UnimplementedMetricsServiceServer) SubscribeMetrics(*emptypb.Empty, grpc.ServerStreamingServer[Metrics]) error {
 	return status.Errorf(codes.Unimplemented, "method SubscribeMetrics not implemented")
 }
+func (UnimplementedMetricsServiceServer) SubscribeMetricsV2(grpc.BidiStreamingServer[FilterUpdate, Metrics]) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeMetricsV2 not implemented")
+}
+func (UnimplementedMetricsServiceServer) SubscribeMetricsBatch(*emptypb.Empty, grpc.ServerStreamingServer[MetricsBatch]) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeMetricsBatch not implemented")
+}
+func (UnimplementedMetricsServiceServer) SubscribeMetricsFlowControlled(grpc.BidiStreamingServer[MetricsAck, Metrics]) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeMetricsFlowControlled not implemented")
+}
+func (UnimplementedMetricsServiceServer) AgentControl(grpc.BidiStreamingServer[Metrics, ControlMessage]) error {
+	return status.Errorf(codes.Unimplemented, "method AgentControl not implemented")
+}
+func (UnimplementedMetricsServiceServer) GetMetricsSummary(context.Context, *emptypb.Empty) (*MetricsSummary, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMetricsSummary not implemented")
+}
+func (UnimplementedMetricsServiceServer) Ping(context.Context, *emptypb.Empty) (*PingResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Ping not implemented")
+}
 func (UnimplementedMetricsServiceServer) mustEmbedUnimplementedMetricsServiceServer() {}
 func (UnimplementedMetricsServiceServer) testEmbeddedByValue()                        {}
 
@@ -136,6 +293,13 @@ func _MetricsService_SendMetrics_Handler(srv interface{}, stream grpc.ServerStre
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type MetricsService_SendMetricsServer = grpc.ClientStreamingServer[Metrics, emptypb.Empty]
 
+func _MetricsService_SendMetricsV2_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MetricsServiceServer).SendMetricsV2(&grpc.GenericServerStream[Metrics, MetricsAck]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricsService_SendMetricsV2Server = grpc.BidiStreamingServer[Metrics, MetricsAck]
+
 func _MetricsService_SubscribeMetrics_Handler(srv interface{}, stream grpc.ServerStream) error {
 	m := new(emptypb.Empty)
 	if err := stream.RecvMsg(m); err != nil {
@@ -147,24 +311,130 @@ func _MetricsService_SubscribeMetrics_Handler(srv interface{}, stream grpc.Serve
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type MetricsService_SubscribeMetricsServer = grpc.ServerStreamingServer[Metrics]
 
+func _MetricsService_SubscribeMetricsV2_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MetricsServiceServer).SubscribeMetricsV2(&grpc.GenericServerStream[FilterUpdate, Metrics]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricsService_SubscribeMetricsV2Server = grpc.BidiStreamingServer[FilterUpdate, Metrics]
+
+func _MetricsService_SubscribeMetricsBatch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(emptypb.Empty)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MetricsServiceServer).SubscribeMetricsBatch(m, &grpc.GenericServerStream[emptypb.Empty, MetricsBatch]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricsService_SubscribeMetricsBatchServer = grpc.ServerStreamingServer[MetricsBatch]
+
+func _MetricsService_SubscribeMetricsFlowControlled_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MetricsServiceServer).SubscribeMetricsFlowControlled(&grpc.GenericServerStream[MetricsAck, Metrics]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricsService_SubscribeMetricsFlowControlledServer = grpc.BidiStreamingServer[MetricsAck, Metrics]
+
+func _MetricsService_AgentControl_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MetricsServiceServer).AgentControl(&grpc.GenericServerStream[Metrics, ControlMessage]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricsService_AgentControlServer = grpc.BidiStreamingServer[Metrics, ControlMessage]
+
+func _MetricsService_GetMetricsSummary_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).GetMetricsSummary(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_GetMetricsSummary_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).GetMetricsSummary(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricsService_Ping_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).Ping(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_Ping_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).Ping(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // MetricsService_ServiceDesc is the grpc.ServiceDesc for MetricsService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
 var MetricsService_ServiceDesc = grpc.ServiceDesc{
 	ServiceName: "metrics.MetricsService",
 	HandlerType: (*MetricsServiceServer)(nil),
-	Methods:     []grpc.MethodDesc{},
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetMetricsSummary",
+			Handler:    _MetricsService_GetMetricsSummary_Handler,
+		},
+		{
+			MethodName: "Ping",
+			Handler:    _MetricsService_Ping_Handler,
+		},
+	},
 	Streams: []grpc.StreamDesc{
 		{
 			StreamName:    "SendMetrics",
 			Handler:       _MetricsService_SendMetrics_Handler,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "SendMetricsV2",
+			Handler:       _MetricsService_SendMetricsV2_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 		{
 			StreamName:    "SubscribeMetrics",
 			Handler:       _MetricsService_SubscribeMetrics_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "SubscribeMetricsV2",
+			Handler:       _MetricsService_SubscribeMetricsV2_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "SubscribeMetricsBatch",
+			Handler:       _MetricsService_SubscribeMetricsBatch_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "SubscribeMetricsFlowControlled",
+			Handler:       _MetricsService_SubscribeMetricsFlowControlled_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "AgentControl",
+			Handler:       _MetricsService_AgentControl_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
 	Metadata: "proto/metrics.proto",
 }